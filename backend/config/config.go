@@ -1,13 +1,26 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// Placeholder secrets of the defaults, refused outside dev mode
+const (
+	defaultJWTSecret        = "your-super-secret-jwt-key"
+	defaultEnrichmentAPIKey = "your_secure_api_key_here"
+)
+
 type Config struct {
 	Port             string
 	MongoURI         string
@@ -18,10 +31,92 @@ type Config struct {
 	EnrichmentAPIKey string
 	CORSOrigins      []string
 
+	// Development with GIN_MODE=debug, the only mode that accepts the default secrets
+	DevMode bool
+
+	// Access token signing. HS256 signs with JWTSecret, RS256 and EdDSA with the private key file
+	// and publish its public key. Verification keys and secrets keep verifying tokens besides the
+	// signing key, so keys can be rotated without signing anyone out.
+	JWTAlgorithm            string
+	JWTPrivateKeyFile       string
+	JWTVerificationKeyFiles []string
+	JWTVerificationSecrets  []string
+	JWTIssuer               string
+	JWTAudience             string
+
+	// Access tokens last JWTExpiration and are renewed with refresh tokens
+	RefreshTokenExpiration time.Duration
+
 	// Timeout configurations
 	DefaultTimeout       time.Duration
 	BulkOperationTimeout time.Duration
 	EnrichmentTimeout    time.Duration
+
+	// Resumable upload configurations
+	UploadDir        string
+	MaxUploadSize    int64
+	UploadExpiration time.Duration
+
+	// Confidence an enriched value needs to win over the original in the best value view
+	BestValueThreshold int
+
+	// Background export configurations
+	PublicURL           string // Base URL of the API used in download links, relative links when empty
+	ExportDir           string
+	ExportRetentionDays int
+	ExportURLExpiration time.Duration
+	ExportSigningKey    string
+
+	// Account emails, sent through SMTP or written to the outbox directory
+	AppURL                      string // Base URL of the frontend used in email links
+	MailDriver                  string // "smtp" or "outbox"
+	MailFrom                    string
+	MailOutboxDir               string
+	SMTPHost                    string
+	SMTPPort                    int
+	SMTPUsername                string
+	SMTPPassword                string
+	EmailVerificationExpiration time.Duration
+	PasswordResetExpiration     time.Duration
+	InvitationExpiration        time.Duration
+	RequireEmailVerification    bool   // Reject logins of users who did not verify their email
+	AccountTokenSigningKey      string // Key of the verification and password reset token signatures
+
+	// Brute-force protection of the login. Failures within the window delay the next attempt,
+	// increasingly, and lock the email address or IP for the lockout duration at the maximum.
+	LoginMaxAttempts     int
+	LoginIPMaxAttempts   int
+	LoginAttemptWindow   time.Duration
+	LoginLockoutDuration time.Duration
+	LoginDelayBase       time.Duration
+	LoginMaxDelay        time.Duration
+
+	// Passwords are hashed with Argon2id. Hashes of other parameters, and bcrypt hashes of passwords
+	// set before Argon2id, are replaced with a current one at the next login.
+	PasswordArgon2Memory      uint32 // KiB
+	PasswordArgon2Iterations  uint32
+	PasswordArgon2Parallelism uint8
+
+	// Policy of new passwords, which are also checked against a list of breached passwords
+	PasswordMinLength        int
+	PasswordBreachedListFile string // Added to the built-in list, one password per line
+
+	// Two-factor authentication
+	MFAIssuer              string        // Account name prefix shown in authenticator apps
+	MFAChallengeExpiration time.Duration // Time to enter the code after the password
+
+	// OpenID Connect single sign-on, enabled when an issuer is set
+	OIDCIssuerURL       string
+	OIDCClientID        string
+	OIDCClientSecret    string // Empty for public clients, which rely on PKCE alone
+	OIDCRedirectURL     string // Frontend page that receives the code and posts it to the API
+	OIDCScopes          string
+	OIDCAutoProvision   bool // Create users on their first login
+	OIDCStateExpiration time.Duration
+
+	// Administration API, open to signed in users with a verified email of the list
+	AdminEmails             []string
+	ImpersonationExpiration time.Duration // Lifetime of the access token an admin acts as a user with
 }
 
 func LoadConfig() *Config {
@@ -34,29 +129,168 @@ func LoadConfig() *Config {
 		Port:             getEnv("PORT", "8080"),
 		MongoURI:         getEnv("MONGODB_URI", "mongodb://localhost:27017/contact_enrichment_crm"),
 		DBName:           getEnv("DB_NAME", "contact_enrichment_crm"),
-		JWTSecret:        getEnv("JWT_SECRET", "your-super-secret-jwt-key"),
+		JWTSecret:        getEnv("JWT_SECRET", defaultJWTSecret),
 		EnrichmentAPIURL: getEnv("ENRICHMENT_API_URL", "http://localhost:3001/api/contact-enrichment"),
-		EnrichmentAPIKey: getEnv("ENRICHMENT_API_KEY", "your_secure_api_key_here"),
+		EnrichmentAPIKey: getEnv("ENRICHMENT_API_KEY", defaultEnrichmentAPIKey),
 		CORSOrigins:      []string{getEnv("CORS_ORIGINS", "http://localhost:3000")},
+		DevMode:          getEnv("GIN_MODE", "") == "debug",
+
+		// Access token signing defaults
+		JWTAlgorithm:            getEnv("JWT_ALGORITHM", "HS256"),
+		JWTPrivateKeyFile:       getEnv("JWT_PRIVATE_KEY_FILE", ""),
+		JWTVerificationKeyFiles: parseList("JWT_VERIFICATION_KEY_FILES"),
+		JWTVerificationSecrets:  parseList("JWT_VERIFICATION_SECRETS"),
+		JWTIssuer:               getEnv("JWT_ISSUER", "contact-enrichment-api"),
+		JWTAudience:             getEnv("JWT_AUDIENCE", "contact-enrichment-api"),
 
 		// Default timeout configurations
 		DefaultTimeout:       parseDuration("DEFAULT_TIMEOUT", "30s"),
 		BulkOperationTimeout: parseDuration("BULK_OPERATION_TIMEOUT", "5m"),
 		EnrichmentTimeout:    parseDuration("ENRICHMENT_TIMEOUT", "30s"),
-	}
 
-	// Parse JWT expiration
-	expStr := getEnv("JWT_EXPIRATION", "24h")
-	duration, err := time.ParseDuration(expStr)
-	if err != nil {
-		log.Printf("Invalid JWT_EXPIRATION format, using default 24h: %v", err)
-		duration = 24 * time.Hour
+		// Resumable upload defaults
+		UploadDir:        getEnv("UPLOAD_DIR", "./uploads"),
+		MaxUploadSize:    parseInt64("MAX_UPLOAD_SIZE", 1<<30),
+		UploadExpiration: parseDuration("UPLOAD_EXPIRATION", "24h"),
+
+		BestValueThreshold: int(parseInt64("BEST_VALUE_THRESHOLD", 70)),
+
+		// Background export defaults
+		PublicURL:           strings.TrimSuffix(getEnv("PUBLIC_URL", ""), "/"),
+		ExportDir:           getEnv("EXPORT_DIR", "./exports"),
+		ExportRetentionDays: int(parseInt64("EXPORT_RETENTION_DAYS", 7)),
+		ExportURLExpiration: parseDuration("EXPORT_URL_EXPIRATION", "1h"),
+
+		// Account email defaults, the outbox needs no mail server
+		AppURL:                      strings.TrimSuffix(getEnv("APP_URL", "http://localhost:3000"), "/"),
+		MailDriver:                  getEnv("MAIL_DRIVER", "outbox"),
+		MailFrom:                    getEnv("MAIL_FROM", "no-reply@localhost"),
+		MailOutboxDir:               getEnv("MAIL_OUTBOX_DIR", "./outbox"),
+		SMTPHost:                    getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:                    int(parseInt64("SMTP_PORT", 587)),
+		SMTPUsername:                getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:                getEnv("SMTP_PASSWORD", ""),
+		EmailVerificationExpiration: parseDuration("EMAIL_VERIFICATION_EXPIRATION", "48h"),
+		PasswordResetExpiration:     parseDuration("PASSWORD_RESET_EXPIRATION", "1h"),
+		InvitationExpiration:        parseDuration("INVITATION_EXPIRATION", "168h"),
+		RequireEmailVerification:    parseBool("REQUIRE_EMAIL_VERIFICATION", false),
+
+		// Login throttling defaults
+		LoginMaxAttempts:     int(parseInt64("LOGIN_MAX_ATTEMPTS", 5)),
+		LoginIPMaxAttempts:   int(parseInt64("LOGIN_IP_MAX_ATTEMPTS", 20)),
+		LoginAttemptWindow:   parseDuration("LOGIN_ATTEMPT_WINDOW", "15m"),
+		LoginLockoutDuration: parseDuration("LOGIN_LOCKOUT_DURATION", "15m"),
+		LoginDelayBase:       parseDuration("LOGIN_DELAY_BASE", "1s"),
+		LoginMaxDelay:        parseDuration("LOGIN_MAX_DELAY", "30s"),
+
+		// Password hashing defaults, the second recommended Argon2id option of RFC 9106
+		PasswordArgon2Memory:      uint32(parseInt64("PASSWORD_ARGON2_MEMORY", 64*1024)),
+		PasswordArgon2Iterations:  uint32(parseInt64("PASSWORD_ARGON2_ITERATIONS", 3)),
+		PasswordArgon2Parallelism: uint8(parseInt64("PASSWORD_ARGON2_PARALLELISM", 4)),
+		PasswordMinLength:         int(parseInt64("PASSWORD_MIN_LENGTH", 10)),
+		PasswordBreachedListFile:  getEnv("PASSWORD_BREACHED_LIST_FILE", ""),
+
+		MFAIssuer:              getEnv("MFA_ISSUER", "Contact Enrichment CRM"),
+		MFAChallengeExpiration: parseDuration("MFA_CHALLENGE_EXPIRATION", "5m"),
+
+		// Single sign-on defaults
+		OIDCIssuerURL:       strings.TrimSuffix(getEnv("OIDC_ISSUER_URL", ""), "/"),
+		OIDCClientID:        getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:    getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCScopes:          getEnv("OIDC_SCOPES", "openid email profile"),
+		OIDCAutoProvision:   parseBool("OIDC_AUTO_PROVISION", true),
+		OIDCStateExpiration: parseDuration("OIDC_STATE_EXPIRATION", "10m"),
+
+		// Administration defaults
+		AdminEmails:             parseList("ADMIN_EMAILS"),
+		ImpersonationExpiration: parseDuration("IMPERSONATION_EXPIRATION", "30m"),
 	}
-	config.JWTExpiration = duration
+
+	// Download links and account tokens are signed with keys of their own, derived from the JWT secret unless set
+	config.ExportSigningKey = getEnv("EXPORT_SIGNING_KEY", deriveKey(config.JWTSecret, exportSigningPurpose))
+	config.AccountTokenSigningKey = getEnv("ACCOUNT_TOKEN_SIGNING_KEY", deriveKey(config.JWTSecret, accountTokenPurpose))
+	config.OIDCRedirectURL = getEnv("OIDC_REDIRECT_URL", config.AppURL+"/auth/oidc/callback")
+
+	// Access tokens are short-lived and renewed with a refresh token
+	config.JWTExpiration = parseDuration("JWT_EXPIRATION", "15m")
+	config.RefreshTokenExpiration = parseDuration("REFRESH_TOKEN_EXPIRATION", "720h")
 
 	return config
 }
 
+// Validate refuses configurations the server must not start with, like the default secrets outside dev mode
+func (c *Config) Validate() error {
+	switch c.JWTAlgorithm {
+	case "HS256":
+	case "RS256", "EdDSA":
+		if c.JWTPrivateKeyFile == "" {
+			return fmt.Errorf("JWT_PRIVATE_KEY_FILE is required with JWT_ALGORITHM %s", c.JWTAlgorithm)
+		}
+	default:
+		return fmt.Errorf("unsupported JWT_ALGORITHM %q, use HS256, RS256 or EdDSA", c.JWTAlgorithm)
+	}
+
+	if c.PasswordArgon2Iterations < 1 || c.PasswordArgon2Parallelism < 1 {
+		return errors.New("PASSWORD_ARGON2_ITERATIONS and PASSWORD_ARGON2_PARALLELISM must be at least 1")
+	}
+	if c.PasswordArgon2Memory < 8*uint32(c.PasswordArgon2Parallelism) {
+		return errors.New("PASSWORD_ARGON2_MEMORY must be at least 8 KiB per PASSWORD_ARGON2_PARALLELISM")
+	}
+	if c.PasswordMinLength < 8 {
+		return errors.New("PASSWORD_MIN_LENGTH must be at least 8")
+	}
+
+	if c.DevMode {
+		return nil
+	}
+
+	// The export and account token keys are derived from JWT_SECRET when unset, which is otherwise
+	// unused with RS256 and EdDSA
+	type secret struct{ name, value, defaultValue string }
+	var secrets []secret
+	if c.JWTAlgorithm == "HS256" {
+		secrets = append(secrets, secret{"JWT_SECRET", c.JWTSecret, defaultJWTSecret})
+	}
+	secrets = append(secrets,
+		secret{"EXPORT_SIGNING_KEY", c.ExportSigningKey, deriveKey(defaultJWTSecret, exportSigningPurpose)},
+		secret{"EXPORT_SIGNING_KEY", c.ExportSigningKey, defaultJWTSecret},
+		secret{"ACCOUNT_TOKEN_SIGNING_KEY", c.AccountTokenSigningKey, deriveKey(defaultJWTSecret, accountTokenPurpose)},
+		secret{"ACCOUNT_TOKEN_SIGNING_KEY", c.AccountTokenSigningKey, defaultJWTSecret},
+		secret{"ENRICHMENT_API_KEY", c.EnrichmentAPIKey, defaultEnrichmentAPIKey},
+	)
+	for _, value := range c.JWTVerificationSecrets {
+		secrets = append(secrets, secret{"JWT_VERIFICATION_SECRETS", value, defaultJWTSecret})
+	}
+
+	for _, secret := range secrets {
+		if secret.value == secret.defaultValue {
+			return fmt.Errorf("%s uses the default secret, set your own or GIN_MODE=debug for development", secret.name)
+		}
+	}
+
+	// Tokens of one use must not be accepted as tokens of another
+	if c.ExportSigningKey == c.JWTSecret {
+		return errors.New("EXPORT_SIGNING_KEY must differ from JWT_SECRET")
+	}
+	if c.AccountTokenSigningKey == c.JWTSecret || c.AccountTokenSigningKey == c.ExportSigningKey {
+		return errors.New("ACCOUNT_TOKEN_SIGNING_KEY must differ from JWT_SECRET and EXPORT_SIGNING_KEY")
+	}
+	return nil
+}
+
+// Purposes of the keys derived from JWT_SECRET, so no two uses share a key
+const (
+	exportSigningPurpose = "export-download"
+	accountTokenPurpose  = "account-token"
+)
+
+// deriveKey derives the key of one purpose from a secret, as the hex HMAC-SHA256 of the purpose
+func deriveKey(secret, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -73,3 +307,40 @@ func parseDuration(key, defaultValue string) time.Duration {
 	}
 	return duration
 }
+
+func parseInt64(key string, defaultValue int64) int64 {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseInt(valueStr, 10, 64)
+	if err != nil {
+		log.Printf("Invalid %s format, using default %d: %v", key, defaultValue, err)
+		return defaultValue
+	}
+	return value
+}
+
+// parseList reads a comma-separated list without empty entries
+func parseList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func parseBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		log.Printf("Invalid %s format, using default %t: %v", key, defaultValue, err)
+		return defaultValue
+	}
+	return value
+}
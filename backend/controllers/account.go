@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"contact-enrichment-api/models"
+	"contact-enrichment-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type AccountController struct {
+	accountService *services.AccountService
+	validator      *validator.Validate
+}
+
+func NewAccountController(accountService *services.AccountService) *AccountController {
+	return &AccountController{
+		accountService: accountService,
+		validator:      validator.New(),
+	}
+}
+
+// Change the name or request an email change of the current user
+func (acc *AccountController) UpdateProfile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := acc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := acc.accountService.UpdateProfile(userID.(string), req, c.ClientIP())
+	if err != nil {
+		writeAccountError(c, err)
+		return
+	}
+
+	message := "Profile updated successfully"
+	if user.PendingEmail != "" && req.Email == user.PendingEmail {
+		message = "Profile updated, check your new email address to confirm the change"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"user":    userResponse(user),
+	})
+}
+
+// Confirm an email change with the token sent to the new address
+func (acc *AccountController) ConfirmEmailChange(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := acc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := acc.accountService.ConfirmEmailChange(req.Token)
+	if err != nil {
+		writeAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email address changed successfully",
+		"user":    userResponse(user),
+	})
+}
+
+// Change the password of the current user, other sessions are signed out
+func (acc *AccountController) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := acc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := acc.accountService.ChangePassword(userID.(string), c.GetString("orgID"), req, c.ClientIP())
+	if err != nil {
+		writeAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Password changed successfully, other sessions were signed out",
+		"token":            tokens.Token,
+		"refreshToken":     tokens.RefreshToken,
+		"expiresIn":        tokens.ExpiresIn,
+		"refreshExpiresAt": tokens.RefreshExpiresAt,
+		"organizationId":   tokens.OrganizationID,
+	})
+}
+
+// Deactivate the account of the current user
+func (acc *AccountController) DeactivateAccount(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.ConfirmPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := acc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := acc.accountService.DeactivateAccount(userID.(string), req.Password, c.ClientIP()); err != nil {
+		writeAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deactivated"})
+}
+
+// Delete the account of the current user and their data
+func (acc *AccountController) DeleteAccount(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.ConfirmPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := acc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := acc.accountService.DeleteAccount(userID.(string), req.Password, c.ClientIP()); err != nil {
+		writeAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// writeAccountError maps the errors of account changes to status codes
+func writeAccountError(c *gin.Context, err error) {
+	if writeLoginThrottled(c, err) {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrPasswordRequired), errors.Is(err, services.ErrInvalidAccountToken), errors.Is(err, services.ErrWeakPassword):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrIncorrectPassword):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrEmailTaken), errors.Is(err, services.ErrOwnsSharedOrg):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+func userResponse(user *models.User) models.UserResponse {
+	return models.UserResponse{
+		ID:            user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		IsActive:      user.IsActive,
+		EmailVerified: user.EmailVerified,
+		PendingEmail:  user.PendingEmail,
+		MFAEnabled:    user.MFAEnabled,
+	}
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"contact-enrichment-api/models"
+	"contact-enrichment-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type AdminController struct {
+	adminService *services.AdminService
+	validator    *validator.Validate
+}
+
+func NewAdminController(adminService *services.AdminService) *AdminController {
+	return &AdminController{
+		adminService: adminService,
+		validator:    validator.New(),
+	}
+}
+
+// List users, searched by name or email and filtered by status
+func (adc *AdminController) ListUsers(c *gin.Context) {
+	page, pageSize := adminPagination(c)
+
+	users, err := adc.adminService.ListUsers(page, pageSize, c.Query("search"), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// Get a user with their usage
+func (adc *AdminController) GetUser(c *gin.Context) {
+	user, err := adc.adminService.GetUser(c.Param("id"))
+	if err != nil {
+		c.JSON(adminErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func (adc *AdminController) DeactivateUser(c *gin.Context) {
+	adc.userAction(c, adc.adminService.DeactivateUser, "User deactivated")
+}
+
+func (adc *AdminController) ReactivateUser(c *gin.Context) {
+	adc.userAction(c, adc.adminService.ReactivateUser, "User reactivated")
+}
+
+func (adc *AdminController) ForcePasswordReset(c *gin.Context) {
+	adc.userAction(c, adc.adminService.ForcePasswordReset, "Password reset, the user was emailed a link to choose a new one")
+}
+
+func (adc *AdminController) RevokeSessions(c *gin.Context) {
+	adc.userAction(c, adc.adminService.RevokeSessions, "User signed out of all devices")
+}
+
+// Act as a user, with a short-lived access token. Every request made with it is audited.
+func (adc *AdminController) Impersonate(c *gin.Context) {
+	adminID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := adc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	impersonation, err := adc.adminService.Impersonate(adminID.(string), c.Param("id"), req, c.ClientIP())
+	if err != nil {
+		c.JSON(adminErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, impersonation)
+}
+
+// List the audit log, filtered by admin, target user or action
+func (adc *AdminController) GetAuditLog(c *gin.Context) {
+	page, pageSize := adminPagination(c)
+
+	entries, err := adc.adminService.GetAuditLog(page, pageSize, c.Query("adminId"), c.Query("userId"), c.Query("action"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// userAction runs an audited action on the user of the route, with the reason of the request body
+func (adc *AdminController) userAction(c *gin.Context, action func(adminID, userID, reason, clientIP string) error, message string) {
+	adminID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// The body is optional
+	var req models.AdminActionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := adc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := action(adminID.(string), c.Param("id"), req.Reason, c.ClientIP()); err != nil {
+		c.JSON(adminErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+func adminPagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
+
+// adminErrorStatus maps the errors of the administration API to status codes
+func adminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrOrganizationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrAdminSelfAction), errors.Is(err, services.ErrCannotImpersonateAdmin):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrAccountDeactivated), errors.Is(err, services.ErrAccountDeletionPending):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,7 +1,10 @@
 package controllers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"contact-enrichment-api/models"
 	"contact-enrichment-api/services"
@@ -36,19 +39,25 @@ func (ac *AuthController) Register(c *gin.Context) {
 
 	user, err := ac.authService.Register(req)
 	if err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		status := http.StatusConflict
+		if errors.Is(err, services.ErrWeakPassword) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
 	response := models.UserResponse{
-		ID:       user.ID,
-		Email:    user.Email,
-		Name:     user.Name,
-		IsActive: user.IsActive,
+		ID:            user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		IsActive:      user.IsActive,
+		EmailVerified: user.EmailVerified,
+		MFAEnabled:    user.MFAEnabled,
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User created successfully",
+		"message": "User created successfully, check your email to verify your address",
 		"user":    response,
 	})
 }
@@ -65,26 +74,238 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	loginResponse, err := ac.authService.Login(req)
+	loginResponse, err := ac.authService.Login(req, c.ClientIP())
 	if err != nil {
+		if writeLoginThrottled(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": models.ErrorCodeEmailNotVerified})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	userResponse := models.UserResponse{
-		ID:       loginResponse.User.ID,
-		Email:    loginResponse.User.Email,
-		Name:     loginResponse.User.Name,
-		IsActive: loginResponse.User.IsActive,
+	writeLoginSuccess(c, loginResponse)
+}
+
+// Verify the email address with the token of a verification email
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := ac.authService.VerifyEmail(req.Token)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidAccountToken) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   loginResponse.Token,
-		"user":    userResponse,
+		"message": "Email verified successfully",
+		"user": models.UserResponse{
+			ID:            user.ID,
+			Email:         user.Email,
+			Name:          user.Name,
+			IsActive:      user.IsActive,
+			EmailVerified: user.EmailVerified,
+			MFAEnabled:    user.MFAEnabled,
+		},
 	})
 }
 
+// Send a new verification email. The response is the same whether or not the address has an account.
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	var req models.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.authService.SendVerificationEmail(req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address belongs to an unverified account, a verification email was sent"})
+}
+
+// Email a password reset link. The response is the same whether or not the address has an account.
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.authService.RequestPasswordReset(req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address belongs to an account, a password reset email was sent"})
+}
+
+// Set a new password with the token of a password reset email
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.authService.ResetPassword(req.Token, req.Password); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidAccountToken) || errors.Is(err, services.ErrWeakPassword) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully, sign in with the new password"})
+}
+
+// Exchange a refresh token for a new access token and refresh token
+func (ac *AuthController) Refresh(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := ac.authService.Refresh(req.RefreshToken)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrAccountDeactivated) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Token refreshed",
+		"token":            tokens.Token,
+		"refreshToken":     tokens.RefreshToken,
+		"expiresIn":        tokens.ExpiresIn,
+		"refreshExpiresAt": tokens.RefreshExpiresAt,
+		"organizationId":   tokens.OrganizationID,
+	})
+}
+
+// Issue tokens for another organization of the user
+func (ac *AuthController) SwitchOrganization(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.SwitchOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := ac.authService.SwitchOrganization(userID.(string), req.OrganizationID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrOrganizationNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Organization switched",
+		"token":            tokens.Token,
+		"refreshToken":     tokens.RefreshToken,
+		"expiresIn":        tokens.ExpiresIn,
+		"refreshExpiresAt": tokens.RefreshExpiresAt,
+		"organizationId":   tokens.OrganizationID,
+	})
+}
+
+// Revoke the current access token and, when given, the refresh token of this device
+func (ac *AuthController) Logout(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// The body is optional
+	var req models.LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := ac.authService.Logout(userID.(string), c.GetString("tokenID"), c.GetTime("tokenExpiresAt"), req.RefreshToken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// Revoke every refresh token and access token of the user
+func (ac *AuthController) LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := ac.authService.RevokeAllSessions(userID.(string)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices"})
+}
+
 func (ac *AuthController) GetProfile(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -98,12 +319,68 @@ func (ac *AuthController) GetProfile(c *gin.Context) {
 		return
 	}
 
-	response := models.UserResponse{
-		ID:       user.ID,
-		Email:    user.Email,
-		Name:     user.Name,
-		IsActive: user.IsActive,
+	response := gin.H{
+		"user":                  userResponse(user),
+		"organizationId":        c.GetString("orgID"),
+		"role":                  c.MustGet("orgRole"),
+		"mfaEnrollmentRequired": c.GetBool("mfaEnrollmentRequired"),
+	}
+
+	// Lets the frontend show that an administrator is acting as the user
+	if impersonatorID := c.GetString("impersonatorID"); impersonatorID != "" {
+		response["impersonatedBy"] = impersonatorID
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Publish the public keys access tokens are signed with, for other services to verify them
+func (ac *AuthController) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, ac.authService.JWKS())
+}
+
+// writeLoginSuccess responds with the tokens of a completed login, or the challenge of its second factor
+func writeLoginSuccess(c *gin.Context, loginResponse *models.LoginResponse) {
+	// Users with two-factor authentication get tokens from POST /auth/mfa
+	if loginResponse.MFARequired {
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Two-factor authentication required",
+			"mfaRequired":  true,
+			"mfaToken":     loginResponse.MFAToken,
+			"mfaExpiresIn": loginResponse.MFAExpiresIn,
+		})
+		return
+	}
+
+	userResponse := models.UserResponse{
+		ID:            loginResponse.User.ID,
+		Email:         loginResponse.User.Email,
+		Name:          loginResponse.User.Name,
+		IsActive:      loginResponse.User.IsActive,
+		EmailVerified: loginResponse.User.EmailVerified,
+		MFAEnabled:    loginResponse.User.MFAEnabled,
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Login successful",
+		"token":            loginResponse.Token,
+		"refreshToken":     loginResponse.RefreshToken,
+		"expiresIn":        loginResponse.ExpiresIn,
+		"refreshExpiresAt": loginResponse.RefreshExpiresAt,
+		"organizationId":   loginResponse.OrganizationID,
+		"user":             userResponse,
+	})
+}
+
+// writeLoginThrottled responds with 429 and Retry-After when failed logins throttled the request
+func writeLoginThrottled(c *gin.Context, err error) bool {
+	var throttled *services.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return false
 	}
 
-	c.JSON(http.StatusOK, gin.H{"user": response})
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "code": models.ErrorCodeTooManyAttempts})
+	return true
 }
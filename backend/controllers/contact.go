@@ -1,8 +1,16 @@
 package controllers
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"contact-enrichment-api/models"
 	"contact-enrichment-api/services"
@@ -41,8 +49,11 @@ func (cc *ContactController) CreateContact(c *gin.Context) {
 		return
 	}
 
-	contact, err := cc.contactService.CreateContact(userID.(string), req)
+	contact, err := cc.contactService.CreateContact(c.GetString("orgID"), userID.(string), req)
 	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
 		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
@@ -71,28 +82,36 @@ func (cc *ContactController) BulkCreateContacts(c *gin.Context) {
 		return
 	}
 
-	contacts, errors, err := cc.contactService.BulkCreateContacts(userID.(string), req)
+	result, err := cc.contactService.BulkCreateContacts(c.GetString("orgID"), userID.(string), req)
 	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	response := gin.H{
-		"message":      "Bulk import completed",
-		"totalCreated": len(contacts),
-		"contacts":     contacts,
+		"message":         "Bulk import completed",
+		"importId":        result.ImportID,
+		"totalCreated":    len(result.CreatedContacts),
+		"totalUpdated":    len(result.UpdatedContacts),
+		"totalUnchanged":  len(result.Results) - len(result.CreatedContacts) - len(result.UpdatedContacts),
+		"contacts":        result.CreatedContacts,
+		"updatedContacts": result.UpdatedContacts,
+		"results":         result.Results,
 	}
 
-	if len(errors) > 0 {
-		response["errors"] = errors
-		response["totalErrors"] = len(errors)
+	if len(result.Errors) > 0 {
+		response["errors"] = result.Errors
+		response["totalErrors"] = len(result.Errors)
 	}
 
 	c.JSON(http.StatusCreated, response)
 }
 
 func (cc *ContactController) GetContacts(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	orgID, exists := c.Get("orgID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
@@ -112,7 +131,23 @@ func (cc *ContactController) GetContacts(c *gin.Context) {
 		pageSize = 10
 	}
 
-	contactList, err := cc.contactService.GetContacts(userID.(string), page, pageSize, status, search)
+	view, threshold, err := parseContactView(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if view == contactViewBest {
+		bestValues, err := cc.contactService.GetBestValueContacts(orgID.(string), page, pageSize, status, search, threshold)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, bestValues)
+		return
+	}
+
+	contactList, err := cc.contactService.GetContacts(orgID.(string), page, pageSize, status, search)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -121,8 +156,58 @@ func (cc *ContactController) GetContacts(c *gin.Context) {
 	c.JSON(http.StatusOK, contactList)
 }
 
+// Export the contacts matching the list filters as CSV, XLSX or JSON
+func (cc *ContactController) ExportContacts(c *gin.Context) {
+	orgID, exists := c.Get("orgID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	req := models.ExportContactsRequest{
+		Format: c.DefaultQuery("format", models.ExportFormatCSV),
+		Status: c.Query("status"),
+		Search: c.Query("search"),
+	}
+	if columns := c.Query("columns"); columns != "" {
+		req.Columns = strings.Split(columns, ",")
+	}
+	if threshold := c.Query("threshold"); threshold != "" {
+		value, err := strconv.Atoi(threshold)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be an integer"})
+			return
+		}
+		req.Threshold = &value
+	}
+
+	if err := cc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	export, err := cc.contactService.NewContactExport(orgID.(string), c.GetString("userID"), req)
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("contacts-%s.%s", time.Now().Format("20060102"), export.Format())
+	c.Header("Content-Type", services.ExportContentType(export.Format()))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	if err := export.Write(c.Writer); err != nil {
+		// Headers are already sent, so the error can only be logged
+		log.Printf("Failed to export contacts: %v", err)
+	}
+}
+
 func (cc *ContactController) GetContactByID(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	orgID, exists := c.Get("orgID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
@@ -134,7 +219,23 @@ func (cc *ContactController) GetContactByID(c *gin.Context) {
 		return
 	}
 
-	contact, err := cc.contactService.GetContactByID(userID.(string), contactID)
+	view, threshold, err := parseContactView(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if view == contactViewBest {
+		bestValues, err := cc.contactService.GetBestValueContactByID(orgID.(string), contactID, threshold)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"contact": bestValues})
+		return
+	}
+
+	contact, err := cc.contactService.GetContactByID(orgID.(string), contactID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -156,8 +257,11 @@ func (cc *ContactController) EnrichContact(c *gin.Context) {
 		return
 	}
 
-	contact, err := cc.contactService.EnrichContact(userID.(string), contactID)
+	contact, err := cc.contactService.EnrichContact(c.GetString("orgID"), userID.(string), contactID)
 	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -186,8 +290,11 @@ func (cc *ContactController) BulkEnrichContacts(c *gin.Context) {
 		return
 	}
 
-	err := cc.contactService.BulkEnrichContacts(userID.(string), req.ContactIDs)
+	err := cc.contactService.BulkEnrichContacts(c.GetString("orgID"), userID.(string), req.ContactIDs)
 	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -199,13 +306,13 @@ func (cc *ContactController) BulkEnrichContacts(c *gin.Context) {
 }
 
 func (cc *ContactController) GetContactStats(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	orgID, exists := c.Get("orgID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	stats, err := cc.contactService.GetContactStats(userID.(string))
+	stats, err := cc.contactService.GetContactStats(orgID.(string))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -233,19 +340,155 @@ func (cc *ContactController) EnhancedBulkCreateContacts(c *gin.Context) {
 		return
 	}
 
-	response, err := cc.contactService.EnhancedBulkCreateContacts(userID.(string), req)
+	if err := models.ValidateTransformRules(req.Transforms); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := cc.contactService.EnhancedBulkCreateContacts(c.GetString("orgID"), userID.(string), req)
 	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message":           "Enhanced bulk import completed",
-		"processedContacts": len(response.ProcessedContacts),
-		"skippedContacts":   response.SkippedContacts,
-		"totalErrors":       len(response.Errors),
-		"fieldSummary":      response.FieldSummary,
-		"contacts":          response.ProcessedContacts,
-		"errors":            response.Errors,
+		"message":            "Enhanced bulk import completed",
+		"importId":           response.ImportID,
+		"processedContacts":  len(response.ProcessedContacts),
+		"updatedContacts":    len(response.UpdatedContacts),
+		"unchangedContacts":  response.UnchangedContacts,
+		"skippedContacts":    response.SkippedContacts,
+		"totalErrors":        len(response.Errors),
+		"fieldSummary":       response.FieldSummary,
+		"appliedTemplateId":  response.AppliedTemplateID,
+		"appliedPreset":      response.AppliedPreset,
+		"suggestedTemplates": response.SuggestedTemplates,
+		"contacts":           response.ProcessedContacts,
+		"updated":            response.UpdatedContacts,
+		"results":            response.Results,
+		"errors":             response.Errors,
 	})
 }
+
+// Streaming NDJSON import: one contact per input line, one result per output line
+func (cc *ContactController) StreamCreateContacts(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if contentType := c.ContentType(); contentType != "application/x-ndjson" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/x-ndjson"})
+		return
+	}
+
+	mode := models.ImportMode(c.DefaultQuery("mode", string(models.ImportModeSkip)))
+	if err := cc.validator.Var(string(mode), "oneof=skip overwrite fill-empty merge-custom-fields"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import mode"})
+		return
+	}
+	batchSize, _ := strconv.Atoi(c.DefaultQuery("batchSize", strconv.Itoa(services.DefaultStreamBatchSize)))
+
+	stream, err := cc.contactService.NewImportStream(c.GetString("orgID"), userID.(string), mode, batchSize)
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Results are written while the body is still being read
+	if err := http.NewResponseController(c.Writer).EnableFullDuplex(); err != nil {
+		log.Printf("Full duplex not available for streamed import: %v", err)
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("X-Import-ID", stream.ImportID().Hex())
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	writeResults := func(results []models.StreamImportResult) error {
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+		if len(results) > 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(c.Request.Body)
+	scanner.Buffer(make([]byte, 64*1024), services.MaxStreamLineSize)
+
+	line := 0
+	var streamErr error
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		results, err := stream.AddLine(line, data)
+		if err != nil {
+			streamErr = err
+			break
+		}
+		if err := writeResults(results); err != nil {
+			streamErr = err
+			break
+		}
+	}
+
+	if streamErr == nil && scanner.Err() != nil {
+		// The line that could not be read ends the stream, report it before the remaining results
+		streamErr = scanner.Err()
+		results, err := stream.AddError(line+1, models.ImportErrorInvalidJSON, fmt.Sprintf("Unreadable line: %v", streamErr))
+		if err == nil {
+			err = writeResults(results)
+		}
+		if err != nil {
+			log.Printf("Streamed import %s failed: %v", stream.ImportID().Hex(), err)
+		}
+	}
+
+	results, err := stream.Close(streamErr)
+	if err == nil {
+		err = writeResults(results)
+	}
+	if err != nil {
+		log.Printf("Streamed import %s failed: %v", stream.ImportID().Hex(), err)
+	}
+}
+
+// Contact views selected with the view query parameter
+const (
+	contactViewFull = "full" // The stored contact, the default
+	contactViewBest = "best" // One best value per field, see models.BestValueContact
+)
+
+// parseContactView reads the view and threshold query parameters of the contact endpoints.
+// The threshold is nil when the configured one should be used.
+func parseContactView(c *gin.Context) (string, *int, error) {
+	view := c.DefaultQuery("view", contactViewFull)
+	if view != contactViewFull && view != contactViewBest {
+		return "", nil, errors.New("view must be full or best")
+	}
+
+	thresholdParam := c.Query("threshold")
+	if thresholdParam == "" {
+		return view, nil, nil
+	}
+	threshold, err := strconv.Atoi(thresholdParam)
+	if err != nil || threshold < 0 || threshold > 100 {
+		return "", nil, errors.New("threshold must be an integer between 0 and 100")
+	}
+	return view, &threshold, nil
+}
@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"contact-enrichment-api/models"
+	"contact-enrichment-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type ExportController struct {
+	exportService *services.ExportService
+	validator     *validator.Validate
+}
+
+func NewExportController(exportService *services.ExportService) *ExportController {
+	return &ExportController{
+		exportService: exportService,
+		validator:     validator.New(),
+	}
+}
+
+// Start an export that runs in the background and is downloaded once completed
+func (ec *ExportController) CreateExportJob(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.CreateExportJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ec.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := ec.exportService.CreateExportJob(c.GetString("orgID"), userID.(string), req)
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", "/api/v1/exports/"+job.ID.Hex())
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Export started",
+		"export":  job,
+	})
+}
+
+func (ec *ExportController) GetExportJobs(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Parse query parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+
+	// Validate page and pageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	jobs, err := ec.exportService.GetExportJobs(c.GetString("orgID"), userID.(string), page, pageSize, c.Query("scheduleId"))
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+func (ec *ExportController) GetExportJob(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	job, err := ec.exportService.GetExportJob(c.GetString("orgID"), userID.(string), c.Param("id"))
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"export": job})
+}
+
+func (ec *ExportController) DeleteExportJob(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := ec.exportService.DeleteExportJob(c.GetString("orgID"), userID.(string), c.Param("id")); err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrExportNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Download the file of a completed export. The signed link is the only credential,
+// so it can be handed to tools that cannot authenticate.
+func (ec *ExportController) DownloadExport(c *gin.Context) {
+	job, file, err := ec.exportService.OpenDownload(c.Param("id"), c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrExportLinkInvalid):
+			status = http.StatusForbidden
+		case errors.Is(err, services.ErrExportLinkExpired):
+			status = http.StatusGone
+		case errors.Is(err, services.ErrExportNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrExportNotReady):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", services.ExportContentType(job.Request.Format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, job.Filename))
+	c.Header("Content-Length", strconv.FormatInt(job.Size, 10))
+	c.Status(http.StatusOK)
+
+	if _, err := io.Copy(c.Writer, file); err != nil {
+		log.Printf("Failed to send export %s: %v", job.ID.Hex(), err)
+	}
+}
+
+func (ec *ExportController) CreateSchedule(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.ExportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ec.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule, err := ec.exportService.CreateSchedule(c.GetString("orgID"), userID.(string), req)
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Export schedule created successfully",
+		"schedule": schedule,
+	})
+}
+
+func (ec *ExportController) GetSchedules(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	schedules, err := ec.exportService.GetSchedules(c.GetString("orgID"), userID.(string))
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+func (ec *ExportController) GetSchedule(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	schedule, err := ec.exportService.GetSchedule(c.GetString("orgID"), userID.(string), c.Param("id"))
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedule": schedule})
+}
+
+func (ec *ExportController) UpdateSchedule(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.ExportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ec.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule, err := ec.exportService.UpdateSchedule(c.GetString("orgID"), userID.(string), c.Param("id"), req)
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrScheduleNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Export schedule updated successfully",
+		"schedule": schedule,
+	})
+}
+
+func (ec *ExportController) DeleteSchedule(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := ec.exportService.DeleteSchedule(c.GetString("orgID"), userID.(string), c.Param("id")); err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrScheduleNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Export schedule deleted successfully"})
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"contact-enrichment-api/models"
+	"contact-enrichment-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ImportController struct {
+	importService *services.ImportService
+}
+
+func NewImportController(importService *services.ImportService) *ImportController {
+	return &ImportController{
+		importService: importService,
+	}
+}
+
+func (ic *ImportController) GetImports(c *gin.Context) {
+	orgID, exists := c.Get("orgID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Parse query parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+
+	// Validate page and pageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	imports, err := ic.importService.GetImports(orgID.(string), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, imports)
+}
+
+func (ic *ImportController) GetImportByID(c *gin.Context) {
+	orgID, exists := c.Get("orgID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	batch, err := ic.importService.GetImportByID(orgID.(string), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"import": batch})
+}
+
+func (ic *ImportController) RollbackImport(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result, err := ic.importService.RollbackImport(c.GetString("orgID"), userID.(string), c.Param("id"))
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Import rolled back",
+		"deletedCount":   result.DeletedCount,
+		"modifiedCount":  result.ModifiedCount,
+		"updatedSkipped": result.UpdatedSkipped,
+		"import":         result.Import,
+	})
+}
+
+// List the built-in import presets and the headers that identify them
+func (ic *ImportController) GetImportPresets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"presets": models.ImportPresets})
+}
+
+// Download the failed rows of an import as CSV
+func (ic *ImportController) DownloadErrorReport(c *gin.Context) {
+	orgID, exists := c.Get("orgID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	importID := c.Param("id")
+	if _, err := ic.importService.GetImportByID(orgID.(string), importID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%s-errors.csv"`, importID))
+	c.Status(http.StatusOK)
+
+	if err := ic.importService.WriteErrorReport(orgID.(string), importID, c.Writer); err != nil {
+		// Headers are already sent, so the error can only be logged
+		log.Printf("Failed to write error report for import %s: %v", importID, err)
+	}
+}
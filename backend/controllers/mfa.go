@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"contact-enrichment-api/models"
+	"contact-enrichment-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Complete a login of a user with two-factor authentication
+func (ac *AuthController) CompleteMFALogin(c *gin.Context) {
+	var req models.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loginResponse, err := ac.authService.CompleteMFALogin(req.MFAToken, req.Code, c.ClientIP())
+	if err != nil {
+		if writeLoginThrottled(c, err) {
+			return
+		}
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	writeLoginSuccess(c, loginResponse)
+}
+
+// Start enrolling an authenticator app
+func (ac *AuthController) BeginMFAEnrollment(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	enrollment, err := ac.authService.BeginMFAEnrollment(userID.(string))
+	if err != nil {
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Scan the QR code with an authenticator app, then confirm with a code",
+		"enrollment": enrollment,
+	})
+}
+
+// Enable two-factor authentication with a first code of the authenticator app
+func (ac *AuthController) ConfirmMFAEnrollment(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := ac.authService.ConfirmMFAEnrollment(userID.(string), req.Code)
+	if err != nil {
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Two-factor authentication enabled. Store the recovery codes now, they will not be shown again.",
+		"recoveryCodes": codes,
+	})
+}
+
+func (ac *AuthController) DisableMFA(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.DisableMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := ac.authService.DisableMFA(userID.(string), c.GetString("orgID"), req, c.ClientIP())
+	if err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Two-factor authentication disabled, other sessions were signed out",
+		"token":            tokens.Token,
+		"refreshToken":     tokens.RefreshToken,
+		"expiresIn":        tokens.ExpiresIn,
+		"refreshExpiresAt": tokens.RefreshExpiresAt,
+		"organizationId":   tokens.OrganizationID,
+	})
+}
+
+// Replace the recovery codes, the previous ones stop working
+func (ac *AuthController) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := ac.authService.RegenerateRecoveryCodes(userID.(string), req.Code, c.ClientIP())
+	if err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Recovery codes regenerated. Store them now, they will not be shown again.",
+		"recoveryCodes": codes,
+	})
+}
+
+// writeMFAError responds to the errors of changes that check a code, which are throttled like logins
+func writeMFAError(c *gin.Context, err error) {
+	if writeLoginThrottled(c, err) {
+		return
+	}
+	c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+}
+
+// mfaErrorStatus maps the errors of two-factor authentication to status codes
+func mfaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidMFAToken), errors.Is(err, services.ErrAccountDeactivated):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrInvalidMFACode):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrIncorrectPassword):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrMFAAlreadyEnabled), errors.Is(err, services.ErrMFANotEnabled),
+		errors.Is(err, services.ErrMFAEnrollmentNotStarted), errors.Is(err, services.ErrMFARequiredByOrganization):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"contact-enrichment-api/models"
+	"contact-enrichment-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Start a single sign-on login, the client sends the browser to the returned URL
+func (ac *AuthController) OIDCAuthorize(c *gin.Context) {
+	authorizationURL, err := ac.authService.OIDCAuthorizationURL()
+	if err != nil {
+		c.JSON(oidcErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorizationUrl": authorizationURL})
+}
+
+// Complete a single sign-on login with the code and state the identity provider redirected back with
+func (ac *AuthController) OIDCCallback(c *gin.Context) {
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loginResponse, err := ac.authService.CompleteOIDCLogin(req.Code, req.State)
+	if err != nil {
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": models.ErrorCodeEmailNotVerified})
+			return
+		}
+		c.JSON(oidcErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	writeLoginSuccess(c, loginResponse)
+}
+
+// Start linking a single sign-on account to the signed in user, completed by the link callback
+func (ac *AuthController) OIDCLink(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	authorizationURL, err := ac.authService.OIDCLinkURL(userID.(string))
+	if err != nil {
+		c.JSON(oidcErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorizationUrl": authorizationURL})
+}
+
+// Complete linking a single sign-on account with the code and state the identity provider redirected
+// back with, for the signed in user who started it
+func (ac *AuthController) OIDCLinkCallback(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := ac.authService.CompleteOIDCLink(userID.(string), req.Code, req.State)
+	if err != nil {
+		c.JSON(oidcErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Single sign-on account linked successfully",
+		"user":    userResponse(user),
+	})
+}
+
+// oidcErrorStatus maps the errors of single sign-on to status codes
+func oidcErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrOIDCNotConfigured):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidOIDCState):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrOIDCLoginFailed), errors.Is(err, services.ErrAccountDeactivated):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrOIDCSignupDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrOIDCEmailUnverified), errors.Is(err, services.ErrOIDCAlreadyLinked),
+		errors.Is(err, services.ErrOIDCUserAlreadyLinked):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
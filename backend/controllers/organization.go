@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"contact-enrichment-api/models"
+	"contact-enrichment-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type OrganizationController struct {
+	orgService *services.OrganizationService
+	validator  *validator.Validate
+}
+
+func NewOrganizationController(orgService *services.OrganizationService) *OrganizationController {
+	return &OrganizationController{
+		orgService: orgService,
+		validator:  validator.New(),
+	}
+}
+
+func (oc *OrganizationController) CreateOrganization(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := oc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, err := oc.orgService.CreateOrganization(userID.(string), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Organization created successfully",
+		"organization": org,
+	})
+}
+
+func (oc *OrganizationController) GetOrganizations(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	orgs, err := oc.orgService.GetOrganizations(userID.(string), c.GetString("orgID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"organizations": orgs})
+}
+
+func (oc *OrganizationController) GetOrganization(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	org, err := oc.orgService.GetOrganization(userID.(string), c.Param("id"))
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"organization": org})
+}
+
+func (oc *OrganizationController) UpdateOrganization(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := oc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, err := oc.orgService.UpdateOrganization(userID.(string), c.Param("id"), req)
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Organization updated successfully",
+		"organization": org,
+	})
+}
+
+func (oc *OrganizationController) GetMembers(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	members, err := oc.orgService.GetMembers(userID.(string), c.Param("id"))
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// Invite an email address to the organization. The response does not tell whether an account uses it.
+func (oc *OrganizationController) InviteMember(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.InviteMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := oc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := oc.orgService.InviteMember(userID.(string), c.Param("id"), req)
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Invitation sent",
+		"invitation": invitation,
+	})
+}
+
+func (oc *OrganizationController) GetInvitations(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	invitations, err := oc.orgService.GetInvitations(userID.(string), c.Param("id"))
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+func (oc *OrganizationController) RevokeInvitation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := oc.orgService.RevokeInvitation(userID.(string), c.Param("id"), c.Param("invitationId")); err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
+
+// List the invitations of the current user's verified email address
+func (oc *OrganizationController) GetUserInvitations(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	invitations, err := oc.orgService.GetUserInvitations(userID.(string))
+	if err != nil {
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+func (oc *OrganizationController) AcceptInvitation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	org, err := oc.orgService.AcceptInvitation(userID.(string), c.Param("id"))
+	if err != nil {
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Invitation accepted",
+		"organization": org,
+	})
+}
+
+func (oc *OrganizationController) DeclineInvitation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := oc.orgService.DeclineInvitation(userID.(string), c.Param("id")); err != nil {
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation declined"})
+}
+
+func (oc *OrganizationController) UpdateMember(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := oc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := oc.orgService.UpdateMember(userID.(string), c.Param("id"), c.Param("userId"), req)
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member updated successfully",
+		"member":  member,
+	})
+}
+
+// Remove a member, members can also remove themselves to leave the organization
+func (oc *OrganizationController) RemoveMember(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := oc.orgService.RemoveMember(userID.(string), c.Param("id"), c.Param("userId")); err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		c.JSON(organizationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// writePermissionError responds with 403 when a service denied an action to the role of the user
+func writePermissionError(c *gin.Context, err error) bool {
+	var permissionErr *services.PermissionError
+	if !errors.As(err, &permissionErr) {
+		return false
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":      err.Error(),
+		"code":       models.ErrorCodeInsufficientPermission,
+		"permission": permissionErr.Permission,
+		"role":       permissionErr.Role,
+	})
+	return true
+}
+
+// organizationErrorStatus maps the errors of the organization service to status codes
+func organizationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrOrganizationNotFound), errors.Is(err, services.ErrMemberNotFound),
+		errors.Is(err, services.ErrInvitationNotFound), errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInsufficientRole), errors.Is(err, services.ErrEmailNotVerified):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrAlreadyOrgMember), errors.Is(err, services.ErrLastOwner):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"contact-enrichment-api/models"
+	"contact-enrichment-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// Status returned when a chunk does not match its Upload-Checksum header
+const statusChecksumMismatch = 460
+
+type UploadController struct {
+	uploadService *services.UploadService
+	validator     *validator.Validate
+}
+
+func NewUploadController(uploadService *services.UploadService) *UploadController {
+	return &UploadController{
+		uploadService: uploadService,
+		validator:     validator.New(),
+	}
+}
+
+func (uc *UploadController) CreateUpload(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req models.CreateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := uc.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.ValidateTransformRules(req.Transforms); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := uc.uploadService.CreateUpload(c.GetString("orgID"), userID.(string), req)
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrUploadTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", "/api/v1/uploads/"+session.ID.Hex())
+	c.Header("Upload-Offset", "0")
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Upload created successfully",
+		"upload":  session,
+	})
+}
+
+func (uc *UploadController) GetUpload(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	session, err := uc.uploadService.GetUpload(c.GetString("orgID"), userID.(string), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"upload": session})
+}
+
+// Report how many bytes of an upload were received, used to resume after an interruption
+func (uc *UploadController) GetUploadOffset(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	session, err := uc.uploadService.GetUpload(c.GetString("orgID"), userID.(string), c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	setUploadHeaders(c, session)
+	c.Status(http.StatusOK)
+}
+
+// Append a chunk to an upload at the offset given by the Upload-Offset header
+func (uc *UploadController) UploadChunk(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if contentType := c.ContentType(); contentType != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/offset+octet-stream"})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header must be a non-negative integer"})
+		return
+	}
+
+	checksum, err := parseUploadChecksum(c.GetHeader("Upload-Checksum"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := uc.uploadService.WriteChunk(c.GetString("orgID"), userID.(string), c.Param("id"), offset, c.Request.Body, checksum)
+	if session != nil {
+		setUploadHeaders(c, session)
+	}
+	if err != nil {
+		if writePermissionError(c, err) {
+			return
+		}
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrUploadNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrUploadOffsetMismatch), errors.Is(err, services.ErrUploadClosed), errors.Is(err, services.ErrUploadBusy):
+			status = http.StatusConflict
+		case errors.Is(err, services.ErrUploadExpired):
+			status = http.StatusGone
+		case errors.Is(err, services.ErrUploadTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, services.ErrUploadChecksumMismatch):
+			status = statusChecksumMismatch
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Discard an unfinished upload
+func (uc *UploadController) DeleteUpload(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := uc.uploadService.DeleteUpload(c.GetString("orgID"), userID.(string), c.Param("id")); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrUploadNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrUploadClosed):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func setUploadHeaders(c *gin.Context, session *models.UploadSession) {
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.Size, 10))
+	c.Header("Cache-Control", "no-store")
+}
+
+// parseUploadChecksum reads an Upload-Checksum header of the form "sha256 <base64 digest>"
+func parseUploadChecksum(header string) ([]byte, error) {
+	if header == "" {
+		return nil, nil
+	}
+
+	algorithm, encoded, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(algorithm, "sha256") {
+		return nil, errors.New("Upload-Checksum must use the form \"sha256 <base64 digest>\"")
+	}
+
+	checksum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(checksum) != 32 {
+		return nil, errors.New("Upload-Checksum digest must be a base64 encoded SHA-256 hash")
+	}
+
+	return checksum, nil
+}
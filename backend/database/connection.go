@@ -2,9 +2,11 @@ package database
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -78,24 +80,135 @@ func (d *Database) createIndexes() error {
 		return err
 	}
 
+	// A single sign-on account belongs to one user
+	_, err = usersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "oidcIssuer", Value: 1}, {Key: "oidcSubject", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"oidcSubject": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Refresh tokens are looked up by hash and deleted once expired
+	refreshTokensCollection := d.DB.Collection("refresh_tokens")
+	_, err = refreshTokensCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    map[string]interface{}{"tokenHash": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Index on familyId for revoking a login, and on userId for logging out of all devices
+	_, err = refreshTokensCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: map[string]interface{}{"familyId": 1}},
+		{Keys: map[string]interface{}{"userId": 1}},
+		{Keys: map[string]interface{}{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Revoked access tokens are only kept until they would have expired
+	_, err = d.DB.Collection("revoked_tokens").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    map[string]interface{}{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	// TTL index on expiresAt to drop expired verification and password reset tokens
+	_, err = d.DB.Collection("account_tokens").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: map[string]interface{}{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "purpose", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Pending single sign-on logins are dropped once expired
+	_, err = d.DB.Collection("oidc_states").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    map[string]interface{}{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The audit log is listed newest first, for all users or one
+	_, err = d.DB.Collection("admin_audit_log").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: map[string]interface{}{"created_at": -1}},
+		{Keys: bson.D{{Key: "targetUserId", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Failed login counters are dropped once they no longer limit logins
+	_, err = d.DB.Collection("login_attempts").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    map[string]interface{}{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Unique index on the API key hash for authentication, and on userId for listing keys
+	_, err = d.DB.Collection("api_keys").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: map[string]interface{}{"keyHash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: map[string]interface{}{"userId": 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Organizations have one membership per user, found by organization and by user
+	_, err = d.DB.Collection("memberships").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "orgId", Value: 1}, {Key: "userId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: map[string]interface{}{"userId": 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// One pending invitation per address and organization, found by address, dropped once expired
+	_, err = d.DB.Collection("invitations").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "orgId", Value: 1}, {Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: map[string]interface{}{"email": 1}},
+		{Keys: map[string]interface{}{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
 	// Contacts collection indexes
 	contactsCollection := d.DB.Collection("contacts")
 
-	// Index on userID for fast user-specific queries
-	_, err = contactsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys: map[string]interface{}{"userId": 1},
+	// Index on orgId for fast organization-specific queries, and on userId for finding a user's contacts
+	_, err = contactsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: map[string]interface{}{"orgId": 1}},
+		{Keys: map[string]interface{}{"userId": 1}},
 	})
 	if err != nil {
 		return err
 	}
 
-	// Index on email for duplicate detection
+	// Emails were unique per user before contacts moved to organizations
+	for _, name := range []string{"userId_1_originalContact.email_1", "originalContact.email_1_userId_1"} {
+		if err := dropIndexIfExists(ctx, contactsCollection, name); err != nil {
+			return err
+		}
+	}
+
+	// Index on email for duplicate detection within an organization.
+	// Contacts that were not migrated to an organization yet are left out.
 	_, err = contactsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys: map[string]interface{}{
-			"userId":                1,
-			"originalContact.email": 1,
-		},
-		Options: options.Index().SetUnique(true),
+		Keys: bson.D{{Key: "orgId", Value: 1}, {Key: "originalContact.email", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"orgId": bson.M{"$exists": true}}),
 	})
 	if err != nil {
 		return err
@@ -117,6 +230,89 @@ func (d *Database) createIndexes() error {
 		return err
 	}
 
+	// Index on importId for rolling back an import
+	_, err = contactsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    map[string]interface{}{"importId": 1},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Imports collection indexes
+	importsCollection := d.DB.Collection("imports")
+
+	// Index on orgId and created_at for listing an organization's imports
+	_, err = importsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "orgId", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Uploads collection indexes
+	uploadsCollection := d.DB.Collection("uploads")
+
+	// Index on status and expiresAt for discarding expired uploads
+	_, err = uploadsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "expiresAt", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Exports collection indexes
+	exportsCollection := d.DB.Collection("exports")
+
+	// Index on userID and created_at for listing a user's exports
+	_, err = exportsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Index on expiresAt for deleting expired exports
+	_, err = exportsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: map[string]interface{}{"expiresAt": 1},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Index on enabled and nextRunAt for finding due export schedules
+	_, err = d.DB.Collection("export_schedules").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "enabled", Value: 1}, {Key: "nextRunAt", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Mapping templates collection indexes
+	templatesCollection := d.DB.Collection("mapping_templates")
+
+	// Template names are unique per user
+	_, err = templatesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: map[string]interface{}{
+			"userId": 1,
+			"name":   1,
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
 	log.Println("Database indexes created successfully")
 	return nil
 }
+
+// dropIndexIfExists removes an index that was replaced, doing nothing when it is already gone
+func dropIndexIfExists(ctx context.Context, collection *mongo.Collection, name string) error {
+	_, err := collection.Indexes().DropOne(ctx, name)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == 27 || cmdErr.Code == 26) { // IndexNotFound, NamespaceNotFound
+		return nil
+	}
+	return err
+}
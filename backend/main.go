@@ -2,16 +2,22 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"contact-enrichment-api/config"
 	"contact-enrichment-api/database"
+	"contact-enrichment-api/mailer"
 	"contact-enrichment-api/routes"
 	"contact-enrichment-api/services"
+	"contact-enrichment-api/storage"
 )
 
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
 
 	// Connect to database
 	db, err := database.NewConnection(cfg.MongoURI, cfg.DBName)
@@ -24,12 +30,65 @@ func main() {
 		}
 	}()
 
+	// Storage for uploaded import files
+	uploadStore, err := storage.NewLocalStore(cfg.UploadDir)
+	if err != nil {
+		log.Fatal("Failed to initialize upload storage:", err)
+	}
+
+	// Storage for background export files
+	exportStore, err := storage.NewLocalStore(cfg.ExportDir)
+	if err != nil {
+		log.Fatal("Failed to initialize export storage:", err)
+	}
+
+	// Account emails and invitations go to an SMTP server, or to the outbox directory when none is configured
+	var mail mailer.Mailer
+	switch cfg.MailDriver {
+	case "smtp":
+		mail = mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	case "outbox":
+		if mail, err = mailer.NewOutboxMailer(cfg.MailOutboxDir, cfg.MailFrom); err != nil {
+			log.Fatal("Failed to initialize mail outbox:", err)
+		}
+	default:
+		log.Fatalf("Unknown MAIL_DRIVER %q, use smtp or outbox", cfg.MailDriver)
+	}
+
 	// Initialize services
-	authService := services.NewAuthService(db.DB, cfg)
-	contactService := services.NewContactService(db.DB, cfg)
+	orgService := services.NewOrganizationService(db.DB, cfg, mail)
+	authService := services.NewAuthService(db.DB, cfg, orgService, mail)
+	contactService := services.NewContactService(db.DB, cfg, orgService)
+	templateService := services.NewMappingTemplateService(db.DB, cfg)
+	importService := services.NewImportService(db.DB, cfg, orgService)
+	uploadService := services.NewUploadService(db.DB, cfg, uploadStore, contactService)
+	exportService := services.NewExportService(db.DB, cfg, exportStore, contactService)
+	apiKeyService := services.NewAPIKeyService(db.DB, cfg, authService, orgService)
+	accountService := services.NewAccountService(db.DB, cfg, authService, orgService, uploadService, exportService)
+	adminService := services.NewAdminService(db.DB, cfg, authService, orgService)
+
+	// Move contacts and other data created before organizations into personal organizations
+	if err := orgService.MigrateToOrganizations(); err != nil {
+		log.Fatal("Failed to migrate data to organizations:", err)
+	}
+
+	// Users who registered before email verification keep signing in
+	if err := authService.MigrateEmailVerification(); err != nil {
+		log.Fatal("Failed to migrate email verification:", err)
+	}
+
+	// Discard uploads that were never finished
+	uploadService.StartCleanup(time.Hour)
+
+	// Finish account deletions that failed halfway
+	accountService.StartDeletionSweep(time.Hour)
+
+	// Run scheduled exports and delete expired export files
+	exportService.StartScheduler(time.Minute)
+	exportService.StartCleanup(time.Hour)
 
 	// Setup routes
-	router := routes.SetupRoutes(authService, contactService)
+	router := routes.SetupRoutes(authService, contactService, templateService, importService, uploadService, exportService, apiKeyService, orgService, accountService, adminService)
 
 	// Start server
 	log.Printf("Starting server on port %s", cfg.Port)
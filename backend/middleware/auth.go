@@ -1,16 +1,24 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
+	"contact-enrichment-api/models"
 	"contact-enrichment-api/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
+// AuthMiddleware accepts a JWT or an API key, either as a Bearer token or in the X-API-Key header
+func AuthMiddleware(authService *services.AuthService, apiKeyService *services.APIKeyService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			authenticateAPIKey(c, apiKeyService, key)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -27,9 +35,18 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 		}
 
 		token := parts[1]
-		claims, err := authService.ValidateToken(token)
+		if strings.HasPrefix(token, models.APIKeyPrefix) {
+			authenticateAPIKey(c, apiKeyService, token)
+			return
+		}
+
+		claims, membership, err := authService.Authenticate(token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			message := "Invalid token"
+			if errors.Is(err, services.ErrTokenRevoked) || errors.Is(err, services.ErrAccountDeactivated) || errors.Is(err, services.ErrNotOrgMember) {
+				message = err.Error()
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": message})
 			c.Abort()
 			return
 		}
@@ -37,7 +54,179 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 		// Set user ID in context for use in handlers
 		c.Set("userID", claims.UserID)
 		c.Set("userEmail", claims.Email)
+		setOrganization(c, membership)
+
+		// The token itself, used to revoke it on logout
+		c.Set("tokenID", claims.ID)
+		c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
+		if claims.ImpersonatorID != "" {
+			c.Set("impersonatorID", claims.ImpersonatorID)
+		}
+		c.Next()
+	}
+}
+
+func authenticateAPIKey(c *gin.Context, apiKeyService *services.APIKeyService, key string) {
+	apiKey, membership, err := apiKeyService.Authenticate(key, c.ClientIP())
+	if err != nil {
+		message := "Invalid API key"
+		if errors.Is(err, services.ErrAccountDeactivated) || errors.Is(err, services.ErrNotOrgMember) {
+			message = err.Error()
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+		c.Abort()
+		return
+	}
+
+	c.Set("userID", apiKey.UserID.Hex())
+	c.Set("apiKeyID", apiKey.ID.Hex())
+	c.Set("scopes", apiKey.Scopes)
+	setOrganization(c, membership)
+	c.Next()
+}
+
+// setOrganization stores the active organization, whose data the request works with, and the user's role in it
+func setOrganization(c *gin.Context, membership *models.Membership) {
+	c.Set("orgID", membership.OrgID.Hex())
+	c.Set("orgRole", membership.Role)
+	c.Set("mfaEnrollmentRequired", membership.MFAEnrollmentRequired)
+}
+
+// RequireScope rejects API keys without the given scope. Users signed in with a JWT have every scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if checkScope(c, scope) {
+			c.Next()
+		}
+	}
+}
+
+// RequirePermission rejects members whose role in the active organization lacks the permission
+func RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if checkPermission(c, permission) {
+			c.Next()
+		}
+	}
+}
+
+// Authorize requires both the scope, for API keys, and the permission of the member's role
+func Authorize(scope string, permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if checkScope(c, scope) && checkPermission(c, permission) {
+			c.Next()
+		}
+	}
+}
+
+// checkScope aborts with 403 when the request uses an API key without the scope
+func checkScope(c *gin.Context, scope string) bool {
+	scopes, isAPIKey := c.Get("scopes")
+	if !isAPIKey {
+		return true
+	}
+
+	for _, granted := range scopes.([]string) {
+		if granted == scope {
+			return true
+		}
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error": "API key is missing the " + scope + " scope",
+		"code":  models.ErrorCodeInsufficientScope,
+		"scope": scope,
+	})
+	c.Abort()
+	return false
+}
+
+// checkPermission aborts with 403 when the role set by AuthMiddleware lacks the permission, or when
+// the organization requires two-factor authentication the user has not enabled yet
+func checkPermission(c *gin.Context, permission models.Permission) bool {
+	if c.GetBool("mfaEnrollmentRequired") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "This organization requires two-factor authentication, enable it to continue",
+			"code":  models.ErrorCodeMFAEnrollmentRequired,
+		})
+		c.Abort()
+		return false
+	}
+
+	role, _ := c.Get("orgRole")
+	orgRole, _ := role.(models.OrgRole)
+	if orgRole.Can(permission) {
+		return true
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":      "The " + string(orgRole) + " role does not have the " + string(permission) + " permission",
+		"code":       models.ErrorCodeInsufficientPermission,
+		"permission": permission,
+		"role":       orgRole,
+	})
+	c.Abort()
+	return false
+}
+
+// RequireUserSession rejects API keys, for endpoints that manage the account itself
+func RequireUserSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isAPIKey := c.Get("apiKeyID"); isAPIKey {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "This endpoint cannot be used with an API key",
+				"code":  models.ErrorCodeUserSessionRequired,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin only lets administrators through, see AuthService.IsAdmin
+func RequireAdmin(authService *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := authService.GetUserByID(c.GetString("userID"))
+		if err != nil || !authService.IsAdmin(user) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "This endpoint is only available to administrators",
+				"code":  models.ErrorCodeAdminRequired,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RejectImpersonation keeps administrators who act as a user away from the user's credentials
+func RejectImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonated := c.Get("impersonatorID"); impersonated {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "This endpoint cannot be used while impersonating a user",
+				"code":  models.ErrorCodeImpersonationDenied,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// AuditImpersonation records every request made with an impersonation token in the audit log
+func AuditImpersonation(adminService *services.AdminService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		impersonatorID := c.GetString("impersonatorID")
+		if impersonatorID == "" {
+			c.Next()
+			return
+		}
+
 		c.Next()
+		adminService.RecordImpersonatedRequest(impersonatorID, c.GetString("userID"), c.GetString("tokenID"),
+			c.Request.Method, c.Request.URL.Path, c.Writer.Status(), c.ClientIP())
 	}
 }
 
@@ -45,8 +234,9 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, accept, origin, Cache-Control, X-Requested-With, Upload-Offset, Upload-Checksum")
+		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH, HEAD")
+		c.Header("Access-Control-Expose-Headers", "Content-Disposition, X-Import-ID, Location, Upload-Offset, Upload-Length")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AccountTokenPurpose string
+
+const (
+	AccountTokenEmailVerification AccountTokenPurpose = "email_verification"
+	AccountTokenPasswordReset     AccountTokenPurpose = "password_reset"
+	AccountTokenEmailChange       AccountTokenPurpose = "email_change" // Sent to the new address of an email change
+)
+
+// AccountToken is a single-use token sent by email. The token itself is signed and never stored,
+// the document only records its purpose, expiry and whether it was used.
+type AccountToken struct {
+	ID        primitive.ObjectID  `json:"_id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID  `json:"userId" bson:"userId"`
+	Purpose   AccountTokenPurpose `json:"purpose" bson:"purpose"`
+	Email     string              `json:"email" bson:"email"` // Address the token was sent to
+	ExpiresAt time.Time           `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time          `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
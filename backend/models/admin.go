@@ -0,0 +1,91 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AdminAction string
+
+const (
+	AdminActionDeactivate         AdminAction = "user.deactivate"
+	AdminActionReactivate         AdminAction = "user.reactivate"
+	AdminActionForcePasswordReset AdminAction = "user.force_password_reset"
+	AdminActionRevokeSessions     AdminAction = "user.revoke_sessions"
+	AdminActionImpersonate        AdminAction = "impersonation.start"
+	AdminActionImpersonatedCall   AdminAction = "impersonation.request" // A request made with an impersonation token
+)
+
+// AuditLogEntry records an action of an administrator. Entries are kept when the user is deleted.
+type AuditLogEntry struct {
+	ID           primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	AdminID      primitive.ObjectID `json:"adminId" bson:"adminId"`
+	AdminEmail   string             `json:"adminEmail,omitempty" bson:"adminEmail,omitempty"`
+	Action       AdminAction        `json:"action" bson:"action"`
+	TargetUserID primitive.ObjectID `json:"targetUserId" bson:"targetUserId"`
+	Reason       string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	IPAddress    string             `json:"ipAddress,omitempty" bson:"ipAddress,omitempty"`
+
+	// Impersonation: the token the admin acts with, and each request made with it
+	TokenID    string `json:"tokenId,omitempty" bson:"tokenId,omitempty"`
+	Method     string `json:"method,omitempty" bson:"method,omitempty"`
+	Path       string `json:"path,omitempty" bson:"path,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty" bson:"statusCode,omitempty"`
+
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// UserUsage counts what a user created and how they use the API
+type UserUsage struct {
+	Organizations  int64 `json:"organizations"`
+	Contacts       int64 `json:"contacts"` // Contacts the user created, in any organization
+	Imports        int64 `json:"imports"`
+	Exports        int64 `json:"exports"`
+	ActiveAPIKeys  int64 `json:"activeApiKeys"`
+	ActiveSessions int64 `json:"activeSessions"` // Refresh tokens that can still be used
+}
+
+// AdminUserResponse is a user as administrators see them
+type AdminUserResponse struct {
+	User
+	IsAdmin   bool       `json:"isAdmin"`
+	SSOLinked bool       `json:"ssoLinked"`
+	Contacts  int64      `json:"contacts"`        // Contacts the user created
+	Usage     *UserUsage `json:"usage,omitempty"` // Only on the detail of a user
+}
+
+type AdminUserListResponse struct {
+	Users      []AdminUserResponse `json:"users"`
+	Total      int64               `json:"total"`
+	Page       int                 `json:"page"`
+	PageSize   int                 `json:"pageSize"`
+	TotalPages int                 `json:"totalPages"`
+}
+
+type AuditLogListResponse struct {
+	Entries    []AuditLogEntry `json:"entries"`
+	Total      int64           `json:"total"`
+	Page       int             `json:"page"`
+	PageSize   int             `json:"pageSize"`
+	TotalPages int             `json:"totalPages"`
+}
+
+// AdminActionRequest carries the reason recorded in the audit log
+type AdminActionRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// ImpersonateRequest starts acting as a user. The reason is required for the audit log.
+type ImpersonateRequest struct {
+	Reason         string `json:"reason" validate:"required,min=5,max=500"`
+	OrganizationID string `json:"organizationId,omitempty"` // Defaults to the user's default organization
+}
+
+// ImpersonationResponse is an access token of the user without a refresh token
+type ImpersonationResponse struct {
+	Token          string             `json:"token"`
+	ExpiresIn      int64              `json:"expiresIn"`
+	OrganizationID primitive.ObjectID `json:"organizationId"`
+	User           UserResponse       `json:"user"`
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKeyPrefix starts every API key, so keys can be told apart from JWTs and found by secret scanners
+const APIKeyPrefix = "cek_"
+
+// Scopes an API key can be granted
+const (
+	ScopeContactsRead  = "contacts:read"
+	ScopeContactsWrite = "contacts:write"
+	ScopeEnrich        = "enrich"
+	ScopeExport        = "export"
+)
+
+// APIKeyScopes lists every scope
+var APIKeyScopes = []string{ScopeContactsRead, ScopeContactsWrite, ScopeEnrich, ScopeExport}
+
+type APIKeyType string
+
+const (
+	APIKeyTypePersonal APIKeyType = "personal" // Used by a person's own scripts
+	APIKeyTypeService  APIKeyType = "service"  // Used by an integration rather than a person
+)
+
+// APIKey authenticates scripts and integrations. Only a hash of the key is stored.
+type APIKey struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	OrgID      primitive.ObjectID `json:"organizationId" bson:"orgId"` // Organization the key acts in
+	UserID     primitive.ObjectID `json:"userId" bson:"userId"`
+	Name       string             `json:"name" bson:"name"`
+	Type       APIKeyType         `json:"type" bson:"type"`
+	Prefix     string             `json:"prefix" bson:"prefix"` // Start of the key, to recognize it in lists
+	KeyHash    string             `json:"-" bson:"keyHash"`     // SHA-256 of the key, hex encoded
+	Scopes     []string           `json:"scopes" bson:"scopes"`
+	ExpiresAt  *time.Time         `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	LastUsedAt *time.Time         `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	LastUsedIP string             `json:"lastUsedIp,omitempty" bson:"lastUsedIp,omitempty"`
+	RevokedAt  *time.Time         `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Type      APIKeyType `json:"type,omitempty" validate:"omitempty,oneof=personal service"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=contacts:read contacts:write enrich export"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // Optional, the key never expires without it
+}
+
+// CreateAPIKeyResponse is the only response that contains the key itself
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// IsUsable reports whether the key is neither revoked nor expired
+func (k *APIKey) IsUsable(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// HasScope reports whether the key was granted scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
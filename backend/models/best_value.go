@@ -0,0 +1,138 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Provenance of a best value
+const (
+	ProvenanceEnriched = "enriched" // The enriched value met the confidence threshold
+	ProvenanceOriginal = "original" // The imported value, used when no enriched value is confident enough
+)
+
+// BestValueFields lists the fields resolved by the best value view
+var BestValueFields = []string{"name", "email", "phone", "company", "title", "industry", "location", "department", "bio", "skills"}
+
+// BestValue is the value chosen for one field of a contact
+type BestValue struct {
+	Value      interface{} `json:"value"`
+	Provenance string      `json:"provenance"`
+	Confidence int         `json:"confidence,omitempty"` // Confidence of an enriched value
+	Source     string      `json:"source,omitempty"`     // Enrichment source of an enriched value
+}
+
+// BestValueContact resolves every field of a contact to a single value: the enriched value when its
+// confidence is at or above the threshold, otherwise the original value
+type BestValueContact struct {
+	ID             primitive.ObjectID     `json:"_id"`
+	ImportID       *primitive.ObjectID    `json:"importId,omitempty"`
+	Status         ContactStatus          `json:"status"`
+	Threshold      int                    `json:"threshold"`
+	Fields         map[string]BestValue   `json:"fields"`                   // Fields without any value are left out
+	SocialProfiles map[string]BestValue   `json:"socialProfiles,omitempty"` // Enriched profiles meeting the threshold
+	CustomFields   map[string]interface{} `json:"customFields,omitempty"`   // Imported custom fields, never enriched
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at"`
+	EnrichedAt     *time.Time             `json:"enriched_at,omitempty"`
+}
+
+type BestValueListResponse struct {
+	Contacts   []BestValueContact `json:"contacts"`
+	Threshold  int                `json:"threshold"`
+	Total      int64              `json:"total"`
+	Page       int                `json:"page"`
+	PageSize   int                `json:"pageSize"`
+	TotalPages int                `json:"totalPages"`
+}
+
+// BestValues returns the best value view of the contact for a confidence threshold
+func (c *Contact) BestValues(threshold int) BestValueContact {
+	view := BestValueContact{
+		ID:           c.ID,
+		ImportID:     c.ImportID,
+		Status:       c.Status,
+		Threshold:    threshold,
+		Fields:       make(map[string]BestValue),
+		CustomFields: c.OriginalContact.CustomFields,
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+		EnrichedAt:   c.EnrichedAt,
+	}
+
+	for _, field := range BestValueFields {
+		if value, found := c.BestValue(field, threshold); found {
+			view.Fields[field] = value
+		}
+	}
+
+	if c.EnrichedContact != nil {
+		for network := range c.EnrichedContact.SocialProfiles {
+			if value, found := c.BestSocialProfile(network, threshold); found {
+				if view.SocialProfiles == nil {
+					view.SocialProfiles = make(map[string]BestValue)
+				}
+				view.SocialProfiles[network] = value
+			}
+		}
+	}
+
+	return view
+}
+
+// BestValue resolves one of BestValueFields, found is false when neither value is set
+func (c *Contact) BestValue(field string, threshold int) (value BestValue, found bool) {
+	if c.EnrichedContact != nil {
+		enriched := c.EnrichedContact.bestValue(field)
+		confidence := 0
+		if c.ConfidenceScores != nil {
+			confidence = c.ConfidenceScores.fieldScore(field)
+		}
+		if enriched != nil && confidence >= threshold {
+			value = BestValue{Value: enriched, Provenance: ProvenanceEnriched, Confidence: confidence}
+			if c.Sources != nil {
+				value.Source = c.Sources.source(field)
+			}
+			return value, true
+		}
+	}
+
+	if original := c.OriginalContact.fieldValue(field); original != "" {
+		return BestValue{Value: original, Provenance: ProvenanceOriginal}, true
+	}
+	return BestValue{}, false
+}
+
+// BestSocialProfile returns an enriched social profile when its confidence meets the threshold.
+// Profiles are never imported, so there is no original value to fall back to.
+func (c *Contact) BestSocialProfile(network string, threshold int) (value BestValue, found bool) {
+	if c.EnrichedContact == nil || c.EnrichedContact.SocialProfiles[network] == "" {
+		return BestValue{}, false
+	}
+
+	confidence := 0
+	if c.ConfidenceScores != nil {
+		confidence = c.ConfidenceScores.SocialProfiles[network]
+	}
+	if confidence < threshold {
+		return BestValue{}, false
+	}
+
+	value = BestValue{Value: c.EnrichedContact.SocialProfiles[network], Provenance: ProvenanceEnriched, Confidence: confidence}
+	if c.Sources != nil {
+		value.Source = c.Sources.SocialProfiles
+	}
+	return value, true
+}
+
+// bestValue returns an enriched field, nil when it is empty. Skills keep their list form.
+func (ec *EnrichedContact) bestValue(field string) interface{} {
+	if field == "skills" {
+		if len(ec.Skills) == 0 {
+			return nil
+		}
+		return ec.Skills
+	}
+	return ec.exportValue(field)
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -77,17 +78,19 @@ type EnrichmentSummary struct {
 }
 
 type Contact struct {
-	ID                primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
-	UserID            primitive.ObjectID `json:"userId" bson:"userId"`
-	Status            ContactStatus      `json:"status" bson:"status"`
-	OriginalContact   OriginalContact    `json:"originalContact" bson:"originalContact"`
-	EnrichedContact   *EnrichedContact   `json:"enrichedContact,omitempty" bson:"enrichedContact,omitempty"`
-	ConfidenceScores  *ConfidenceScores  `json:"confidenceScores,omitempty" bson:"confidenceScores,omitempty"`
-	Sources           *Sources           `json:"sources,omitempty" bson:"sources,omitempty"`
-	EnrichmentSummary *EnrichmentSummary `json:"enrichmentSummary,omitempty" bson:"enrichmentSummary,omitempty"`
-	CreatedAt         time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt         time.Time          `json:"updated_at" bson:"updated_at"`
-	EnrichedAt        *time.Time         `json:"enriched_at,omitempty" bson:"enriched_at,omitempty"`
+	ID                primitive.ObjectID  `json:"_id" bson:"_id,omitempty"`
+	OrgID             primitive.ObjectID  `json:"organizationId" bson:"orgId"`                  // Organization that owns the contact
+	UserID            primitive.ObjectID  `json:"userId" bson:"userId"`                         // User who created the contact
+	ImportID          *primitive.ObjectID `json:"importId,omitempty" bson:"importId,omitempty"` // Bulk import that created the contact
+	Status            ContactStatus       `json:"status" bson:"status"`
+	OriginalContact   OriginalContact     `json:"originalContact" bson:"originalContact"`
+	EnrichedContact   *EnrichedContact    `json:"enrichedContact,omitempty" bson:"enrichedContact,omitempty"`
+	ConfidenceScores  *ConfidenceScores   `json:"confidenceScores,omitempty" bson:"confidenceScores,omitempty"`
+	Sources           *Sources            `json:"sources,omitempty" bson:"sources,omitempty"`
+	EnrichmentSummary *EnrichmentSummary  `json:"enrichmentSummary,omitempty" bson:"enrichmentSummary,omitempty"`
+	CreatedAt         time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt         time.Time           `json:"updated_at" bson:"updated_at"`
+	EnrichedAt        *time.Time          `json:"enriched_at,omitempty" bson:"enriched_at,omitempty"`
 }
 
 // Request/Response models for API
@@ -96,22 +99,72 @@ type CreateContactRequest struct {
 	OriginalContact OriginalContact `json:"originalContact" validate:"required"`
 }
 
+// ImportMode controls what happens when an imported row matches an existing contact by email
+type ImportMode string
+
+const (
+	ImportModeSkip              ImportMode = "skip"                // Leave the existing contact untouched and report the row
+	ImportModeOverwrite         ImportMode = "overwrite"           // Replace existing values with every non-empty imported value
+	ImportModeFillEmpty         ImportMode = "fill-empty"          // Only fill fields that are blank on the existing contact
+	ImportModeMergeCustomFields ImportMode = "merge-custom-fields" // Only merge imported custom fields into the existing contact
+)
+
+// ImportAction describes what an import did with a single contact
+type ImportAction string
+
+const (
+	ImportActionCreated   ImportAction = "created"
+	ImportActionUpdated   ImportAction = "updated"
+	ImportActionUnchanged ImportAction = "unchanged"
+)
+
 type BulkCreateContactRequest struct {
 	Contacts []OriginalContact `json:"contacts" validate:"required,dive"`
+	Mode     ImportMode        `json:"mode,omitempty" validate:"omitempty,oneof=skip overwrite fill-empty merge-custom-fields"`
+}
+
+// Response for bulk import
+type BulkImportResponse struct {
+	ImportID        primitive.ObjectID    `json:"importId"`
+	CreatedContacts []Contact             `json:"createdContacts"`
+	UpdatedContacts []Contact             `json:"updatedContacts"`
+	Results         []ImportContactResult `json:"results"`
+	Errors          []ImportError         `json:"errors"`
+}
+
+// Outcome of a single imported row that matched or created a contact
+type ImportContactResult struct {
+	Row           int                `json:"row"`
+	ContactID     primitive.ObjectID `json:"contactId"`
+	Email         string             `json:"email"`
+	Action        ImportAction       `json:"action"`
+	ChangedFields []string           `json:"changedFields,omitempty"`
 }
 
 // Enhanced bulk import request with field mapping
 type EnhancedBulkCreateContactRequest struct {
 	Contacts     []map[string]interface{} `json:"contacts" validate:"required"`
 	FieldMapping map[string]string        `json:"fieldMapping,omitempty"` // Optional manual field mapping
+	TemplateID   string                   `json:"templateId,omitempty"`   // Optional saved mapping template, overridden by FieldMapping
+	Transforms   []TransformRule          `json:"transforms,omitempty"`   // Optional rules applied to raw columns before mapping
+	Preset       string                   `json:"preset,omitempty" validate:"omitempty,oneof=auto none linkedin google outlook"`
+	Mode         ImportMode               `json:"mode,omitempty" validate:"omitempty,oneof=skip overwrite fill-empty merge-custom-fields"`
 }
 
 // Response for enhanced bulk import with field detection
 type EnhancedBulkImportResponse struct {
-	ProcessedContacts []Contact    `json:"processedContacts"`
-	Errors            []string     `json:"errors"`
-	FieldSummary      FieldSummary `json:"fieldSummary"`
-	SkippedContacts   int          `json:"skippedContacts"`
+	ImportID          primitive.ObjectID    `json:"importId"`
+	ProcessedContacts []Contact             `json:"processedContacts"`
+	UpdatedContacts   []Contact             `json:"updatedContacts"`
+	Results           []ImportContactResult `json:"results"`
+	Errors            []ImportError         `json:"errors"`
+	FieldSummary      FieldSummary          `json:"fieldSummary"`
+	SkippedContacts   int                   `json:"skippedContacts"`
+	UnchangedContacts int                   `json:"unchangedContacts"`
+
+	AppliedTemplateID  *primitive.ObjectID    `json:"appliedTemplateId,omitempty"`
+	AppliedPreset      string                 `json:"appliedPreset,omitempty"` // Built-in preset used to map the import
+	SuggestedTemplates []MappingTemplateMatch `json:"suggestedTemplates"`      // Saved templates matching the detected fields
 }
 
 // Summary of fields detected and processed
@@ -119,9 +172,13 @@ type FieldSummary struct {
 	DetectedFields    []string          `json:"detectedFields"` // All fields found in the import
 	StandardFields    []string          `json:"standardFields"` // Fields mapped to standard schema
 	CustomFields      []string          `json:"customFields"`   // Fields stored as custom fields
+	IgnoredFields     []string          `json:"ignoredFields"`  // Fields mapped to "" and dropped
 	FieldMappings     map[string]string `json:"fieldMappings"`  // How fields were mapped
 	TotalContacts     int               `json:"totalContacts"`
 	ProcessedContacts int               `json:"processedContacts"`
+
+	// Confidence and considered alternatives for every mapped field
+	Suggestions []FieldMappingSuggestion `json:"suggestions"`
 }
 
 type EnrichContactRequest struct {
@@ -157,54 +214,18 @@ type ExternalEnrichmentResponse struct {
 	EnrichmentSummary EnrichmentSummary `json:"enrichmentSummary"`
 }
 
-// Field mapping utilities for dynamic imports
-var StandardFieldMappings = map[string]string{
-	"name":          "name",
-	"full name":     "name",
-	"fullname":      "name",
-	"email":         "email",
-	"email address": "email",
-	"e-mail":        "email",
-	"phone":         "phone",
-	"phone number":  "phone",
-	"mobile":        "phone",
-	"company":       "company",
-	"organization":  "company",
-	"employer":      "company",
-	"title":         "title",
-	"job title":     "title",
-	"position":      "title",
-	"role":          "title",
-	"industry":      "industry",
-	"sector":        "industry",
-	"location":      "location",
-	"city":          "location",
-	"address":       "location",
-	"department":    "department",
-	"dept":          "department",
-	"division":      "department",
-}
-
 // Helper function to normalize field names
 func NormalizeFieldName(fieldName string) string {
 	if fieldName == "" {
 		return ""
 	}
 
-	// Convert to lowercase and trim spaces
-	normalized := strings.ToLower(strings.TrimSpace(fieldName))
-
-	// Remove common punctuation
-	normalized = strings.ReplaceAll(normalized, "_", " ")
-	normalized = strings.ReplaceAll(normalized, "-", " ")
-	normalized = strings.ReplaceAll(normalized, ".", " ")
-
-	// Check if we have a standard mapping
-	if standardField, exists := StandardFieldMappings[normalized]; exists {
-		return standardField
+	// Map to a standard field when the header is a confident match
+	if candidates := scoreHeader(fieldName); len(candidates) > 0 && candidates[0].Confidence >= MinMappingConfidence {
+		return candidates[0].Field
 	}
 
-	return normalized
+	return customFieldName(fieldName)
 }
 
 // Helper function to set field value on OriginalContact
@@ -213,6 +234,18 @@ func (oc *OriginalContact) SetFieldValue(fieldName string, value interface{}) {
 		return
 	}
 
+	// Custom fields keep typed values, e.g. numbers, booleans and dates produced by transform rules
+	if !IsStandardField(fieldName) {
+		switch value.(type) {
+		case bool, int, int64, float64, time.Time:
+			if oc.CustomFields == nil {
+				oc.CustomFields = make(map[string]interface{})
+			}
+			oc.CustomFields[fieldName] = value
+			return
+		}
+	}
+
 	strValue := fmt.Sprintf("%v", value)
 	strValue = strings.TrimSpace(strValue)
 
@@ -245,3 +278,66 @@ func (oc *OriginalContact) SetFieldValue(fieldName string, value interface{}) {
 		oc.CustomFields[fieldName] = strValue
 	}
 }
+
+// MergeFrom applies the values of an imported contact onto an existing one according
+// to the import mode and returns the names of the fields that changed.
+// The email is the match key and is never changed.
+func (oc *OriginalContact) MergeFrom(incoming OriginalContact, mode ImportMode) []string {
+	var changed []string
+
+	if mode == ImportModeOverwrite || mode == ImportModeFillEmpty {
+		standardFields := []struct {
+			name     string
+			existing *string
+			value    string
+		}{
+			{"name", &oc.Name, incoming.Name},
+			{"phone", &oc.Phone, incoming.Phone},
+			{"company", &oc.Company, incoming.Company},
+			{"title", &oc.Title, incoming.Title},
+			{"industry", &oc.Industry, incoming.Industry},
+			{"location", &oc.Location, incoming.Location},
+			{"department", &oc.Department, incoming.Department},
+		}
+
+		for _, field := range standardFields {
+			if field.value == "" || field.value == *field.existing {
+				continue
+			}
+			if mode == ImportModeFillEmpty && *field.existing != "" {
+				continue
+			}
+			*field.existing = field.value
+			changed = append(changed, field.name)
+		}
+	}
+
+	if mode == ImportModeSkip || len(incoming.CustomFields) == 0 {
+		return changed
+	}
+
+	// Sort keys so changed fields are reported in a stable order
+	keys := make([]string, 0, len(incoming.CustomFields))
+	for key := range incoming.CustomFields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := incoming.CustomFields[key]
+		existing, exists := oc.CustomFields[key]
+		if exists && fmt.Sprintf("%v", existing) == fmt.Sprintf("%v", value) {
+			continue
+		}
+		if exists && mode == ImportModeFillEmpty && fmt.Sprintf("%v", existing) != "" {
+			continue
+		}
+		if oc.CustomFields == nil {
+			oc.CustomFields = make(map[string]interface{})
+		}
+		oc.CustomFields[key] = value
+		changed = append(changed, "customFields."+key)
+	}
+
+	return changed
+}
@@ -0,0 +1,354 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// File formats a contact export can be written in
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+	ExportFormatJSON = "json"
+)
+
+// ExportTimeFormat is the layout of dates in CSV and XLSX exports
+const ExportTimeFormat = time.RFC3339
+
+// Prefixes of the export columns holding one value per map key, e.g. "original.customFields.budget"
+const (
+	ExportCustomFieldsPrefix             = "original.customFields."
+	ExportSocialProfilesPrefix           = "enriched.socialProfiles."
+	ExportSocialProfileConfidencesPrefix = "confidence.socialProfiles."
+	ExportBestSocialProfilesPrefix       = "best.socialProfiles."
+)
+
+// Suffix of the best value columns naming the provenance of the value, e.g. "best.title.provenance"
+const ExportProvenanceSuffix = ".provenance"
+
+// ExportColumns lists the columns of a contact export in their default order.
+// Columns ending in ".*" expand to one column per key found in the exported contacts.
+var ExportColumns = []string{
+	"id", "status", "importId", "created_at", "updated_at", "enriched_at",
+
+	"original.name", "original.email", "original.phone", "original.company", "original.title",
+	"original.industry", "original.location", "original.department", ExportCustomFieldsPrefix + "*",
+
+	"enriched.name", "enriched.email", "enriched.title", "enriched.company", "enriched.location",
+	"enriched.industry", "enriched.bio", "enriched.skills", ExportSocialProfilesPrefix + "*", "enriched.experience",
+
+	"confidence.overall", "confidence.name", "confidence.email", "confidence.title", "confidence.company",
+	"confidence.location", "confidence.industry", "confidence.bio", "confidence.skills", ExportSocialProfileConfidencesPrefix + "*",
+
+	"sources.name", "sources.email", "sources.title", "sources.company", "sources.location",
+	"sources.industry", "sources.bio", "sources.skills", "sources.socialProfiles",
+}
+
+// BestValueExportColumns lists the columns of the best value view. They are not exported by default
+// and are selected by name or with the "best" group.
+var BestValueExportColumns = bestValueExportColumns()
+
+func bestValueExportColumns() []string {
+	var columns []string
+	for _, field := range BestValueFields {
+		columns = append(columns, "best."+field, "best."+field+ExportProvenanceSuffix)
+	}
+	return append(columns, ExportBestSocialProfilesPrefix+"*")
+}
+
+// Column groups that can be requested by name, e.g. "enriched" for every enriched column
+var exportColumnGroups = []string{"original", "enriched", "confidence", "sources", "best"}
+
+// ExportContactsRequest selects the contacts and columns of an export
+type ExportContactsRequest struct {
+	Format  string   `json:"format" bson:"format" validate:"omitempty,oneof=csv xlsx json"`
+	Columns []string `json:"columns,omitempty" bson:"columns,omitempty"` // Columns, wildcards or group names, defaults to ExportColumns
+	Status  string   `json:"status,omitempty" bson:"status,omitempty"`   // Same filters as the contact list
+	Search  string   `json:"search,omitempty" bson:"search,omitempty"`
+
+	// Confidence an enriched value needs to be used by the best value columns, defaults to the configured threshold
+	Threshold *int `json:"threshold,omitempty" bson:"threshold,omitempty" validate:"omitempty,min=0,max=100"`
+}
+
+// ExpandExportColumns resolves requested columns to concrete columns. Group names expand to their
+// columns, and wildcards to one column per key in dynamicKeys, which holds the keys found per prefix.
+func ExpandExportColumns(requested []string, dynamicKeys map[string][]string) ([]string, error) {
+	if len(requested) == 0 {
+		requested = ExportColumns
+	}
+
+	var columns []string
+	seen := make(map[string]bool)
+	add := func(column string) {
+		if !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+
+	// Expand group names first, they may contain wildcards
+	var expanded []string
+	for _, column := range requested {
+		column = strings.TrimSpace(column)
+		if !isExportColumnGroup(column) {
+			expanded = append(expanded, column)
+			continue
+		}
+		for _, groupColumn := range allExportColumns() {
+			if strings.HasPrefix(groupColumn, column+".") {
+				expanded = append(expanded, groupColumn)
+			}
+		}
+	}
+
+	for _, column := range expanded {
+		if prefix, isWildcard := strings.CutSuffix(column, "*"); isWildcard && isExportDynamicPrefix(prefix) {
+			for _, key := range dynamicKeys[prefix] {
+				add(prefix + key)
+			}
+			continue
+		}
+
+		if !IsExportColumn(column) {
+			return nil, fmt.Errorf("unknown export column %q", column)
+		}
+		add(column)
+	}
+
+	return columns, nil
+}
+
+// IsExportColumn reports whether column is a concrete export column
+func IsExportColumn(column string) bool {
+	for _, prefix := range exportDynamicPrefixes {
+		if key, found := strings.CutPrefix(column, prefix); found {
+			return key != "" && key != "*"
+		}
+	}
+	for _, known := range allExportColumns() {
+		if column == known {
+			return true
+		}
+	}
+	return false
+}
+
+func isExportColumnGroup(column string) bool {
+	for _, group := range exportColumnGroups {
+		if column == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Prefixes of the columns holding one value per map key
+var exportDynamicPrefixes = []string{ExportCustomFieldsPrefix, ExportSocialProfilesPrefix, ExportSocialProfileConfidencesPrefix, ExportBestSocialProfilesPrefix}
+
+func isExportDynamicPrefix(prefix string) bool {
+	for _, dynamic := range exportDynamicPrefixes {
+		if prefix == dynamic {
+			return true
+		}
+	}
+	return false
+}
+
+func allExportColumns() []string {
+	columns := make([]string, 0, len(ExportColumns)+len(BestValueExportColumns))
+	return append(append(columns, ExportColumns...), BestValueExportColumns...)
+}
+
+// ExportValue returns the value of a concrete export column, nil when the contact has none.
+// The best value columns use enriched values whose confidence is at or above threshold.
+func (c *Contact) ExportValue(column string, threshold int) interface{} {
+	if key, found := strings.CutPrefix(column, ExportCustomFieldsPrefix); found {
+		return c.OriginalContact.CustomFields[key]
+	}
+	if key, found := strings.CutPrefix(column, ExportSocialProfilesPrefix); found {
+		if c.EnrichedContact == nil {
+			return nil
+		}
+		return emptyToNil(c.EnrichedContact.SocialProfiles[key])
+	}
+	if key, found := strings.CutPrefix(column, ExportSocialProfileConfidencesPrefix); found {
+		if c.ConfidenceScores == nil {
+			return nil
+		}
+		if score, exists := c.ConfidenceScores.SocialProfiles[key]; exists {
+			return score
+		}
+		return nil
+	}
+	if key, found := strings.CutPrefix(column, ExportBestSocialProfilesPrefix); found {
+		if value, found := c.BestSocialProfile(key, threshold); found {
+			return value.Value
+		}
+		return nil
+	}
+
+	group, field, _ := strings.Cut(column, ".")
+	switch group {
+	case "id":
+		return c.ID.Hex()
+	case "status":
+		return string(c.Status)
+	case "importId":
+		if c.ImportID == nil {
+			return nil
+		}
+		return c.ImportID.Hex()
+	case "created_at":
+		return c.CreatedAt
+	case "updated_at":
+		return c.UpdatedAt
+	case "enriched_at":
+		if c.EnrichedAt == nil {
+			return nil
+		}
+		return *c.EnrichedAt
+	case "original":
+		return emptyToNil(c.OriginalContact.fieldValue(field))
+	case "enriched":
+		if c.EnrichedContact == nil {
+			return nil
+		}
+		return c.EnrichedContact.exportValue(field)
+	case "confidence":
+		if field == "overall" {
+			if c.EnrichmentSummary == nil {
+				return nil
+			}
+			return c.EnrichmentSummary.OverallConfidence
+		}
+		if c.ConfidenceScores == nil {
+			return nil
+		}
+		return c.ConfidenceScores.score(field)
+	case "sources":
+		if c.Sources == nil {
+			return nil
+		}
+		return emptyToNil(c.Sources.source(field))
+	case "best":
+		field, provenance := strings.CutSuffix(field, ExportProvenanceSuffix)
+		value, found := c.BestValue(field, threshold)
+		if !found {
+			return nil
+		}
+		if provenance {
+			return value.Provenance
+		}
+		if skills, isList := value.Value.([]string); isList {
+			return strings.Join(skills, "; ")
+		}
+		return value.Value
+	}
+
+	return nil
+}
+
+// fieldValue returns a standard field by name
+func (oc *OriginalContact) fieldValue(field string) string {
+	switch field {
+	case "name":
+		return oc.Name
+	case "email":
+		return oc.Email
+	case "phone":
+		return oc.Phone
+	case "company":
+		return oc.Company
+	case "title":
+		return oc.Title
+	case "industry":
+		return oc.Industry
+	case "location":
+		return oc.Location
+	case "department":
+		return oc.Department
+	}
+	return ""
+}
+
+func (ec *EnrichedContact) exportValue(field string) interface{} {
+	switch field {
+	case "name":
+		return emptyToNil(ec.Name)
+	case "email":
+		return emptyToNil(ec.Email)
+	case "title":
+		return emptyToNil(ec.Title)
+	case "company":
+		return emptyToNil(ec.Company)
+	case "location":
+		return emptyToNil(ec.Location)
+	case "industry":
+		return emptyToNil(ec.Industry)
+	case "bio":
+		return emptyToNil(ec.Bio)
+	case "skills":
+		return emptyToNil(strings.Join(ec.Skills, "; "))
+	case "experience":
+		if len(ec.Experience) == 0 {
+			return nil
+		}
+		return ec.Experience
+	}
+	return nil
+}
+
+// score returns the confidence of a field, nil when the field was not scored
+func (cs *ConfidenceScores) score(field string) interface{} {
+	if score := cs.fieldScore(field); score > 0 {
+		return score
+	}
+	return nil
+}
+
+// fieldScore returns the confidence of a field, 0 when the field was not scored
+func (cs *ConfidenceScores) fieldScore(field string) int {
+	scores := map[string]int{
+		"name":     cs.Name,
+		"email":    cs.Email,
+		"title":    cs.Title,
+		"company":  cs.Company,
+		"location": cs.Location,
+		"industry": cs.Industry,
+		"bio":      cs.Bio,
+		"skills":   cs.Skills,
+	}
+	return scores[field]
+}
+
+func (s *Sources) source(field string) string {
+	switch field {
+	case "name":
+		return s.Name
+	case "email":
+		return s.Email
+	case "title":
+		return s.Title
+	case "company":
+		return s.Company
+	case "location":
+		return s.Location
+	case "industry":
+		return s.Industry
+	case "bio":
+		return s.Bio
+	case "skills":
+		return s.Skills
+	case "socialProfiles":
+		return s.SocialProfiles
+	}
+	return ""
+}
+
+func emptyToNil(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
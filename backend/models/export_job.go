@@ -0,0 +1,124 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ExportJobStatus string
+
+const (
+	ExportJobStatusPending   ExportJobStatus = "pending"
+	ExportJobStatusRunning   ExportJobStatus = "running"
+	ExportJobStatusCompleted ExportJobStatus = "completed"
+	ExportJobStatusFailed    ExportJobStatus = "failed"
+)
+
+// ExportJob is an export written to the blob store in the background
+type ExportJob struct {
+	ID         primitive.ObjectID    `json:"_id" bson:"_id,omitempty"`
+	OrgID      primitive.ObjectID    `json:"organizationId" bson:"orgId"` // Organization whose contacts are exported
+	UserID     primitive.ObjectID    `json:"userId" bson:"userId"`
+	ScheduleID *primitive.ObjectID   `json:"scheduleId,omitempty" bson:"scheduleId,omitempty"` // Schedule that started the job
+	Status     ExportJobStatus       `json:"status" bson:"status"`
+	Request    ExportContactsRequest `json:"request" bson:"request"`
+	Filename   string                `json:"filename" bson:"filename"`
+	Rows       int                   `json:"rows" bson:"rows"`
+	Size       int64                 `json:"size" bson:"size"` // File size in bytes
+	Error      string                `json:"error,omitempty" bson:"error,omitempty"`
+
+	// Renewed while the job runs, a job without a recent heartbeat was interrupted
+	HeartbeatAt *time.Time `json:"-" bson:"heartbeatAt,omitempty"`
+
+	// Signed link to the file, generated for completed jobs when they are read
+	DownloadURL       string     `json:"downloadUrl,omitempty" bson:"-"`
+	DownloadExpiresAt *time.Time `json:"downloadExpiresAt,omitempty" bson:"-"`
+
+	ExpiresAt   time.Time  `json:"expiresAt" bson:"expiresAt"` // The job and its file are deleted after this
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" bson:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+}
+
+type CreateExportJobRequest struct {
+	ExportContactsRequest `bson:",inline"`
+	RetentionDays         int `json:"retentionDays,omitempty" validate:"omitempty,min=1,max=365"` // Defaults to the configured retention
+}
+
+type ExportJobListResponse struct {
+	Exports    []ExportJob `json:"exports"`
+	Total      int64       `json:"total"`
+	Page       int         `json:"page"`
+	PageSize   int         `json:"pageSize"`
+	TotalPages int         `json:"totalPages"`
+}
+
+// How often a scheduled export runs
+type ExportFrequency string
+
+const (
+	ExportFrequencyHourly ExportFrequency = "hourly" // Every hour at Minute
+	ExportFrequencyDaily  ExportFrequency = "daily"  // Every day at Hour:Minute UTC
+	ExportFrequencyWeekly ExportFrequency = "weekly" // Every Weekday at Hour:Minute UTC
+)
+
+// ExportSchedule starts an export job at a fixed time, e.g. a nightly export of enriched contacts
+type ExportSchedule struct {
+	ID            primitive.ObjectID    `json:"_id" bson:"_id,omitempty"`
+	OrgID         primitive.ObjectID    `json:"organizationId" bson:"orgId"`
+	UserID        primitive.ObjectID    `json:"userId" bson:"userId"`
+	Name          string                `json:"name" bson:"name"`
+	Request       ExportContactsRequest `json:"request" bson:"request"`
+	Frequency     ExportFrequency       `json:"frequency" bson:"frequency"`
+	Hour          int                   `json:"hour" bson:"hour"`
+	Minute        int                   `json:"minute" bson:"minute"`
+	Weekday       int                   `json:"weekday" bson:"weekday"` // 0 is Sunday
+	RetentionDays int                   `json:"retentionDays,omitempty" bson:"retentionDays,omitempty"`
+	Enabled       bool                  `json:"enabled" bson:"enabled"`
+
+	NextRunAt time.Time           `json:"nextRunAt" bson:"nextRunAt"`
+	LastRunAt *time.Time          `json:"lastRunAt,omitempty" bson:"lastRunAt,omitempty"`
+	LastJobID *primitive.ObjectID `json:"lastJobId,omitempty" bson:"lastJobId,omitempty"`
+	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// ExportScheduleRequest creates or replaces an export schedule
+type ExportScheduleRequest struct {
+	Name          string                `json:"name" validate:"required,max=100"`
+	Request       ExportContactsRequest `json:"request"`
+	Frequency     ExportFrequency       `json:"frequency" validate:"required,oneof=hourly daily weekly"`
+	Hour          int                   `json:"hour" validate:"min=0,max=23"`
+	Minute        int                   `json:"minute" validate:"min=0,max=59"`
+	Weekday       int                   `json:"weekday" validate:"min=0,max=6"`
+	RetentionDays int                   `json:"retentionDays,omitempty" validate:"omitempty,min=1,max=365"`
+	Enabled       *bool                 `json:"enabled,omitempty"` // Defaults to true
+}
+
+// NextRun returns the first run of the schedule strictly after the given time
+func (s *ExportSchedule) NextRun(after time.Time) time.Time {
+	after = after.UTC()
+
+	switch s.Frequency {
+	case ExportFrequencyHourly:
+		next := after.Truncate(time.Hour).Add(time.Duration(s.Minute) * time.Minute)
+		if !next.After(after) {
+			next = next.Add(time.Hour)
+		}
+		return next
+	case ExportFrequencyWeekly:
+		next := time.Date(after.Year(), after.Month(), after.Day(), s.Hour, s.Minute, 0, 0, time.UTC)
+		next = next.AddDate(0, 0, (s.Weekday-int(next.Weekday())+7)%7)
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	default:
+		next := time.Date(after.Year(), after.Month(), after.Day(), s.Hour, s.Minute, 0, 0, time.UTC)
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	}
+}
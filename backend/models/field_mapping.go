@@ -0,0 +1,387 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// Name part fields that are combined into OriginalContact.Name during import
+const (
+	FieldFirstName  = "firstName"
+	FieldMiddleName = "middleName"
+	FieldLastName   = "lastName"
+)
+
+// Match types reported for a suggested field mapping
+const (
+	MatchTypeManual  = "manual"  // Mapping supplied by the caller
+	MatchTypePreset  = "preset"  // Mapping of the detected import preset
+	MatchTypeExact   = "exact"   // Header is the target field name
+	MatchTypeSynonym = "synonym" // Header is a known synonym of the target field
+	MatchTypeToken   = "token"   // Header contains all words of a known synonym
+	MatchTypeFuzzy   = "fuzzy"   // Header is a close spelling of a known synonym
+	MatchTypeCustom  = "custom"  // No confident match, stored as a custom field
+)
+
+// MinMappingConfidence is the lowest confidence at which a header is mapped to a standard field
+const MinMappingConfidence = 60
+
+// minAlternativeConfidence is the lowest confidence at which a candidate is reported as an alternative
+const minAlternativeConfidence = 40
+
+// FieldSynonyms lists known header spellings per target field across the languages we see in imports.
+// Entries are already normalized (lowercase, no accents or punctuation).
+var FieldSynonyms = map[string][]string{
+	"name": {
+		"name", "full name", "fullname", "contact name", "display name",
+		"nombre", "nombre completo", "nom", "nom complet", "vollstandiger name", "naam", "volledige naam", "nome", "nome completo",
+	},
+	FieldFirstName: {
+		"first name", "firstname", "given name", "forename",
+		"vorname", "prenom", "nombre de pila", "primer nombre", "voornaam", "nome proprio",
+	},
+	FieldMiddleName: {
+		"middle name", "middlename", "middle initial", "second name",
+		"segundo nombre", "zweiter vorname", "deuxieme prenom", "tussenvoegsel",
+	},
+	FieldLastName: {
+		"last name", "lastname", "surname", "family name",
+		"nachname", "familienname", "nom de famille", "apellido", "apellidos", "achternaam", "cognome",
+	},
+	"email": {
+		"email", "email address", "e mail", "e mail address", "mail", "work email", "business email", "personal email", "primary email",
+		"correo", "correo electronico", "courriel", "adresse email", "email adresse", "emailadresse", "e mailadres",
+	},
+	"phone": {
+		"phone", "phone number", "mobile", "mobile phone", "mobile number", "cell", "cell phone", "telephone", "tel", "work phone", "business phone",
+		"telefono", "movil", "celular", "telefon", "telefonnummer", "handy", "mobiel", "telefoonnummer", "portable", "cellulare",
+	},
+	"company": {
+		"company", "company name", "organization", "organisation", "organization name", "employer", "firm", "account name",
+		"firma", "unternehmen", "empresa", "compania", "entreprise", "societe", "bedrijf", "azienda", "organizacion",
+	},
+	"title": {
+		"title", "job title", "position", "role", "job role", "designation",
+		"cargo", "puesto", "titre", "poste", "fonction", "berufsbezeichnung", "position title", "funktion", "functie", "ruolo",
+	},
+	"industry": {
+		"industry", "sector", "vertical", "line of business",
+		"branche", "industria", "sector industrial", "secteur", "settore",
+	},
+	"location": {
+		"location", "city", "address", "region", "country",
+		"ciudad", "ubicacion", "direccion", "ville", "adresse", "stadt", "ort", "standort", "plaats", "citta", "localita",
+	},
+	"department": {
+		"department", "dept", "division", "business unit",
+		"abteilung", "departamento", "departement", "afdeling", "reparto",
+	},
+}
+
+// Field mapping candidate considered for a source column
+type FieldMappingCandidate struct {
+	Field      string `json:"field"`
+	Confidence int    `json:"confidence"`
+	MatchType  string `json:"matchType"`
+}
+
+// Suggested mapping for a source column together with the alternatives that were considered
+type FieldMappingSuggestion struct {
+	SourceField  string                  `json:"sourceField"`
+	MappedField  string                  `json:"mappedField"`
+	Confidence   int                     `json:"confidence"`
+	MatchType    string                  `json:"matchType"`
+	Alternatives []FieldMappingCandidate `json:"alternatives,omitempty"`
+}
+
+// IsStandardField reports whether a mapped field is stored outside CustomFields
+func IsStandardField(field string) bool {
+	switch field {
+	case "name", "email", "phone", "company", "title", "industry", "location", "department",
+		FieldFirstName, FieldMiddleName, FieldLastName:
+		return true
+	}
+	return false
+}
+
+// SuggestFieldMappings scores every header against the known synonyms and returns one suggestion per header.
+// When several headers compete for the same standard field, the most confident one wins and the others
+// fall back to their next best candidate or to a custom field. Reserved fields are never suggested,
+// which lets callers keep targets that were already mapped manually.
+func SuggestFieldMappings(headers []string, reserved ...string) []FieldMappingSuggestion {
+	type scoredHeader struct {
+		header     string
+		candidates []FieldMappingCandidate
+	}
+
+	scored := make([]scoredHeader, 0, len(headers))
+	for _, header := range headers {
+		scored = append(scored, scoredHeader{header: header, candidates: scoreHeader(header)})
+	}
+
+	// Assign the globally most confident (header, field) pairs first
+	type assignment struct {
+		headerIndex int
+		candidate   FieldMappingCandidate
+	}
+	var pairs []assignment
+	for i, sh := range scored {
+		for _, candidate := range sh.candidates {
+			if candidate.Confidence >= MinMappingConfidence {
+				pairs = append(pairs, assignment{headerIndex: i, candidate: candidate})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		if pairs[i].candidate.Confidence != pairs[j].candidate.Confidence {
+			return pairs[i].candidate.Confidence > pairs[j].candidate.Confidence
+		}
+		return scored[pairs[i].headerIndex].header < scored[pairs[j].headerIndex].header
+	})
+
+	assigned := make(map[int]FieldMappingCandidate)
+	taken := make(map[string]bool)
+	for _, field := range reserved {
+		taken[field] = true
+	}
+	for _, pair := range pairs {
+		if _, done := assigned[pair.headerIndex]; done || taken[pair.candidate.Field] {
+			continue
+		}
+		assigned[pair.headerIndex] = pair.candidate
+		taken[pair.candidate.Field] = true
+	}
+
+	suggestions := make([]FieldMappingSuggestion, 0, len(scored))
+	for i, sh := range scored {
+		suggestion := FieldMappingSuggestion{SourceField: sh.header}
+
+		if candidate, ok := assigned[i]; ok {
+			suggestion.MappedField = candidate.Field
+			suggestion.Confidence = candidate.Confidence
+			suggestion.MatchType = candidate.MatchType
+		} else {
+			suggestion.MappedField = customFieldName(sh.header)
+			if IsStandardField(suggestion.MappedField) {
+				// The standard field went to another column, keep this one alongside it
+				suggestion.MappedField = "other " + suggestion.MappedField
+			}
+			suggestion.Confidence = 100
+			suggestion.MatchType = MatchTypeCustom
+		}
+
+		for _, candidate := range sh.candidates {
+			if candidate.Field != suggestion.MappedField && candidate.Confidence >= minAlternativeConfidence {
+				suggestion.Alternatives = append(suggestion.Alternatives, candidate)
+			}
+		}
+
+		suggestions = append(suggestions, suggestion)
+	}
+
+	return suggestions
+}
+
+// scoreHeader returns the best candidate per target field for a header, most confident first
+func scoreHeader(header string) []FieldMappingCandidate {
+	normalized := normalizeHeader(header)
+	if normalized == "" {
+		return nil
+	}
+	headerTokens := strings.Fields(normalized)
+
+	var candidates []FieldMappingCandidate
+	for field, synonyms := range FieldSynonyms {
+		best := FieldMappingCandidate{Field: field}
+
+		for i, synonym := range synonyms {
+			candidate := FieldMappingCandidate{Field: field}
+
+			switch {
+			case normalized == synonym && i == 0:
+				candidate.Confidence, candidate.MatchType = 100, MatchTypeExact
+			case normalized == synonym:
+				candidate.Confidence, candidate.MatchType = 95, MatchTypeSynonym
+			case containsAllTokens(headerTokens, strings.Fields(synonym)):
+				candidate.Confidence, candidate.MatchType = tokenConfidence(headerTokens, strings.Fields(synonym)), MatchTypeToken
+			default:
+				if similarity := stringSimilarity(normalized, synonym); similarity >= 0.8 {
+					candidate.Confidence, candidate.MatchType = int(similarity*90), MatchTypeFuzzy
+				}
+			}
+
+			if candidate.Confidence > best.Confidence {
+				best = candidate
+			}
+		}
+
+		if best.Confidence > 0 {
+			candidates = append(candidates, best)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Confidence != candidates[j].Confidence {
+			return candidates[i].Confidence > candidates[j].Confidence
+		}
+		return candidates[i].Field < candidates[j].Field
+	})
+
+	return candidates
+}
+
+// tokenConfidence scores a header that contains every word of a synonym. The last word names what
+// a column holds, so other words in front, as in "Home Phone", lower the confidence a little, while
+// a different last word, as in "Phone 1 - Type" or "Email Opt Out", keeps it below
+// MinMappingConfidence. Numbers and "value", as in Google's "Phone 1 - Value", are ignored.
+func tokenConfidence(headerTokens, synonymTokens []string) int {
+	wanted := make(map[string]bool, len(synonymTokens))
+	for _, token := range synonymTokens {
+		wanted[token] = true
+	}
+
+	var words []string
+	unmatched := 0
+	for _, token := range headerTokens {
+		if isNeutralToken(token) {
+			continue
+		}
+		words = append(words, token)
+		if !wanted[token] {
+			unmatched++
+		}
+	}
+
+	switch {
+	case unmatched == 0:
+		return 90
+	case !wanted[words[len(words)-1]]:
+		return 45 + 14*(len(words)-unmatched)/len(words)
+	default:
+		return max(90-10*unmatched, minAlternativeConfidence)
+	}
+}
+
+// isNeutralToken reports header words that say nothing about the field, like the numbers of
+// repeated columns
+func isNeutralToken(token string) bool {
+	if token == "value" {
+		return true
+	}
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// BuildOriginalContact maps a raw import row onto an OriginalContact, combining
+// first, middle and last name columns into Name when no full name column is mapped
+func BuildOriginalContact(row map[string]interface{}, mappings map[string]string) OriginalContact {
+	var contact OriginalContact
+	nameParts := make(map[string]string)
+
+	for sourceField, value := range row {
+		mappedField, exists := mappings[sourceField]
+		if !exists || mappedField == "" {
+			continue
+		}
+
+		switch mappedField {
+		case FieldFirstName, FieldMiddleName, FieldLastName:
+			var part OriginalContact
+			part.SetFieldValue("name", value)
+			nameParts[mappedField] = part.Name
+		default:
+			contact.SetFieldValue(mappedField, value)
+		}
+	}
+
+	if contact.Name == "" && len(nameParts) > 0 {
+		var parts []string
+		for _, field := range []string{FieldFirstName, FieldMiddleName, FieldLastName} {
+			if part := nameParts[field]; part != "" {
+				parts = append(parts, part)
+			}
+		}
+		contact.Name = strings.Join(parts, " ")
+	}
+
+	return contact
+}
+
+// customFieldName is the key used when a header is stored as a custom field
+func customFieldName(header string) string {
+	normalized := strings.ToLower(strings.TrimSpace(header))
+	normalized = strings.ReplaceAll(normalized, "_", " ")
+	normalized = strings.ReplaceAll(normalized, "-", " ")
+	normalized = strings.ReplaceAll(normalized, ".", " ")
+	return normalized
+}
+
+var accentReplacer = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "ö", "o", "õ", "o", "ø", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ñ", "n", "ç", "c", "ß", "ss",
+)
+
+// normalizeHeader lowercases a header, folds accents and reduces punctuation to single spaces
+func normalizeHeader(header string) string {
+	normalized := accentReplacer.Replace(strings.ToLower(strings.TrimSpace(header)))
+
+	var b strings.Builder
+	for _, r := range normalized {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func containsAllTokens(tokens, wanted []string) bool {
+	set := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		set[token] = true
+	}
+	for _, token := range wanted {
+		if !set[token] {
+			return false
+		}
+	}
+	return true
+}
+
+// stringSimilarity returns 1 minus the normalized Levenshtein distance between a and b
+func stringSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return 1 - float64(previous[len(rb)])/float64(max(len(ra), len(rb)))
+}
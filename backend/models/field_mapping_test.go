@@ -0,0 +1,120 @@
+package models
+
+import "testing"
+
+func TestSuggestFieldMappingsGoogleExport(t *testing.T) {
+	headers := []string{
+		"Name", "Given Name", "Additional Name", "Family Name", "Nickname", "Notes", "Group Membership",
+		"E-mail 1 - Type", "E-mail 1 - Value", "E-mail 2 - Type", "E-mail 2 - Value",
+		"Phone 1 - Type", "Phone 1 - Value",
+		"Address 1 - Type", "Address 1 - Formatted", "Address 1 - City",
+		"Organization 1 - Type", "Organization 1 - Name", "Organization 1 - Title", "Organization 1 - Department",
+	}
+
+	assertMappings(t, SuggestFieldMappings(headers), map[string]string{
+		"Name":                        "name",
+		"Given Name":                  FieldFirstName,
+		"Family Name":                 FieldLastName,
+		"Nickname":                    "nickname",
+		"E-mail 1 - Type":             "e mail 1   type",
+		"E-mail 1 - Value":            "email",
+		"E-mail 2 - Value":            "e mail 2   value",
+		"Phone 1 - Type":              "phone 1   type",
+		"Phone 1 - Value":             "phone",
+		"Address 1 - Formatted":       "address 1   formatted",
+		"Address 1 - City":            "location",
+		"Organization 1 - Type":       "organization 1   type",
+		"Organization 1 - Name":       "company",
+		"Organization 1 - Title":      "title",
+		"Organization 1 - Department": "department",
+	})
+}
+
+func TestSuggestFieldMappingsOutlookExport(t *testing.T) {
+	headers := []string{
+		"First Name", "Middle Name", "Last Name", "Title", "Suffix",
+		"E-mail Address", "E-mail 2 Address", "E-mail 3 Address",
+		"Primary Phone", "Home Phone", "Business Phone", "Business Fax",
+		"Company", "Department", "Job Title", "Business City", "Business Street",
+		"Notes", "Email Opt Out", "Web Page",
+	}
+
+	assertMappings(t, SuggestFieldMappings(headers), map[string]string{
+		"First Name":       FieldFirstName,
+		"Middle Name":      FieldMiddleName,
+		"Last Name":        FieldLastName,
+		"Title":            "title",
+		"E-mail Address":   "email",
+		"E-mail 2 Address": "e mail 2 address",
+		"Business Phone":   "phone",
+		"Home Phone":       "home phone",
+		"Business Fax":     "business fax",
+		"Company":          "company",
+		"Department":       "department",
+		"Job Title":        "job title",
+		"Business City":    "location",
+		"Email Opt Out":    "email opt out",
+	})
+}
+
+func TestScoreHeader(t *testing.T) {
+	tests := []struct {
+		header    string
+		field     string
+		matchType string
+		mapped    bool // Whether the confidence reaches MinMappingConfidence
+	}{
+		{"Email", "email", MatchTypeExact, true},
+		{"E-Mail", "email", MatchTypeSynonym, true},
+		{"Correo electrónico", "email", MatchTypeSynonym, true},
+		{"Phone 1 - Value", "phone", MatchTypeToken, true},
+		{"Home Phone", "phone", MatchTypeToken, true},
+		{"Work Email Address", "email", MatchTypeToken, true},
+		{"Adress", "location", MatchTypeFuzzy, true},
+		{"Phone 1 - Type", "phone", MatchTypeToken, false},
+		{"E-mail 1 - Type", "email", MatchTypeToken, false},
+		{"Email Opt Out", "email", MatchTypeToken, false},
+		{"Organization 1 - Title", "company", MatchTypeToken, false},
+		{"Address 1 - Formatted", "location", MatchTypeToken, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			var found *FieldMappingCandidate
+			for _, candidate := range scoreHeader(tt.header) {
+				if candidate.Field == tt.field {
+					candidate := candidate
+					found = &candidate
+				}
+			}
+			if found == nil {
+				t.Fatalf("no %s candidate", tt.field)
+			}
+			if found.MatchType != tt.matchType {
+				t.Errorf("match type %s, want %s", found.MatchType, tt.matchType)
+			}
+			if mapped := found.Confidence >= MinMappingConfidence; mapped != tt.mapped {
+				t.Errorf("confidence %d, mapped %v, want %v", found.Confidence, mapped, tt.mapped)
+			}
+		})
+	}
+}
+
+func assertMappings(t *testing.T, suggestions []FieldMappingSuggestion, want map[string]string) {
+	t.Helper()
+
+	for _, suggestion := range suggestions {
+		field, ok := want[suggestion.SourceField]
+		if !ok {
+			continue
+		}
+		if suggestion.MappedField != field {
+			t.Errorf("%q mapped to %q (%d, %s), want %q", suggestion.SourceField, suggestion.MappedField,
+				suggestion.Confidence, suggestion.MatchType, field)
+		}
+		delete(want, suggestion.SourceField)
+	}
+	for header := range want {
+		t.Errorf("no suggestion for %q", header)
+	}
+}
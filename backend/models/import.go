@@ -0,0 +1,130 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ImportStatus string
+
+const (
+	ImportStatusRunning    ImportStatus = "running"
+	ImportStatusCompleted  ImportStatus = "completed"
+	ImportStatusFailed     ImportStatus = "failed"
+	ImportStatusRolledBack ImportStatus = "rolled_back"
+)
+
+// Endpoint or pipeline an import batch came from
+const (
+	ImportSourceBulk         = "bulk"
+	ImportSourceBulkEnhanced = "bulk-enhanced"
+	ImportSourceStream       = "stream"
+	ImportSourceUpload       = "upload"
+)
+
+// MaxImportErrors and MaxImportErrorBytes cap the row errors kept on the record of an import, by
+// count and by encoded size, so memory stays flat for arbitrarily large streams and records stay far
+// below the 16 MB document size limit however large the rows are. Every error is still returned in
+// the response or the streamed results, the rest are only counted.
+const (
+	MaxImportErrors     = 1000
+	MaxImportErrorBytes = 4 << 20
+)
+
+// ImportErrorCode classifies why an import row was not imported
+type ImportErrorCode string
+
+const (
+	ImportErrorInvalidJSON      ImportErrorCode = "INVALID_JSON"
+	ImportErrorInvalidCSV       ImportErrorCode = "INVALID_CSV"
+	ImportErrorMissingRequired  ImportErrorCode = "MISSING_REQUIRED"
+	ImportErrorInvalidEmail     ImportErrorCode = "INVALID_EMAIL"
+	ImportErrorDuplicateInDB    ImportErrorCode = "DUPLICATE_IN_DB"
+	ImportErrorDuplicateInBatch ImportErrorCode = "DUPLICATE_IN_BATCH"
+	ImportErrorTransformFailed  ImportErrorCode = "TRANSFORM_FAILED"
+	ImportErrorDuplicateKey     ImportErrorCode = "DUPLICATE_KEY"     // Same email inserted concurrently by another request
+	ImportErrorValidationFailed ImportErrorCode = "VALIDATION_FAILED" // Rejected by database validation
+	ImportErrorInsertFailed     ImportErrorCode = "INSERT_FAILED"
+	ImportErrorUpdateFailed     ImportErrorCode = "UPDATE_FAILED"
+)
+
+// ImportError describes a problem with a single import row
+type ImportError struct {
+	Row               int                 `json:"row" bson:"row"`                                                 // 1-based row number in the import
+	Column            string              `json:"column,omitempty" bson:"column,omitempty"`                       // Source column
+	Field             string              `json:"field,omitempty" bson:"field,omitempty"`                         // Mapped contact field
+	Code              ImportErrorCode     `json:"code" bson:"code"`                                               // Machine-readable reason
+	Message           string              `json:"message" bson:"message"`                                         // Human-readable reason
+	Value             interface{}         `json:"value,omitempty" bson:"value,omitempty"`                         // Offending value
+	ExistingContactID *primitive.ObjectID `json:"existingContactId,omitempty" bson:"existingContactId,omitempty"` // Contact the row collided with
+	FirstRow          int                 `json:"firstRow,omitempty" bson:"firstRow,omitempty"`                   // Earlier row with the same email
+
+	// Raw row as it was submitted, used to build the error report for re-upload
+	RowData map[string]interface{} `json:"-" bson:"rowData,omitempty"`
+}
+
+// ImportBatch records a single bulk import so it can be listed and rolled back
+type ImportBatch struct {
+	ID     primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	OrgID  primitive.ObjectID `json:"organizationId" bson:"orgId"`
+	UserID primitive.ObjectID `json:"userId" bson:"userId"` // User who ran the import
+	Source string             `json:"source" bson:"source"`
+	Status ImportStatus       `json:"status" bson:"status"`
+	Mode   ImportMode         `json:"mode" bson:"mode"`
+
+	// Mapping configuration used for enhanced imports
+	FieldMapping map[string]string   `json:"fieldMapping,omitempty" bson:"fieldMapping,omitempty"`
+	TemplateID   *primitive.ObjectID `json:"templateId,omitempty" bson:"templateId,omitempty"`
+	Preset       string              `json:"preset,omitempty" bson:"preset,omitempty"`
+	Transforms   []TransformRule     `json:"transforms,omitempty" bson:"transforms,omitempty"`
+
+	TotalRows      int           `json:"totalRows" bson:"totalRows"`
+	CreatedCount   int           `json:"createdCount" bson:"createdCount"`
+	UpdatedCount   int           `json:"updatedCount" bson:"updatedCount"`
+	UnchangedCount int           `json:"unchangedCount" bson:"unchangedCount"`
+	SkippedCount   int           `json:"skippedCount" bson:"skippedCount"`
+	Errors         []ImportError `json:"errors" bson:"errors"`
+	OmittedErrors  int           `json:"omittedErrors,omitempty" bson:"omittedErrors,omitempty"` // Errors past the caps, not kept
+	FailureReason  string        `json:"failureReason,omitempty" bson:"failureReason,omitempty"`
+
+	RolledBackCount int64      `json:"rolledBackCount,omitempty" bson:"rolledBackCount,omitempty"`
+	RolledBackAt    *time.Time `json:"rolledBackAt,omitempty" bson:"rolledBackAt,omitempty"`
+	CreatedAt       time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" bson:"updated_at"` // Last progress of a running import
+	CompletedAt     time.Time  `json:"completed_at" bson:"completed_at"`
+}
+
+type ImportListResponse struct {
+	Imports    []ImportBatch `json:"imports"`
+	Total      int64         `json:"total"`
+	Page       int           `json:"page"`
+	PageSize   int           `json:"pageSize"`
+	TotalPages int           `json:"totalPages"`
+}
+
+type RollbackImportResponse struct {
+	Import         ImportBatch `json:"import"`
+	DeletedCount   int64       `json:"deletedCount"`   // Contacts created by the batch and deleted
+	ModifiedCount  int64       `json:"modifiedCount"`  // Contacts created by the batch but kept because they changed afterwards
+	UpdatedSkipped int         `json:"updatedSkipped"` // Existing contacts the batch updated, which rollback does not revert
+}
+
+// Status of a single line of a streamed import
+const (
+	StreamStatusCreated   = "created"
+	StreamStatusUpdated   = "updated"
+	StreamStatusUnchanged = "unchanged"
+	StreamStatusSkipped   = "skipped" // Duplicate email that was left alone
+	StreamStatusError     = "error"
+)
+
+// Result line written back for every input line of a streamed import
+type StreamImportResult struct {
+	Line          int                 `json:"line"`
+	Status        string              `json:"status"`
+	ID            *primitive.ObjectID `json:"id,omitempty"`
+	Email         string              `json:"email,omitempty"`
+	ChangedFields []string            `json:"changedFields,omitempty"`
+	Error         *ImportError        `json:"error,omitempty"`
+}
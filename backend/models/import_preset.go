@@ -0,0 +1,336 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Values of the preset option of an import
+const (
+	ImportPresetAuto = "auto" // Detect the preset from the headers, the default
+	ImportPresetNone = "none" // Never apply a preset
+)
+
+// ImportPreset is a built-in mapping for the CSV export of a well-known application
+type ImportPreset struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Headers that must all be present for the preset to be detected
+	Signature []string `json:"signature"`
+
+	// Target field per header. "#" in a header matches the number of a multi-value column such as
+	// "E-mail # - Value" and is replaced by that number in the field. An empty field drops the column.
+	// Exact headers take precedence over numbered ones. Columns not listed are mapped automatically.
+	Columns map[string]string `json:"columns"`
+
+	// Rules applied before the import's own transformation rules
+	Transforms []TransformRule `json:"transforms,omitempty"`
+}
+
+// ImportPresets lists the built-in presets in detection order
+var ImportPresets = []ImportPreset{
+	{
+		ID:          "linkedin",
+		Name:        "LinkedIn connections",
+		Description: "Connections.csv from a LinkedIn data export, including its notes preamble",
+		Signature:   []string{"First Name", "Last Name", "URL", "Email Address", "Connected On"},
+		Columns: map[string]string{
+			"First Name":    FieldFirstName,
+			"Last Name":     FieldLastName,
+			"Email Address": "email",
+			"Company":       "company",
+			"Position":      "title",
+			"URL":           "linkedinUrl",
+			"Connected On":  "connectedOn",
+		},
+	},
+	{
+		ID:          "google",
+		Name:        "Google Contacts",
+		Description: "Google CSV export from Google Contacts, in the current and the legacy column layout",
+		Signature:   []string{"E-mail 1 - Value"},
+		Columns: map[string]string{
+			// Current layout
+			"First Name":              FieldFirstName,
+			"Middle Name":             FieldMiddleName,
+			"Last Name":               FieldLastName,
+			"Organization Name":       "company",
+			"Organization Title":      "title",
+			"Organization Department": "department",
+			"Labels":                  "labels",
+			"Phonetic First Name":     "",
+			"Phonetic Middle Name":    "",
+			"Phonetic Last Name":      "",
+			"File As":                 "",
+
+			// Legacy layout
+			"Name":                        "name",
+			"Given Name":                  FieldFirstName,
+			"Additional Name":             FieldMiddleName,
+			"Family Name":                 FieldLastName,
+			"Organization 1 - Name":       "company",
+			"Organization 1 - Title":      "title",
+			"Organization 1 - Department": "department",
+			"Organization # - Name":       "company#",
+			"Organization # - Title":      "title#",
+			"Organization # - Department": "department#",
+			"Organization # - Type":       "",
+			"Organization # - Yomi Name":  "",
+			"Organization # - Symbol":     "",
+			"Organization # - Location":   "",
+			"Group Membership":            "labels",
+			"Yomi Name":                   "",
+			"Given Name Yomi":             "",
+			"Additional Name Yomi":        "",
+			"Family Name Yomi":            "",
+			"Name Prefix":                 "namePrefix",
+			"Name Suffix":                 "nameSuffix",
+			"Initials":                    "",
+			"Short Name":                  "",
+			"Maiden Name":                 "",
+			"Billing Information":         "",
+			"Directory Server":            "",
+			"Mileage":                     "",
+			"Sensitivity":                 "",
+			"Priority":                    "",
+			"Subject":                     "",
+			"Photo":                       "",
+
+			// Both layouts
+			"Nickname":                     "nickname",
+			"Birthday":                     "birthday",
+			"Notes":                        "notes",
+			"E-mail 1 - Value":             "email",
+			"E-mail # - Value":             "email#",
+			"E-mail # - Type":              "",
+			"E-mail # - Label":             "",
+			"Phone 1 - Value":              "phone",
+			"Phone # - Value":              "phone#",
+			"Phone # - Type":               "",
+			"Phone # - Label":              "",
+			"Address 1 - City":             "location",
+			"Address 1 - Region":           "region",
+			"Address 1 - Country":          "country",
+			"Address # - Formatted":        "",
+			"Address # - Type":             "",
+			"Address # - Label":            "",
+			"Address # - Street":           "",
+			"Address # - City":             "",
+			"Address # - PO Box":           "",
+			"Address # - Region":           "",
+			"Address # - Postal Code":      "",
+			"Address # - Country":          "",
+			"Address # - Extended Address": "",
+			"Website 1 - Value":            "website",
+			"Website # - Value":            "website#",
+			"Website # - Type":             "",
+			"Website # - Label":            "",
+
+			// Written by the transforms below
+			"Additional E-mails": "additionalEmails",
+			"Additional Phones":  "additionalPhones",
+		},
+		// Google joins several values of one column with " ::: ", the first one is kept and the rest
+		// stored as additional emails and phones
+		Transforms: []TransformRule{
+			{Column: "E-mail 1 - Value", Target: "Additional E-mails", Steps: []TransformStep{{Type: TransformRegex, Pattern: `:::\s*(.+)$`, Group: 1}}},
+			{Column: "E-mail 1 - Value", Steps: []TransformStep{{Type: TransformSplit, Delimiter: ":::"}}},
+			{Column: "Phone 1 - Value", Target: "Additional Phones", Steps: []TransformStep{{Type: TransformRegex, Pattern: `:::\s*(.+)$`, Group: 1}}},
+			{Column: "Phone 1 - Value", Steps: []TransformStep{{Type: TransformSplit, Delimiter: ":::"}}},
+		},
+	},
+	{
+		ID:          "outlook",
+		Name:        "Outlook",
+		Description: "Comma separated values export from Outlook or Outlook.com",
+		Signature:   []string{"E-mail Address", "Business Phone", "Mobile Phone", "Job Title"},
+		Columns: map[string]string{
+			"First Name":              FieldFirstName,
+			"Middle Name":             FieldMiddleName,
+			"Last Name":               FieldLastName,
+			"Title":                   "namePrefix", // Courtesy title such as "Dr.", the job title is "Job Title"
+			"Suffix":                  "nameSuffix",
+			"Nickname":                "nickname",
+			"E-mail Address":          "email",
+			"E-mail 2 Address":        "email2",
+			"E-mail 3 Address":        "email3",
+			"E-mail Display Name":     "",
+			"E-mail 2 Display Name":   "",
+			"E-mail 3 Display Name":   "",
+			"E-mail Type":             "",
+			"E-mail 2 Type":           "",
+			"E-mail 3 Type":           "",
+			"Mobile Phone":            "phone",
+			"Business Phone":          "businessPhone",
+			"Home Phone":              "homePhone",
+			"Job Title":               "title",
+			"Department":              "department",
+			"Company":                 "company",
+			"Business City":           "location",
+			"Business State":          "region",
+			"Business Country/Region": "country",
+			"Web Page":                "website",
+			"Birthday":                "birthday",
+			"Notes":                   "notes",
+			"Categories":              "labels",
+			"Manager's Name":          "manager",
+			"Primary Phone":           "",
+			"Other Phone":             "",
+			"Business Phone 2":        "",
+			"Home Phone 2":            "",
+			"Company Main Telephone":  "",
+			"Assistant's Name":        "",
+			"Assistant's Phone":       "",
+			"Business Street":         "",
+			"Business Street 2":       "",
+			"Business Street 3":       "",
+			"Business Postal Code":    "",
+			"Business P.O. Box":       "",
+			"Home Street":             "",
+			"Home Street 2":           "",
+			"Home Street 3":           "",
+			"Home City":               "",
+			"Home State":              "",
+			"Home Postal Code":        "",
+			"Home Country/Region":     "",
+			"Home P.O. Box":           "",
+			"Other Street":            "",
+			"Other Street 2":          "",
+			"Other Street 3":          "",
+			"Other City":              "",
+			"Other State":             "",
+			"Other Postal Code":       "",
+			"Other Country/Region":    "",
+			"Other P.O. Box":          "",
+			"Given Yomi":              "",
+			"Surname Yomi":            "",
+			"Company Yomi":            "",
+			"Business Fax":            "",
+			"Home Fax":                "",
+			"Other Fax":               "",
+			"Pager":                   "",
+			"Car Phone":               "",
+			"Callback":                "",
+			"Radio Phone":             "",
+			"Telex":                   "",
+			"TTY/TDD Phone":           "",
+			"Initials":                "",
+			"Priority":                "",
+			"Private":                 "",
+			"Sensitivity":             "",
+			"Mileage":                 "",
+			"Billing Information":     "",
+			"Directory Server":        "",
+			"Location":                "",
+			"Office Location":         "",
+			"Anniversary":             "",
+			"Gender":                  "",
+			"Account":                 "",
+			"User 1":                  "",
+			"User 2":                  "",
+			"User 3":                  "",
+			"User 4":                  "",
+		},
+		Transforms: []TransformRule{
+			// The mobile number is preferred, with the business and home numbers as fallbacks
+			{Column: "Mobile Phone", Steps: []TransformStep{{Type: TransformCoalesce, Columns: []string{"Primary Phone", "Business Phone", "Home Phone"}}}},
+			{Column: "Business City", Steps: []TransformStep{{Type: TransformCoalesce, Columns: []string{"Home City", "Other City"}}}},
+			// Outlook writes "0/0/00" for a missing birthday
+			{Column: "Birthday", Steps: []TransformStep{{Type: TransformMap, Values: map[string]string{"0/0/00": ""}}}},
+		},
+	},
+}
+
+// FindImportPreset returns the built-in preset with the given ID
+func FindImportPreset(id string) *ImportPreset {
+	for i := range ImportPresets {
+		if ImportPresets[i].ID == id {
+			return &ImportPresets[i]
+		}
+	}
+	return nil
+}
+
+// DetectImportPreset returns the first preset whose signature headers are all present, if any
+func DetectImportPreset(headers []string) *ImportPreset {
+	for i := range ImportPresets {
+		if ImportPresets[i].Matches(headers) {
+			return &ImportPresets[i]
+		}
+	}
+	return nil
+}
+
+// SelectImportPreset resolves the preset option of an import: a preset ID, ImportPresetNone,
+// or ImportPresetAuto and empty to detect the preset from the headers
+func SelectImportPreset(option string, headers []string) *ImportPreset {
+	switch option {
+	case ImportPresetNone:
+		return nil
+	case "", ImportPresetAuto:
+		return DetectImportPreset(headers)
+	}
+	return FindImportPreset(option)
+}
+
+// Matches reports whether all signature headers of the preset are present
+func (p *ImportPreset) Matches(headers []string) bool {
+	present := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		present[presetHeaderKey(header)] = true
+	}
+
+	for _, header := range p.Signature {
+		if !present[presetHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+// MapHeaders returns the target field of every header the preset knows, dropped columns map to ""
+func (p *ImportPreset) MapHeaders(headers []string) map[string]string {
+	exact := make(map[string]string)
+	type numberedColumn struct {
+		pattern *regexp.Regexp
+		field   string
+	}
+	var numbered []numberedColumn
+	for header, field := range p.Columns {
+		if !strings.Contains(header, "#") {
+			exact[presetHeaderKey(header)] = field
+			continue
+		}
+		parts := strings.Split(presetHeaderKey(header), "#")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		numbered = append(numbered, numberedColumn{
+			pattern: regexp.MustCompile("^" + strings.Join(parts, `(\d+)`) + "$"),
+			field:   field,
+		})
+	}
+
+	mappings := make(map[string]string)
+	for _, header := range headers {
+		key := presetHeaderKey(header)
+		if field, exists := exact[key]; exists {
+			mappings[header] = field
+			continue
+		}
+		for _, column := range numbered {
+			if match := column.pattern.FindStringSubmatch(key); match != nil {
+				mappings[header] = strings.ReplaceAll(column.field, "#", match[1])
+				break
+			}
+		}
+	}
+
+	return mappings
+}
+
+func presetHeaderKey(header string) string {
+	return strings.ToLower(strings.TrimSpace(header))
+}
@@ -0,0 +1,22 @@
+package models
+
+// JSONWebKey is the public key of an access token signing key, as published in the JWKS
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519 keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet lists the public keys other services verify access tokens with
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
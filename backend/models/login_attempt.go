@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginAttempts counts the recent failed logins of an email address or of a client IP
+type LoginAttempts struct {
+	ID            string     `bson:"_id"` // "email:<address>" or "ip:<address>"
+	Failures      int        `bson:"failures"`
+	LastFailureAt time.Time  `bson:"lastFailureAt"`
+	LockedUntil   *time.Time `bson:"lockedUntil,omitempty"`
+	ExpiresAt     time.Time  `bson:"expiresAt"` // The document is dropped once it no longer limits logins
+}
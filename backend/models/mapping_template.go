@@ -0,0 +1,92 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Minimum header overlap (percent) for a saved template to be suggested for an import
+const MinTemplateMatchScore = 70
+
+// Saved field mapping for a recurring import format
+type MappingTemplate struct {
+	ID           primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	UserID       primitive.ObjectID `json:"userId" bson:"userId"`
+	Name         string             `json:"name" bson:"name"`
+	FieldMapping map[string]string  `json:"fieldMapping" bson:"fieldMapping"`
+	Headers      []string           `json:"headers" bson:"headers"`         // Source columns the template was saved for
+	Fingerprint  string             `json:"fingerprint" bson:"fingerprint"` // HeaderFingerprint of Headers
+	LastUsedAt   *time.Time         `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type CreateMappingTemplateRequest struct {
+	Name         string            `json:"name" validate:"required"`
+	FieldMapping map[string]string `json:"fieldMapping" validate:"required,min=1"`
+	Headers      []string          `json:"headers,omitempty"` // Defaults to the mapped source columns
+}
+
+type UpdateMappingTemplateRequest struct {
+	Name         string            `json:"name,omitempty"`
+	FieldMapping map[string]string `json:"fieldMapping,omitempty"`
+	Headers      []string          `json:"headers,omitempty"`
+}
+
+type MatchMappingTemplatesRequest struct {
+	Headers []string `json:"headers" validate:"required,min=1"`
+}
+
+// Saved template that fits the headers of an import
+type MappingTemplateMatch struct {
+	Template MappingTemplate `json:"template"`
+	Score    int             `json:"score"` // Percentage of shared headers
+	Exact    bool            `json:"exact"` // Headers are identical to the template's
+}
+
+// HeaderFingerprint identifies a set of headers regardless of order, case and punctuation
+func HeaderFingerprint(headers []string) string {
+	normalized := normalizedHeaderSet(headers)
+
+	keys := make([]string, 0, len(normalized))
+	for header := range normalized {
+		keys = append(keys, header)
+	}
+	sort.Strings(keys)
+
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// HeaderOverlap returns the percentage of headers shared by both sets (Jaccard index)
+func HeaderOverlap(a, b []string) int {
+	setA, setB := normalizedHeaderSet(a), normalizedHeaderSet(b)
+	if len(setA) == 0 && len(setB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for header := range setA {
+		if setB[header] {
+			shared++
+		}
+	}
+	union := len(setA) + len(setB) - shared
+
+	return shared * 100 / union
+}
+
+func normalizedHeaderSet(headers []string) map[string]bool {
+	set := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		if normalized := normalizeHeader(header); normalized != "" {
+			set[normalized] = true
+		}
+	}
+	return set
+}
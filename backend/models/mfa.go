@@ -0,0 +1,25 @@
+package models
+
+// MFAEnrollmentResponse is the secret of a pending TOTP enrollment. Authenticator apps read the
+// otpauth URI from a QR code, the secret can be typed in instead.
+type MFAEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+}
+
+// MFACodeRequest carries a code of the authenticator app, or a recovery code where accepted
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// DisableMFARequest turns two-factor authentication off, with the password and a code of the app or a recovery code
+type DisableMFARequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// MFALoginRequest completes a login that returned an MFA challenge
+type MFALoginRequest struct {
+	MFAToken string `json:"mfaToken" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
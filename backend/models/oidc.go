@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OIDCState is a pending single sign-on login, from the redirect to the identity provider until
+// its callback. It is used once.
+type OIDCState struct {
+	ID           string              `bson:"_id"` // SHA-256 of the state parameter, hex encoded
+	Nonce        string              `bson:"nonce"`
+	CodeVerifier string              `bson:"codeVerifier"`         // PKCE verifier of the authorization code
+	LinkUserID   *primitive.ObjectID `bson:"linkUserId,omitempty"` // Set when a signed in user links their account
+	ExpiresAt    time.Time           `bson:"expiresAt"`
+	CreatedAt    time.Time           `bson:"created_at"`
+}
+
+// OIDCCallbackRequest carries the parameters the identity provider redirected back with
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
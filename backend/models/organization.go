@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OrgRole string
+
+const (
+	OrgRoleOwner  OrgRole = "owner"  // Full control, including the organization itself
+	OrgRoleAdmin  OrgRole = "admin"  // Manages members and data
+	OrgRoleMember OrgRole = "member" // Works with contacts
+	OrgRoleViewer OrgRole = "viewer" // Lists and exports contacts
+)
+
+// Organization is a workspace whose members share its contacts
+type Organization struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+
+	// Members without two-factor authentication can only manage their account until they enable it
+	RequireMFA bool `json:"requireMfa" bson:"requireMfa"`
+}
+
+// Membership gives a user a role in an organization
+type Membership struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	OrgID     primitive.ObjectID `json:"organizationId" bson:"orgId"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	Role      OrgRole            `json:"role" bson:"role"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+
+	// Set when the membership is resolved for a request, not stored: the organization requires
+	// two-factor authentication that the user has not enabled
+	MFAEnrollmentRequired bool `json:"-" bson:"-"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// UpdateOrganizationRequest changes the fields that are set
+type UpdateOrganizationRequest struct {
+	Name       string `json:"name" validate:"omitempty,max=100"`
+	RequireMFA *bool  `json:"requireMfa"`
+}
+
+// Invitation offers a role in an organization to an email address. It becomes a membership once a
+// user with that verified address accepts it.
+type Invitation struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	OrgID     primitive.ObjectID `json:"organizationId" bson:"orgId"`
+	Email     string             `json:"email" bson:"email"`
+	Role      OrgRole            `json:"role" bson:"role"`
+	InvitedBy primitive.ObjectID `json:"invitedBy" bson:"invitedBy"`
+	ExpiresAt time.Time          `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+type InviteMemberRequest struct {
+	Email string  `json:"email" validate:"required,email"`
+	Role  OrgRole `json:"role" validate:"required,oneof=owner admin member viewer"`
+}
+
+// InvitationResponse is an invitation of the current user, with the organization it is for
+type InvitationResponse struct {
+	Invitation
+	OrganizationName string `json:"organizationName"`
+}
+
+type UpdateMemberRequest struct {
+	Role OrgRole `json:"role" validate:"required,oneof=owner admin member viewer"`
+}
+
+// OrganizationResponse is an organization with the role of the current user
+type OrganizationResponse struct {
+	Organization
+	Role   OrgRole `json:"role"`
+	Active bool    `json:"active"` // Whether it is the organization of the current token
+}
+
+// MemberResponse is a membership with the user it belongs to
+type MemberResponse struct {
+	UserID    primitive.ObjectID `json:"userId"`
+	Email     string             `json:"email"`
+	Name      string             `json:"name"`
+	Role      OrgRole            `json:"role"`
+	CreatedAt time.Time          `json:"created_at"`
+}
@@ -0,0 +1,60 @@
+package models
+
+// Permission is an action a member can take in an organization
+type Permission string
+
+const (
+	PermissionContactsRead   Permission = "contacts:read"       // List and view contacts and imports
+	PermissionContactsExport Permission = "contacts:export"     // Export contacts
+	PermissionContactsWrite  Permission = "contacts:write"      // Create and import contacts, manage mapping templates
+	PermissionContactsEnrich Permission = "contacts:enrich"     // Enrich contacts
+	PermissionContactsDelete Permission = "contacts:delete"     // Delete contacts, e.g. by rolling back an import
+	PermissionMembersManage  Permission = "members:manage"      // Add, change and remove members other than owners
+	PermissionOwnersManage   Permission = "owners:manage"       // Add, change and remove owners
+	PermissionOrgManage      Permission = "organization:manage" // Rename the organization
+)
+
+// rolePermissions lists the permissions of each role
+var rolePermissions = map[OrgRole][]Permission{
+	OrgRoleViewer: {
+		PermissionContactsRead, PermissionContactsExport,
+	},
+	OrgRoleMember: {
+		PermissionContactsRead, PermissionContactsExport, PermissionContactsWrite, PermissionContactsEnrich,
+	},
+	OrgRoleAdmin: {
+		PermissionContactsRead, PermissionContactsExport, PermissionContactsWrite, PermissionContactsEnrich,
+		PermissionContactsDelete, PermissionMembersManage, PermissionOrgManage,
+	},
+	OrgRoleOwner: {
+		PermissionContactsRead, PermissionContactsExport, PermissionContactsWrite, PermissionContactsEnrich,
+		PermissionContactsDelete, PermissionMembersManage, PermissionOrgManage, PermissionOwnersManage,
+	},
+}
+
+// Can reports whether the role has a permission
+func (r OrgRole) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions of the role
+func (r OrgRole) Permissions() []Permission {
+	return append([]Permission{}, rolePermissions[r]...)
+}
+
+// Codes of 403 and 429 responses, so clients can tell the reasons apart without parsing messages
+const (
+	ErrorCodeInsufficientPermission = "insufficient_permission" // The member's role lacks a permission
+	ErrorCodeInsufficientScope      = "insufficient_scope"      // The API key lacks a scope
+	ErrorCodeUserSessionRequired    = "user_session_required"   // The endpoint is not available to API keys
+	ErrorCodeEmailNotVerified       = "email_not_verified"      // Login requires a verified email address
+	ErrorCodeTooManyAttempts        = "too_many_attempts"       // Login is throttled after failed attempts, with status 429
+	ErrorCodeMFAEnrollmentRequired  = "mfa_enrollment_required" // The organization requires two-factor authentication
+	ErrorCodeAdminRequired          = "admin_required"          // The endpoint is only available to administrators
+	ErrorCodeImpersonationDenied    = "impersonation_denied"    // The endpoint cannot be used while impersonating a user
+)
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// TransformType names a step of an import transformation rule
+type TransformType string
+
+const (
+	TransformTrim      TransformType = "trim"      // Trim surrounding whitespace and collapse inner runs of spaces
+	TransformLowercase TransformType = "lowercase" // Lowercase the value
+	TransformUppercase TransformType = "uppercase" // Uppercase the value
+	TransformTitleCase TransformType = "titlecase" // Capitalize every word
+	TransformSplit     TransformType = "split"     // Split on Delimiter, keep part Index and optionally write parts to Targets
+	TransformRegex     TransformType = "regex"     // Keep capture group Group of the first Pattern match
+	TransformMap       TransformType = "map"       // Replace values found in Values, e.g. "VP" -> "Vice President"
+	TransformDefault   TransformType = "default"   // Use Value when the value is empty
+	TransformConcat    TransformType = "concat"    // Append the values of Columns joined by Delimiter
+	TransformCoalesce  TransformType = "coalesce"  // Use the first non-empty value of Columns when the value is empty
+	TransformCoerce    TransformType = "coerce"    // Convert to As: string, number, integer, boolean or date
+)
+
+// Types a value can be coerced to
+const (
+	CoerceString  = "string"
+	CoerceNumber  = "number"
+	CoerceInteger = "integer"
+	CoerceBoolean = "boolean"
+	CoerceDate    = "date"
+)
+
+// Declarative transformation applied to a raw import column before field mapping
+type TransformRule struct {
+	Column string          `json:"column" bson:"column"`                     // Source column the steps start from
+	Target string          `json:"target,omitempty" bson:"target,omitempty"` // Column receiving the result, defaults to Column
+	Steps  []TransformStep `json:"steps" bson:"steps"`
+}
+
+// Single step of a transformation rule, only the parameters of its type are used
+type TransformStep struct {
+	Type TransformType `json:"type" bson:"type"`
+
+	Delimiter string   `json:"delimiter,omitempty" bson:"delimiter,omitempty"` // split, concat
+	Index     int      `json:"index,omitempty" bson:"index,omitempty"`         // split: part to keep, negative counts from the end
+	Targets   []string `json:"targets,omitempty" bson:"targets,omitempty"`     // split: columns receiving each part
+
+	Pattern string `json:"pattern,omitempty" bson:"pattern,omitempty"` // regex
+	Group   int    `json:"group,omitempty" bson:"group,omitempty"`     // regex: capture group, 0 for the whole match
+
+	Values          map[string]string `json:"values,omitempty" bson:"values,omitempty"`                   // map
+	CaseInsensitive bool              `json:"caseInsensitive,omitempty" bson:"caseInsensitive,omitempty"` // map
+
+	Value interface{} `json:"value,omitempty" bson:"value,omitempty"` // default
+
+	Columns []string `json:"columns,omitempty" bson:"columns,omitempty"` // concat, coalesce
+
+	As     string `json:"as,omitempty" bson:"as,omitempty"`         // coerce
+	Layout string `json:"layout,omitempty" bson:"layout,omitempty"` // coerce: Go time layout for dates
+}
+
+// Validate checks that a rule and its steps carry the parameters they need
+func (r TransformRule) Validate() error {
+	if r.Column == "" {
+		return fmt.Errorf("column is required")
+	}
+	if len(r.Steps) == 0 {
+		return fmt.Errorf("column %q: at least one step is required", r.Column)
+	}
+
+	for i, step := range r.Steps {
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("column %q step %d: %v", r.Column, i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (s TransformStep) validate() error {
+	switch s.Type {
+	case TransformTrim, TransformLowercase, TransformUppercase, TransformTitleCase:
+		return nil
+	case TransformSplit:
+		if s.Delimiter == "" {
+			return fmt.Errorf("split requires a delimiter")
+		}
+	case TransformRegex:
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+		if s.Group < 0 || s.Group > re.NumSubexp() {
+			return fmt.Errorf("pattern has no capture group %d", s.Group)
+		}
+	case TransformMap:
+		if len(s.Values) == 0 {
+			return fmt.Errorf("map requires values")
+		}
+	case TransformDefault:
+		if s.Value == nil {
+			return fmt.Errorf("default requires a value")
+		}
+	case TransformConcat, TransformCoalesce:
+		if len(s.Columns) == 0 {
+			return fmt.Errorf("%s requires columns", s.Type)
+		}
+	case TransformCoerce:
+		switch s.As {
+		case CoerceString, CoerceNumber, CoerceInteger, CoerceBoolean, CoerceDate:
+		default:
+			return fmt.Errorf("unsupported coercion %q", s.As)
+		}
+	default:
+		return fmt.Errorf("unknown transform type %q", s.Type)
+	}
+
+	return nil
+}
+
+// ValidateTransformRules validates every rule of an import request
+func ValidateTransformRules(rules []TransformRule) error {
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("transform rule %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
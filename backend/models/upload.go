@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type UploadStatus string
+
+const (
+	UploadStatusUploading  UploadStatus = "uploading"  // Waiting for more chunks
+	UploadStatusProcessing UploadStatus = "processing" // Fully received, import running
+	UploadStatusImported   UploadStatus = "imported"
+	UploadStatusFailed     UploadStatus = "failed"
+)
+
+// File formats an upload can be imported from
+const (
+	UploadFormatCSV    = "csv"    // Header row followed by one contact per row, mapped like an enhanced import
+	UploadFormatNDJSON = "ndjson" // One contact per line in the originalContact format
+)
+
+// UploadSession tracks a resumable upload of an import file
+type UploadSession struct {
+	ID       primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	OrgID    primitive.ObjectID `json:"organizationId" bson:"orgId"` // Organization the file is imported into
+	UserID   primitive.ObjectID `json:"userId" bson:"userId"`
+	Filename string             `json:"filename" bson:"filename"`
+	Format   string             `json:"format" bson:"format"`
+	Size     int64              `json:"size" bson:"size"`                             // Declared total size in bytes
+	Offset   int64              `json:"offset" bson:"offset"`                         // Bytes received and verified so far
+	Checksum string             `json:"checksum,omitempty" bson:"checksum,omitempty"` // Expected SHA-256 of the whole file, hex encoded
+	Status   UploadStatus       `json:"status" bson:"status"`
+
+	// Import settings applied once the file is complete
+	Mode         ImportMode          `json:"mode" bson:"mode"`
+	FieldMapping map[string]string   `json:"fieldMapping,omitempty" bson:"fieldMapping,omitempty"`
+	TemplateID   *primitive.ObjectID `json:"templateId,omitempty" bson:"templateId,omitempty"`
+	Preset       string              `json:"preset,omitempty" bson:"preset,omitempty"`
+	Transforms   []TransformRule     `json:"transforms,omitempty" bson:"transforms,omitempty"`
+
+	ImportID      *primitive.ObjectID `json:"importId,omitempty" bson:"importId,omitempty"`
+	FailureReason string              `json:"failureReason,omitempty" bson:"failureReason,omitempty"`
+	ExpiresAt     time.Time           `json:"expiresAt" bson:"expiresAt"` // Unfinished uploads are discarded after this
+	CreatedAt     time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+type CreateUploadRequest struct {
+	Filename     string            `json:"filename" validate:"required"`
+	Size         int64             `json:"size" validate:"required,min=1"`
+	Format       string            `json:"format" validate:"required,oneof=csv ndjson"`
+	Checksum     string            `json:"checksum,omitempty" validate:"omitempty,len=64,hexadecimal"`
+	Mode         ImportMode        `json:"mode,omitempty" validate:"omitempty,oneof=skip overwrite fill-empty merge-custom-fields"`
+	FieldMapping map[string]string `json:"fieldMapping,omitempty"`
+	TemplateID   string            `json:"templateId,omitempty"`
+	Preset       string            `json:"preset,omitempty" validate:"omitempty,oneof=auto none linkedin google outlook"`
+	Transforms   []TransformRule   `json:"transforms,omitempty"`
+}
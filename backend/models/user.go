@@ -14,12 +14,65 @@ type User struct {
 	IsActive  bool               `json:"isActive" bson:"isActive"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+
+	// Set once the user followed the link of a verification email
+	EmailVerified   bool       `json:"emailVerified" bson:"emailVerified"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty" bson:"emailVerifiedAt,omitempty"`
+
+	// New address of an email change, replaces Email once confirmed from a link sent to it
+	PendingEmail string `json:"pendingEmail,omitempty" bson:"pendingEmail,omitempty"`
+
+	// Set while the account is deactivated, by the user or an administrator
+	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty" bson:"deactivatedAt,omitempty"`
+
+	// Set once the user asked to delete the account, with the organizations that are deleted along.
+	// Deletion is finished by a background sweep when the request could not complete it.
+	DeletionRequestedAt *time.Time           `json:"deletionRequestedAt,omitempty" bson:"deletionRequestedAt,omitempty"`
+	DeletionOrgIDs      []primitive.ObjectID `json:"-" bson:"deletionOrgIds,omitempty"`
+
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty" bson:"lastLoginAt,omitempty"`
+
+	// Incremented to invalidate every access token issued before, e.g. on logout from all devices
+	TokenVersion int `json:"-" bson:"tokenVersion"`
+
+	// TOTP two-factor authentication. The secret is only set once enrollment was confirmed,
+	// recovery codes are stored as SHA-256 hashes and removed when used.
+	MFAEnabled       bool     `json:"mfaEnabled" bson:"mfaEnabled"`
+	MFASecret        string   `json:"-" bson:"mfaSecret,omitempty"`
+	MFAPendingSecret string   `json:"-" bson:"mfaPendingSecret,omitempty"`
+	MFARecoveryCodes []string `json:"-" bson:"mfaRecoveryCodes,omitempty"`
+	MFALastStep      int64    `json:"-" bson:"mfaLastStep,omitempty"` // Time step of the last accepted code, codes are single use
+
+	// Identity of a linked single sign-on account
+	OIDCIssuer  string `json:"-" bson:"oidcIssuer,omitempty"`
+	OIDCSubject string `json:"-" bson:"oidcSubject,omitempty"`
+
+	// Organization that is active after login, the one last switched to
+	DefaultOrgID *primitive.ObjectID `json:"defaultOrganizationId,omitempty" bson:"defaultOrgId,omitempty"`
 }
 
 type RegisterRequest struct {
 	Name     string `json:"name" validate:"required"`
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Password string `json:"password" validate:"required"` // Checked against the password policy
+}
+
+// UpdateProfileRequest changes the fields that are set. A new email only replaces the current one
+// once confirmed, and needs the current password.
+type UpdateProfileRequest struct {
+	Name            string `json:"name" validate:"omitempty,max=100"`
+	Email           string `json:"email" validate:"omitempty,email"`
+	CurrentPassword string `json:"currentPassword"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required"`
+}
+
+// ConfirmPasswordRequest confirms deactivating or deleting the account
+type ConfirmPasswordRequest struct {
+	Password string `json:"password" validate:"required"`
 }
 
 type LoginRequest struct {
@@ -27,14 +80,67 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+// LoginResponse holds the tokens of a login, or only an MFA challenge when the user has to enter
+// a second factor first
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	TokenPair
+	User User `json:"user"`
+
+	MFARequired  bool   `json:"mfaRequired,omitempty"`
+	MFAToken     string `json:"mfaToken,omitempty"` // Short-lived, exchanged for tokens with a code
+	MFAExpiresIn int64  `json:"mfaExpiresIn,omitempty"`
+}
+
+// TokenPair is a short-lived access token and the refresh token used to renew it
+type TokenPair struct {
+	Token            string    `json:"token"`
+	RefreshToken     string    `json:"refreshToken"`
+	ExpiresIn        int64     `json:"expiresIn"` // Seconds until the access token expires
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+
+	// Organization the access token acts in
+	OrganizationID primitive.ObjectID `json:"organizationId"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+type SwitchOrganizationRequest struct {
+	OrganizationID string `json:"organizationId" validate:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken,omitempty"` // Also ends the session of this refresh token
+}
+
+// RefreshToken is stored hashed. Each use replaces it with a new token of the same family,
+// and reusing a replaced token revokes the whole family.
+type RefreshToken struct {
+	ID         primitive.ObjectID  `json:"_id" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID  `json:"userId" bson:"userId"`
+	FamilyID   primitive.ObjectID  `json:"familyId" bson:"familyId"`    // Shared by the tokens of one login
+	OrgID      primitive.ObjectID  `json:"organizationId" bson:"orgId"` // Active organization of the login
+	TokenHash  string              `json:"-" bson:"tokenHash"`          // SHA-256 of the token, hex encoded
+	ExpiresAt  time.Time           `json:"expiresAt" bson:"expiresAt"`
+	RevokedAt  *time.Time          `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+	ReplacedBy *primitive.ObjectID `json:"replacedBy,omitempty" bson:"replacedBy,omitempty"`
+	CreatedAt  time.Time           `json:"created_at" bson:"created_at"`
+}
+
+// RevokedToken denies an access token by its ID until the token would have expired
+type RevokedToken struct {
+	ID        string             `bson:"_id"` // The jti claim
+	UserID    primitive.ObjectID `bson:"userId"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
 }
 
 type UserResponse struct {
-	ID       primitive.ObjectID `json:"_id"`
-	Email    string             `json:"email"`
-	Name     string             `json:"name"`
-	IsActive bool               `json:"isActive"`
+	ID            primitive.ObjectID `json:"_id"`
+	Email         string             `json:"email"`
+	Name          string             `json:"name"`
+	IsActive      bool               `json:"isActive"`
+	EmailVerified bool               `json:"emailVerified"`
+	PendingEmail  string             `json:"pendingEmail,omitempty"`
+	MFAEnabled    bool               `json:"mfaEnabled"`
 }
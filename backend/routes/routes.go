@@ -3,6 +3,7 @@ package routes
 import (
 	"contact-enrichment-api/controllers"
 	"contact-enrichment-api/middleware"
+	"contact-enrichment-api/models"
 	"contact-enrichment-api/services"
 
 	"github.com/gin-gonic/gin"
@@ -11,6 +12,14 @@ import (
 func SetupRoutes(
 	authService *services.AuthService,
 	contactService *services.ContactService,
+	templateService *services.MappingTemplateService,
+	importService *services.ImportService,
+	uploadService *services.UploadService,
+	exportService *services.ExportService,
+	apiKeyService *services.APIKeyService,
+	orgService *services.OrganizationService,
+	accountService *services.AccountService,
+	adminService *services.AdminService,
 ) *gin.Engine {
 	router := gin.Default()
 
@@ -20,6 +29,24 @@ func SetupRoutes(
 	// Create controllers
 	authController := controllers.NewAuthController(authService)
 	contactController := controllers.NewContactController(contactService)
+	templateController := controllers.NewMappingTemplateController(templateService)
+	importController := controllers.NewImportController(importService)
+	uploadController := controllers.NewUploadController(uploadService)
+	exportController := controllers.NewExportController(exportService)
+	apiKeyController := controllers.NewAPIKeyController(apiKeyService)
+	orgController := controllers.NewOrganizationController(orgService)
+	accountController := controllers.NewAccountController(accountService)
+	adminController := controllers.NewAdminController(adminService)
+
+	// Routes require a permission of the member's role, and API keys are also limited to their scopes
+	canRead := middleware.Authorize(models.ScopeContactsRead, models.PermissionContactsRead)
+	canWrite := middleware.Authorize(models.ScopeContactsWrite, models.PermissionContactsWrite)
+	canEnrich := middleware.Authorize(models.ScopeEnrich, models.PermissionContactsEnrich)
+	canExport := middleware.Authorize(models.ScopeExport, models.PermissionContactsExport)
+	canDelete := middleware.Authorize(models.ScopeContactsWrite, models.PermissionContactsDelete)
+
+	// Administrators acting as a user cannot change the user's credentials or memberships
+	noImpersonation := middleware.RejectImpersonation()
 
 	// API version 1 routes
 	v1 := router.Group("/api/v1")
@@ -29,6 +56,15 @@ func SetupRoutes(
 	{
 		auth.POST("/register", authController.Register)
 		auth.POST("/login", authController.Login)
+		auth.POST("/mfa", authController.CompleteMFALogin)
+		auth.POST("/refresh", authController.Refresh)
+		auth.POST("/verify-email", authController.VerifyEmail)
+		auth.POST("/resend-verification", authController.ResendVerification)
+		auth.POST("/forgot-password", authController.ForgotPassword)
+		auth.POST("/reset-password", authController.ResetPassword)
+		auth.POST("/confirm-email-change", accountController.ConfirmEmailChange)
+		auth.GET("/oidc/authorize", authController.OIDCAuthorize)
+		auth.POST("/oidc/callback", authController.OIDCCallback)
 	}
 
 	// Health check endpoint
@@ -39,24 +75,139 @@ func SetupRoutes(
 		})
 	})
 
+	// Public keys of the access tokens, at the well-known location other services look for them
+	router.GET("/.well-known/jwks.json", authController.JWKS)
+
+	// Export downloads are authorized by their signed link
+	v1.GET("/exports/:id/download", exportController.DownloadExport)
+
 	// Protected routes (authentication required)
 	protected := v1.Group("/")
-	protected.Use(middleware.AuthMiddleware(authService))
+	protected.Use(middleware.AuthMiddleware(authService, apiKeyService), middleware.AuditImpersonation(adminService))
 	{
-		// User profile routes
-		protected.GET("/profile", authController.GetProfile)
+		// Account routes are not available to API keys
+		account := protected.Group("/", middleware.RequireUserSession())
+		{
+			// User profile routes
+			account.GET("/profile", authController.GetProfile)
+			account.PATCH("/profile", noImpersonation, accountController.UpdateProfile)
+			account.DELETE("/profile", noImpersonation, accountController.DeleteAccount)
+			account.POST("/profile/password", noImpersonation, accountController.ChangePassword)
+			account.POST("/profile/deactivate", noImpersonation, accountController.DeactivateAccount)
+
+			// Two-factor authentication
+			account.POST("/profile/mfa/enroll", noImpersonation, authController.BeginMFAEnrollment)
+			account.POST("/profile/mfa/confirm", noImpersonation, authController.ConfirmMFAEnrollment)
+			account.POST("/profile/mfa/disable", noImpersonation, authController.DisableMFA)
+			account.POST("/profile/mfa/recovery-codes", noImpersonation, authController.RegenerateRecoveryCodes)
+			account.POST("/profile/oidc/link", noImpersonation, authController.OIDCLink)
+			account.POST("/profile/oidc/link/callback", noImpersonation, authController.OIDCLinkCallback)
+
+			// Session routes
+			account.POST("/auth/logout", authController.Logout)
+			account.POST("/auth/logout-all", noImpersonation, authController.LogoutAll)
+			account.POST("/auth/switch-organization", noImpersonation, authController.SwitchOrganization)
+
+			// API key management
+			account.POST("/api-keys", noImpersonation, apiKeyController.CreateAPIKey)
+			account.GET("/api-keys", apiKeyController.GetAPIKeys)
+			account.DELETE("/api-keys/:id", noImpersonation, apiKeyController.RevokeAPIKey)
+
+			// Organizations and their members
+			account.POST("/organizations", noImpersonation, orgController.CreateOrganization)
+			account.GET("/organizations", orgController.GetOrganizations)
+			account.GET("/organizations/:id", orgController.GetOrganization)
+			account.PUT("/organizations/:id", noImpersonation, orgController.UpdateOrganization)
+			account.GET("/organizations/:id/members", orgController.GetMembers)
+			account.GET("/organizations/:id/invitations", orgController.GetInvitations)
+			account.POST("/organizations/:id/invitations", noImpersonation, orgController.InviteMember)
+			account.DELETE("/organizations/:id/invitations/:invitationId", noImpersonation, orgController.RevokeInvitation)
+			account.PUT("/organizations/:id/members/:userId", noImpersonation, orgController.UpdateMember)
+			account.DELETE("/organizations/:id/members/:userId", noImpersonation, orgController.RemoveMember)
+
+			// Invitations of the user's email address
+			account.GET("/invitations", orgController.GetUserInvitations)
+			account.POST("/invitations/:id/accept", noImpersonation, orgController.AcceptInvitation)
+			account.DELETE("/invitations/:id", noImpersonation, orgController.DeclineInvitation)
+		}
+
+		// User management, for administrators only
+		admin := protected.Group("/admin", middleware.RequireUserSession(), noImpersonation, middleware.RequireAdmin(authService))
+		{
+			admin.GET("/users", adminController.ListUsers)
+			admin.GET("/users/:id", adminController.GetUser)
+			admin.POST("/users/:id/deactivate", adminController.DeactivateUser)
+			admin.POST("/users/:id/reactivate", adminController.ReactivateUser)
+			admin.POST("/users/:id/reset-password", adminController.ForcePasswordReset)
+			admin.POST("/users/:id/revoke-sessions", adminController.RevokeSessions)
+			admin.POST("/users/:id/impersonate", adminController.Impersonate)
+			admin.GET("/audit-log", adminController.GetAuditLog)
+		}
 
 		// Contact routes
 		contacts := protected.Group("/contacts")
 		{
-			contacts.POST("", contactController.CreateContact)
-			contacts.POST("/bulk", contactController.BulkCreateContacts)
-			contacts.POST("/bulk-enhanced", contactController.EnhancedBulkCreateContacts)
-			contacts.GET("", contactController.GetContacts)
-			contacts.GET("/stats", contactController.GetContactStats)
-			contacts.GET("/:id", contactController.GetContactByID)
-			contacts.POST("/:id/enrich", contactController.EnrichContact)
-			contacts.POST("/enrich-bulk", contactController.BulkEnrichContacts)
+			contacts.POST("", canWrite, contactController.CreateContact)
+			contacts.POST("/bulk", canWrite, contactController.BulkCreateContacts)
+			contacts.POST("/bulk-enhanced", canWrite, contactController.EnhancedBulkCreateContacts)
+			contacts.POST("/stream", canWrite, contactController.StreamCreateContacts)
+			contacts.GET("", canRead, contactController.GetContacts)
+			contacts.GET("/stats", canRead, contactController.GetContactStats)
+			contacts.GET("/export", canExport, contactController.ExportContacts)
+			contacts.GET("/:id", canRead, contactController.GetContactByID)
+			contacts.POST("/:id/enrich", canEnrich, contactController.EnrichContact)
+			contacts.POST("/enrich-bulk", canEnrich, contactController.BulkEnrichContacts)
+		}
+
+		// Import history and rollback
+		imports := protected.Group("/imports")
+		{
+			imports.GET("", canRead, importController.GetImports)
+			imports.GET("/:id", canRead, importController.GetImportByID)
+			imports.GET("/:id/errors.csv", canRead, importController.DownloadErrorReport)
+			imports.POST("/:id/rollback", canDelete, importController.RollbackImport)
+		}
+
+		// Built-in mappings for well-known export formats
+		protected.GET("/import-presets", canRead, importController.GetImportPresets)
+
+		// Resumable uploads of large import files
+		uploads := protected.Group("/uploads", canWrite)
+		{
+			uploads.POST("", uploadController.CreateUpload)
+			uploads.GET("/:id", uploadController.GetUpload)
+			uploads.HEAD("/:id", uploadController.GetUploadOffset)
+			uploads.PATCH("/:id", uploadController.UploadChunk)
+			uploads.DELETE("/:id", uploadController.DeleteUpload)
+		}
+
+		// Background exports and their schedules
+		exports := protected.Group("/exports", canExport)
+		{
+			exports.POST("", exportController.CreateExportJob)
+			exports.GET("", exportController.GetExportJobs)
+			exports.GET("/:id", exportController.GetExportJob)
+			exports.DELETE("/:id", exportController.DeleteExportJob)
+		}
+
+		schedules := protected.Group("/export-schedules", canExport)
+		{
+			schedules.POST("", exportController.CreateSchedule)
+			schedules.GET("", exportController.GetSchedules)
+			schedules.GET("/:id", exportController.GetSchedule)
+			schedules.PUT("/:id", exportController.UpdateSchedule)
+			schedules.DELETE("/:id", exportController.DeleteSchedule)
+		}
+
+		// Saved field mapping templates
+		templates := protected.Group("/mapping-templates")
+		{
+			templates.POST("", canWrite, templateController.CreateTemplate)
+			templates.GET("", canRead, templateController.GetTemplates)
+			templates.POST("/match", canRead, templateController.MatchTemplates)
+			templates.GET("/:id", canRead, templateController.GetTemplateByID)
+			templates.PUT("/:id", canWrite, templateController.UpdateTemplate)
+			templates.DELETE("/:id", canWrite, templateController.DeleteTemplate)
 		}
 	}
 
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"contact-enrichment-api/config"
+	"contact-enrichment-api/mailer"
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors of self-service account changes
+var (
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+	ErrPasswordRequired  = errors.New("the current password is required to change the email")
+)
+
+// userScopedCollections hold data of a user outside of organizations, deleted with the account
+var userScopedCollections = []string{"api_keys", "mapping_templates", "refresh_tokens", "revoked_tokens", "account_tokens", "memberships"}
+
+// AccountService lets users manage their own account: profile, password, deactivation and deletion
+type AccountService struct {
+	db            *mongo.Database
+	authService   *AuthService
+	orgService    *OrganizationService
+	uploadService *UploadService
+	exportService *ExportService
+	config        *config.Config
+}
+
+func NewAccountService(db *mongo.Database, cfg *config.Config, authService *AuthService, orgService *OrganizationService, uploadService *UploadService, exportService *ExportService) *AccountService {
+	return &AccountService{
+		db:            db,
+		authService:   authService,
+		orgService:    orgService,
+		uploadService: uploadService,
+		exportService: exportService,
+		config:        cfg,
+	}
+}
+
+// UpdateProfile changes the name right away. A new email is only requested: a confirmation link is
+// sent to it, and the current address keeps working until the link is followed.
+func (s *AccountService) UpdateProfile(userID string, req models.UpdateProfileRequest, clientIP string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	user, err := s.authService.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		set["name"] = name
+	}
+
+	email := strings.TrimSpace(req.Email)
+	changesEmail := email != "" && email != user.Email
+	if changesEmail {
+		if req.CurrentPassword == "" {
+			return nil, ErrPasswordRequired
+		}
+		if err := s.authService.checkPassword(ctx, user, req.CurrentPassword, clientIP); err != nil {
+			return nil, err
+		}
+
+		count, err := s.authService.userCollection.CountDocuments(ctx, bson.M{"email": email})
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, ErrEmailTaken
+		}
+		set["pendingEmail"] = email
+	}
+
+	err = s.authService.userCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if changesEmail {
+		if err := s.sendEmailChange(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// ConfirmEmailChange replaces the email of a user with the new address a confirmation link was sent to
+func (s *AccountService) ConfirmEmailChange(token string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	accountToken, err := s.authService.consumeAccountToken(ctx, models.AccountTokenEmailChange, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the latest requested address can be confirmed
+	now := time.Now()
+	var user models.User
+	err = s.authService.userCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": accountToken.UserID, "pendingEmail": accountToken.Email},
+		bson.M{
+			"$set":   bson.M{"email": accountToken.Email, "emailVerified": true, "emailVerifiedAt": now, "updated_at": now},
+			"$unset": bson.M{"pendingEmail": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidAccountToken
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// ChangePassword sets a new password after checking the current one. Every other session is signed
+// out, and the returned tokens continue the current one in its organization.
+func (s *AccountService) ChangePassword(userID, orgID string, req models.ChangePasswordRequest, clientIP string) (*models.TokenPair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	user, err := s.authService.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authService.checkPassword(ctx, user, req.CurrentPassword, clientIP); err != nil {
+		return nil, err
+	}
+
+	if err := s.authService.validatePassword(req.NewPassword, user.Email, user.Name); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.authService.hashPassword(req.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.authService.userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"password": hashedPassword, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authService.RevokeAllSessions(userID); err != nil {
+		return nil, err
+	}
+
+	// Reload for the token version that RevokeAllSessions incremented
+	user, err = s.authService.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	membership, err := s.authService.activeMembership(ctx, user, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	logMailError("password change", user, s.authService.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nThe password of your account was changed and your other sessions were signed out.\n\n"+
+			"If this was not you, reset your password right away:\n\n%s\n",
+			user.Name, s.config.AppURL+"/forgot-password"),
+	}))
+
+	return s.authService.issueTokens(ctx, user, membership.OrgID, primitive.NewObjectID(), primitive.NewObjectID())
+}
+
+// DeactivateAccount disables the account after checking the password. Every session and API key
+// stops working until an administrator reactivates the account; the data is kept.
+func (s *AccountService) DeactivateAccount(userID, password, clientIP string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	user, err := s.authService.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.authService.checkPassword(ctx, user, password, clientIP); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = s.authService.userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"isActive": false, "deactivatedAt": now, "updated_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+
+	return s.authService.RevokeAllSessions(userID)
+}
+
+// DeleteAccount deletes the user after checking the password, with their organizations that have no
+// other members and everything in them. In organizations shared with others, the contacts and
+// imports stay with the organization, while the uploads, exports and schedules of the user are deleted.
+// The request is recorded first, so a deletion that fails halfway is finished by the deletion sweep.
+func (s *AccountService) DeleteAccount(userID, password, clientIP string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.BulkOperationTimeout)
+	defer cancel()
+
+	user, err := s.authService.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.authService.checkPassword(ctx, user, password, clientIP); err != nil {
+		return err
+	}
+
+	orgIDs, err := s.orgService.soleOrganizations(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	// Deactivate first, so the account cannot be used while its data is deleted
+	now := time.Now()
+	_, err = s.authService.userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{
+			"isActive":            false,
+			"deactivatedAt":       now,
+			"deletionRequestedAt": now,
+			"deletionOrgIds":      orgIDs,
+			"updated_at":          now,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if err := s.authService.RevokeAllSessions(userID); err != nil {
+		return err
+	}
+
+	user.DeletionOrgIDs = orgIDs
+	if err := s.finishDeletion(ctx, user); err != nil {
+		log.Printf("Failed to delete user %s, the deletion sweep retries: %v", user.ID.Hex(), err)
+	}
+	return nil
+}
+
+// StartDeletionSweep finishes the deletion of accounts whose deletion request failed halfway, now
+// and then every interval
+func (s *AccountService) StartDeletionSweep(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.sweepDeletions(); err != nil {
+				log.Printf("Failed to finish account deletions: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *AccountService) sweepDeletions() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.BulkOperationTimeout)
+	defer cancel()
+
+	// Deletions that are still running in their request are left alone
+	cutoff := time.Now().Add(-s.config.BulkOperationTimeout)
+	cursor, err := s.authService.userCollection.Find(ctx, bson.M{"deletionRequestedAt": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return err
+	}
+
+	for i := range users {
+		if err := s.finishDeletion(ctx, &users[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishDeletion deletes the data of a user whose deletion was requested, and the user last. Every
+// step can run again, so a deletion that failed halfway is finished by running it once more.
+func (s *AccountService) finishDeletion(ctx context.Context, user *models.User) error {
+	orgIDs := user.DeletionOrgIDs
+	owned := bson.M{"$or": bson.A{
+		bson.M{"userId": user.ID},
+		bson.M{"orgId": bson.M{"$in": orgIDs}},
+	}}
+	if err := s.uploadService.deleteUploads(ctx, owned); err != nil {
+		return err
+	}
+	if err := s.exportService.deleteJobs(ctx, owned); err != nil {
+		return err
+	}
+	if _, err := s.exportService.scheduleCollection.DeleteMany(ctx, owned); err != nil {
+		return err
+	}
+
+	if err := s.orgService.deleteOrganizations(ctx, orgIDs); err != nil {
+		return err
+	}
+
+	for _, name := range userScopedCollections {
+		if _, err := s.db.Collection(name).DeleteMany(ctx, bson.M{"userId": user.ID}); err != nil {
+			return err
+		}
+	}
+	if _, err := s.authService.oidcStateCollection.DeleteMany(ctx, bson.M{"linkUserId": user.ID}); err != nil {
+		return err
+	}
+	s.authService.clearLoginFailures(ctx, user.Email)
+
+	if _, err := s.authService.userCollection.DeleteOne(ctx, bson.M{"_id": user.ID}); err != nil {
+		return err
+	}
+
+	log.Printf("Deleted user %s with %d organizations", user.ID.Hex(), len(orgIDs))
+	return nil
+}
+
+// sendEmailChange sends the confirmation link to the new address and tells the current address about the change
+func (s *AccountService) sendEmailChange(ctx context.Context, user *models.User) error {
+	token, err := s.authService.issueAccountToken(ctx, user, user.PendingEmail, models.AccountTokenEmailChange, s.config.EmailVerificationExpiration)
+	if err != nil {
+		return err
+	}
+
+	err = s.authService.mailer.Send(ctx, mailer.Message{
+		To:      user.PendingEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm the new email address of your account by opening this link:\n\n%s\n\n"+
+			"The link expires in %s. Until then you keep signing in with your current address.\n",
+			user.Name, s.authService.accountLink("/confirm-email", token), s.config.EmailVerificationExpiration),
+	})
+	if err != nil {
+		return err
+	}
+
+	logMailError("email change notice", user, s.authService.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nA change of the email address of your account to %s was requested. "+
+			"It takes effect once confirmed from the new address.\n\n"+
+			"If this was not you, change your password right away:\n\n%s\n",
+			user.Name, user.PendingEmail, s.config.AppURL+"/forgot-password"),
+	}))
+	return nil
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"contact-enrichment-api/mailer"
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidAccountToken is returned for verification and reset tokens that are unknown, expired or used
+var ErrInvalidAccountToken = errors.New("invalid or expired token")
+
+// SendVerificationEmail sends a new verification link to a user who has not verified their email.
+// Unknown and verified addresses are ignored so the response does not reveal which accounts exist.
+func (s *AuthService) SendVerificationEmail(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	var user models.User
+	err := s.userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified || !user.IsActive {
+		return nil
+	}
+
+	return s.sendVerificationEmail(ctx, &user)
+}
+
+// VerifyEmail marks the address a verification token was sent to as verified
+func (s *AuthService) VerifyEmail(token string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	accountToken, err := s.consumeAccountToken(ctx, models.AccountTokenEmailVerification, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// The token only verifies the address it was sent to, not one the user changed to since
+	now := time.Now()
+	var user models.User
+	err = s.userCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": accountToken.UserID, "email": accountToken.Email},
+		bson.M{"$set": bson.M{"emailVerified": true, "emailVerifiedAt": now, "updated_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// RequestPasswordReset emails a password reset link. Like SendVerificationEmail it succeeds
+// for unknown addresses.
+func (s *AuthService) RequestPasswordReset(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	var user models.User
+	err := s.userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.IsActive {
+		return nil
+	}
+
+	return s.sendPasswordReset(ctx, &user, false)
+}
+
+// sendPasswordReset emails a password reset link to the user. A forced reset was started by an
+// administrator, and the current password no longer works.
+func (s *AuthService) sendPasswordReset(ctx context.Context, user *models.User, forced bool) error {
+	token, err := s.issueAccountToken(ctx, user, user.Email, models.AccountTokenPasswordReset, s.config.PasswordResetExpiration)
+	if err != nil {
+		return err
+	}
+
+	intro := "Reset your password by opening this link:"
+	note := "If you did not ask for a password reset, you can ignore this email."
+	if forced {
+		intro = "An administrator reset your password. Choose a new one by opening this link:"
+		note = "Until then you cannot sign in with a password."
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n%s\n\n%s\n\nThe link expires in %s. %s\n",
+			user.Name, intro, s.accountLink("/reset-password", token), s.config.PasswordResetExpiration, note),
+	})
+}
+
+// ResetPassword sets a new password with a reset token, unlocks the login and signs the user out of every device
+func (s *AuthService) ResetPassword(token, password string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	accountToken, err := s.findAccountToken(ctx, models.AccountTokenPasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	// Checked before the token is used up, so a rejected password can be replaced with another
+	if err := s.validatePassword(password, accountToken.Email, ""); err != nil {
+		return err
+	}
+	if err := s.claimAccountToken(ctx, accountToken); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// Following the emailed link also proves the address belongs to the user
+	now := time.Now()
+	result, err := s.userCollection.UpdateOne(ctx,
+		bson.M{"_id": accountToken.UserID, "email": accountToken.Email},
+		bson.M{"$set": bson.M{
+			"password":        hashedPassword,
+			"emailVerified":   true,
+			"emailVerifiedAt": now,
+			"updated_at":      now,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidAccountToken
+	}
+
+	// A reset unlocks logins that were locked after failed attempts
+	s.clearLoginFailures(ctx, accountToken.Email)
+
+	return s.RevokeAllSessions(accountToken.UserID.Hex())
+}
+
+// MigrateEmailVerification marks users who registered before email verification existed as verified
+func (s *AuthService) MigrateEmailVerification() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.BulkOperationTimeout)
+	defer cancel()
+
+	_, err := s.userCollection.UpdateMany(ctx,
+		bson.M{"emailVerified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"emailVerified": true}},
+	)
+	return err
+}
+
+func (s *AuthService) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := s.issueAccountToken(ctx, user, user.Email, models.AccountTokenEmailVerification, s.config.EmailVerificationExpiration)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.\n",
+			user.Name, s.accountLink("/verify-email", token), s.config.EmailVerificationExpiration),
+	})
+}
+
+// issueAccountToken stores a token for an email of the user, replacing unused tokens of the same purpose
+func (s *AuthService) issueAccountToken(ctx context.Context, user *models.User, email string, purpose models.AccountTokenPurpose, validity time.Duration) (string, error) {
+	now := time.Now()
+	if _, err := s.accountTokenCollection.UpdateMany(ctx,
+		bson.M{"userId": user.ID, "purpose": purpose, "usedAt": nil},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	); err != nil {
+		return "", err
+	}
+
+	accountToken := models.AccountToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: now.Add(validity),
+		CreatedAt: now,
+	}
+	if _, err := s.accountTokenCollection.InsertOne(ctx, accountToken); err != nil {
+		return "", err
+	}
+
+	return s.signAccountToken(&accountToken), nil
+}
+
+// consumeAccountToken verifies a token and marks it used, so each token works once
+func (s *AuthService) consumeAccountToken(ctx context.Context, purpose models.AccountTokenPurpose, token string) (*models.AccountToken, error) {
+	accountToken, err := s.findAccountToken(ctx, purpose, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.claimAccountToken(ctx, accountToken); err != nil {
+		return nil, err
+	}
+	return accountToken, nil
+}
+
+// findAccountToken verifies a token without using it up
+func (s *AuthService) findAccountToken(ctx context.Context, purpose models.AccountTokenPurpose, token string) (*models.AccountToken, error) {
+	id, _, found := strings.Cut(token, ".")
+	if !found {
+		return nil, ErrInvalidAccountToken
+	}
+	tokenObjectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidAccountToken
+	}
+
+	var accountToken models.AccountToken
+	err = s.accountTokenCollection.FindOne(ctx, bson.M{"_id": tokenObjectID, "purpose": purpose}).Decode(&accountToken)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(token), []byte(s.signAccountToken(&accountToken))) ||
+		time.Now().After(accountToken.ExpiresAt) || accountToken.UsedAt != nil {
+		return nil, ErrInvalidAccountToken
+	}
+
+	return &accountToken, nil
+}
+
+// claimAccountToken marks a verified token used, atomically so it cannot be used twice concurrently
+func (s *AuthService) claimAccountToken(ctx context.Context, accountToken *models.AccountToken) error {
+	result, err := s.accountTokenCollection.UpdateOne(ctx,
+		bson.M{"_id": accountToken.ID, "usedAt": nil},
+		bson.M{"$set": bson.M{"usedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrInvalidAccountToken
+	}
+	return nil
+}
+
+// signAccountToken returns the token of a stored account token: its ID and a signature of its contents
+func (s *AuthService) signAccountToken(accountToken *models.AccountToken) string {
+	mac := hmac.New(sha256.New, []byte(s.config.AccountTokenSigningKey))
+	mac.Write([]byte(strings.Join([]string{
+		accountToken.ID.Hex(),
+		accountToken.UserID.Hex(),
+		string(accountToken.Purpose),
+		accountToken.Email,
+		strconv.FormatInt(accountToken.ExpiresAt.Unix(), 10),
+	}, "|")))
+	return accountToken.ID.Hex() + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// accountLink builds a link to a page of the frontend that receives the token
+func (s *AuthService) accountLink(path, token string) string {
+	return s.config.AppURL + path + "?token=" + token
+}
+
+// logMailError reports emails that could not be sent, for flows that must not fail because of them
+func logMailError(kind string, user *models.User, err error) {
+	if err != nil {
+		log.Printf("Failed to send %s email to user %s: %v", kind, user.ID.Hex(), err)
+	}
+}
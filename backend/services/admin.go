@@ -0,0 +1,514 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"regexp"
+	"time"
+
+	"contact-enrichment-api/config"
+	"contact-enrichment-api/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors of the administration API
+var (
+	ErrUserNotFound           = errors.New("user not found")
+	ErrAdminSelfAction        = errors.New("administrators cannot do this to their own account")
+	ErrCannotImpersonateAdmin = errors.New("administrators cannot be impersonated")
+	ErrAccountDeletionPending = errors.New("the account is being deleted")
+)
+
+// AdminService lets administrators manage users. Every change is recorded in the audit log.
+type AdminService struct {
+	db              *mongo.Database
+	userCollection  *mongo.Collection
+	auditCollection *mongo.Collection
+	authService     *AuthService
+	orgService      *OrganizationService
+	config          *config.Config
+}
+
+func NewAdminService(db *mongo.Database, cfg *config.Config, authService *AuthService, orgService *OrganizationService) *AdminService {
+	return &AdminService{
+		db:              db,
+		userCollection:  db.Collection("users"),
+		auditCollection: db.Collection("admin_audit_log"),
+		authService:     authService,
+		orgService:      orgService,
+		config:          cfg,
+	}
+}
+
+// ListUsers returns a page of users, newest first, searched by name or email. Status is
+// "active", "inactive" or empty for both.
+func (s *AdminService) ListUsers(page, pageSize int, search, status string) (*models.AdminUserListResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	filter := bson.M{}
+	if search != "" {
+		pattern := regexp.QuoteMeta(search)
+		filter["$or"] = []bson.M{
+			{"name": bson.M{"$regex": pattern, "$options": "i"}},
+			{"email": bson.M{"$regex": pattern, "$options": "i"}},
+		}
+	}
+	switch status {
+	case "active":
+		filter["isActive"] = true
+	case "inactive":
+		filter["isActive"] = false
+	}
+
+	total, err := s.userCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize)).
+		SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := s.userCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]primitive.ObjectID, len(users))
+	for i := range users {
+		userIDs[i] = users[i].ID
+	}
+	contactCounts, err := s.contactCounts(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.AdminUserResponse, len(users))
+	for i := range users {
+		responses[i] = s.adminUserResponse(&users[i])
+		responses[i].Contacts = contactCounts[users[i].ID]
+	}
+
+	return &models.AdminUserListResponse{
+		Users:      responses,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: int(math.Ceil(float64(total) / float64(pageSize))),
+	}, nil
+}
+
+// GetUser returns a user with their usage
+func (s *AdminService) GetUser(userID string) (*models.AdminUserResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := s.usage(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := s.adminUserResponse(user)
+	response.Contacts = usage.Contacts
+	response.Usage = usage
+	return &response, nil
+}
+
+// DeactivateUser disables an account and signs it out everywhere, its data is kept
+func (s *AdminService) DeactivateUser(adminID, userID, reason, clientIP string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	admin, user, err := s.findTarget(ctx, adminID, userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = s.userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"isActive": false, "deactivatedAt": now, "updated_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if err := s.authService.RevokeAllSessions(userID); err != nil {
+		return err
+	}
+
+	return s.recordAction(ctx, admin, models.AdminActionDeactivate, user, reason, clientIP)
+}
+
+// ReactivateUser lets a deactivated account sign in again
+func (s *AdminService) ReactivateUser(adminID, userID, reason, clientIP string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	admin, user, err := s.findTarget(ctx, adminID, userID)
+	if err != nil {
+		return err
+	}
+
+	// Accounts whose deletion was requested stay deactivated until the deletion sweep removes them
+	if user.DeletionRequestedAt != nil {
+		return ErrAccountDeletionPending
+	}
+
+	result, err := s.userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "deletionRequestedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"isActive": true, "updated_at": time.Now()}, "$unset": bson.M{"deactivatedAt": ""}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrAccountDeletionPending
+	}
+
+	return s.recordAction(ctx, admin, models.AdminActionReactivate, user, reason, clientIP)
+}
+
+// ForcePasswordReset replaces the password with an unknown one, signs the user out everywhere and
+// emails them a reset link
+func (s *AdminService) ForcePasswordReset(adminID, userID, reason, clientIP string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	admin, user, err := s.findTarget(ctx, adminID, userID)
+	if err != nil {
+		return err
+	}
+
+	password, err := randomURLSafe(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := s.authService.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"password": hashedPassword, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if err := s.authService.RevokeAllSessions(userID); err != nil {
+		return err
+	}
+
+	if err := s.recordAction(ctx, admin, models.AdminActionForcePasswordReset, user, reason, clientIP); err != nil {
+		return err
+	}
+
+	return s.authService.sendPasswordReset(ctx, user, true)
+}
+
+// RevokeSessions signs a user out of every device
+func (s *AdminService) RevokeSessions(adminID, userID, reason, clientIP string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	admin, user, err := s.findTarget(ctx, adminID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.authService.RevokeAllSessions(userID); err != nil {
+		return err
+	}
+
+	return s.recordAction(ctx, admin, models.AdminActionRevokeSessions, user, reason, clientIP)
+}
+
+// Impersonate issues a short-lived access token of the user that names the administrator. It has no
+// refresh token, and every request made with it is recorded in the audit log.
+func (s *AdminService) Impersonate(adminID, userID string, req models.ImpersonateRequest, clientIP string) (*models.ImpersonationResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	admin, user, err := s.findTarget(ctx, adminID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrAccountDeactivated
+	}
+	if s.authService.IsAdmin(user) {
+		return nil, ErrCannotImpersonateAdmin
+	}
+
+	var orgID primitive.ObjectID
+	if req.OrganizationID != "" {
+		if orgID, err = primitive.ObjectIDFromHex(req.OrganizationID); err != nil {
+			return nil, ErrOrganizationNotFound
+		}
+	}
+	membership, err := s.orgService.ResolveMembership(ctx, user, orgID)
+	if err != nil {
+		if errors.Is(err, ErrNotOrgMember) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	claims := Claims{
+		UserID:         user.ID.Hex(),
+		Email:          user.Email,
+		OrgID:          membership.OrgID.Hex(),
+		TokenVersion:   user.TokenVersion,
+		ImpersonatorID: admin.ID.Hex(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.ImpersonationExpiration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	// Recorded before the token is handed out, so no impersonation goes unaudited
+	err = s.record(ctx, &models.AuditLogEntry{
+		AdminID:      admin.ID,
+		AdminEmail:   admin.Email,
+		Action:       models.AdminActionImpersonate,
+		TargetUserID: user.ID,
+		Reason:       req.Reason,
+		IPAddress:    clientIP,
+		TokenID:      claims.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.authService.signToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ImpersonationResponse{
+		Token:          token,
+		ExpiresIn:      int64(s.config.ImpersonationExpiration.Seconds()),
+		OrganizationID: membership.OrgID,
+		User: models.UserResponse{
+			ID:            user.ID,
+			Email:         user.Email,
+			Name:          user.Name,
+			IsActive:      user.IsActive,
+			EmailVerified: user.EmailVerified,
+			MFAEnabled:    user.MFAEnabled,
+		},
+	}, nil
+}
+
+// RecordImpersonatedRequest adds a request made with an impersonation token to the audit log
+func (s *AdminService) RecordImpersonatedRequest(adminID, userID, tokenID, method, path string, statusCode int, clientIP string) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	adminObjectID, _ := primitive.ObjectIDFromHex(adminID)
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	err := s.record(ctx, &models.AuditLogEntry{
+		AdminID:      adminObjectID,
+		Action:       models.AdminActionImpersonatedCall,
+		TargetUserID: userObjectID,
+		IPAddress:    clientIP,
+		TokenID:      tokenID,
+		Method:       method,
+		Path:         path,
+		StatusCode:   statusCode,
+	})
+	if err != nil {
+		log.Printf("Failed to record impersonated request of admin %s: %v", adminID, err)
+	}
+}
+
+// GetAuditLog returns a page of the audit log, newest first, optionally of one admin, target user or action
+func (s *AdminService) GetAuditLog(page, pageSize int, adminID, targetUserID, action string) (*models.AuditLogListResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	filter := bson.M{}
+	if adminID != "" {
+		adminObjectID, err := primitive.ObjectIDFromHex(adminID)
+		if err != nil {
+			return nil, errors.New("invalid admin ID")
+		}
+		filter["adminId"] = adminObjectID
+	}
+	if targetUserID != "" {
+		userObjectID, err := primitive.ObjectIDFromHex(targetUserID)
+		if err != nil {
+			return nil, errors.New("invalid user ID")
+		}
+		filter["targetUserId"] = userObjectID
+	}
+	if action != "" {
+		filter["action"] = action
+	}
+
+	total, err := s.auditCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize)).
+		SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := s.auditCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	entries := []models.AuditLogEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return &models.AuditLogListResponse{
+		Entries:    entries,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: int(math.Ceil(float64(total) / float64(pageSize))),
+	}, nil
+}
+
+// findTarget returns the acting administrator and the user they act on, who must be someone else
+func (s *AdminService) findTarget(ctx context.Context, adminID, userID string) (*models.User, *models.User, error) {
+	if adminID == userID {
+		return nil, nil, ErrAdminSelfAction
+	}
+
+	admin, err := s.findUser(ctx, adminID)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return admin, user, nil
+}
+
+func (s *AdminService) findUser(ctx context.Context, userID string) (*models.User, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	var user models.User
+	if err := s.userCollection.FindOne(ctx, bson.M{"_id": userObjectID}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// contactCounts counts the contacts each of the users created
+func (s *AdminService) contactCounts(ctx context.Context, userIDs []primitive.ObjectID) (map[primitive.ObjectID]int64, error) {
+	counts := make(map[primitive.ObjectID]int64, len(userIDs))
+	if len(userIDs) == 0 {
+		return counts, nil
+	}
+
+	cursor, err := s.db.Collection("contacts").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"userId": bson.M{"$in": userIDs}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$userId", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		UserID primitive.ObjectID `bson:"_id"`
+		Count  int64              `bson:"count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		counts[result.UserID] = result.Count
+	}
+	return counts, nil
+}
+
+// usage counts what the user created and the credentials they can still use
+func (s *AdminService) usage(ctx context.Context, userID primitive.ObjectID) (*models.UserUsage, error) {
+	now := time.Now()
+	usage := &models.UserUsage{}
+	counts := []struct {
+		collection string
+		filter     bson.M
+		count      *int64
+	}{
+		{"memberships", bson.M{"userId": userID}, &usage.Organizations},
+		{"contacts", bson.M{"userId": userID}, &usage.Contacts},
+		{"imports", bson.M{"userId": userID}, &usage.Imports},
+		{"exports", bson.M{"userId": userID}, &usage.Exports},
+		{"api_keys", bson.M{"userId": userID, "revokedAt": nil, "$or": bson.A{
+			bson.M{"expiresAt": nil},
+			bson.M{"expiresAt": bson.M{"$gt": now}},
+		}}, &usage.ActiveAPIKeys},
+		{"refresh_tokens", bson.M{"userId": userID, "revokedAt": nil, "expiresAt": bson.M{"$gt": now}}, &usage.ActiveSessions},
+	}
+
+	for _, c := range counts {
+		count, err := s.db.Collection(c.collection).CountDocuments(ctx, c.filter)
+		if err != nil {
+			return nil, err
+		}
+		*c.count = count
+	}
+	return usage, nil
+}
+
+func (s *AdminService) adminUserResponse(user *models.User) models.AdminUserResponse {
+	return models.AdminUserResponse{
+		User:      *user,
+		IsAdmin:   s.authService.IsAdmin(user),
+		SSOLinked: user.OIDCSubject != "",
+	}
+}
+
+// recordAction adds an action of an administrator on a user to the audit log
+func (s *AdminService) recordAction(ctx context.Context, admin *models.User, action models.AdminAction, user *models.User, reason, clientIP string) error {
+	return s.record(ctx, &models.AuditLogEntry{
+		AdminID:      admin.ID,
+		AdminEmail:   admin.Email,
+		Action:       action,
+		TargetUserID: user.ID,
+		Reason:       reason,
+		IPAddress:    clientIP,
+	})
+}
+
+// record adds an entry to the audit log
+func (s *AdminService) record(ctx context.Context, entry *models.AuditLogEntry) error {
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = time.Now()
+	_, err := s.auditCollection.InsertOne(ctx, entry)
+	return err
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"contact-enrichment-api/config"
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidAPIKey is returned for unknown, revoked and expired API keys
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// Last-used tracking is written at most this often per key
+const apiKeyUsageInterval = time.Minute
+
+type APIKeyService struct {
+	apiKeyCollection *mongo.Collection
+	authService      *AuthService
+	orgService       *OrganizationService
+	config           *config.Config
+}
+
+func NewAPIKeyService(db *mongo.Database, cfg *config.Config, authService *AuthService, orgService *OrganizationService) *APIKeyService {
+	return &APIKeyService{
+		apiKeyCollection: db.Collection("api_keys"),
+		authService:      authService,
+		orgService:       orgService,
+		config:           cfg,
+	}
+}
+
+// CreateAPIKey generates a key for the user that acts in the given organization.
+// The key is returned once and only its hash is kept.
+func (s *APIKeyService) CreateAPIKey(orgID, userID string, req models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, errors.New("invalid organization ID")
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, errors.New("expiresAt must be in the future")
+	}
+
+	keyType := req.Type
+	if keyType == "" {
+		keyType = models.APIKeyTypePersonal
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	key := models.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	apiKey := models.APIKey{
+		ID:        primitive.NewObjectID(),
+		OrgID:     orgObjectID,
+		UserID:    userObjectID,
+		Name:      req.Name,
+		Type:      keyType,
+		Prefix:    key[:len(models.APIKeyPrefix)+8],
+		KeyHash:   hashToken(key),
+		Scopes:    uniqueStrings(req.Scopes),
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := s.apiKeyCollection.InsertOne(ctx, apiKey); err != nil {
+		return nil, err
+	}
+
+	return &models.CreateAPIKeyResponse{APIKey: apiKey, Key: key}, nil
+}
+
+func (s *APIKeyService) GetAPIKeys(userID string) ([]models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := s.apiKeyCollection.Find(ctx, bson.M{"userId": userObjectID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey disables a key immediately. Revoked keys stay listed for auditing.
+func (s *APIKeyService) RevokeAPIKey(userID, keyID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	keyObjectID, err := primitive.ObjectIDFromHex(keyID)
+	if err != nil {
+		return errors.New("API key not found")
+	}
+
+	result, err := s.apiKeyCollection.UpdateOne(ctx,
+		bson.M{"_id": keyObjectID, "userId": userObjectID},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("API key not found")
+	}
+
+	return nil
+}
+
+// Authenticate resolves an API key to its record, checking that the key and its user are usable
+// and that the user is still a member of the key's organization
+func (s *APIKeyService) Authenticate(key, clientIP string) (*models.APIKey, *models.Membership, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	if !strings.HasPrefix(key, models.APIKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var apiKey models.APIKey
+	if err := s.apiKeyCollection.FindOne(ctx, bson.M{"keyHash": hashToken(key)}).Decode(&apiKey); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if !apiKey.IsUsable(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.authService.GetUserByID(apiKey.UserID.Hex())
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if !user.IsActive {
+		return nil, nil, ErrAccountDeactivated
+	}
+
+	membership, err := s.orgService.ResolveMembership(ctx, user, apiKey.OrgID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.recordUsage(ctx, &apiKey, clientIP, now)
+
+	return &apiKey, membership, nil
+}
+
+// recordUsage updates the last use of a key, skipping the write when it was recorded recently
+func (s *APIKeyService) recordUsage(ctx context.Context, apiKey *models.APIKey, clientIP string, now time.Time) {
+	if apiKey.LastUsedAt != nil && now.Sub(*apiKey.LastUsedAt) < apiKeyUsageInterval && apiKey.LastUsedIP == clientIP {
+		return
+	}
+
+	_, err := s.apiKeyCollection.UpdateOne(ctx,
+		bson.M{"_id": apiKey.ID},
+		bson.M{"$set": bson.M{"lastUsedAt": now, "lastUsedIp": clientIP}},
+	)
+	if err == nil {
+		apiKey.LastUsedAt = &now
+		apiKey.LastUsedIP = clientIP
+	}
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -2,35 +2,106 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"log"
+	"strings"
 	"time"
 
 	"contact-enrichment-api/config"
+	"contact-enrichment-api/mailer"
 	"contact-enrichment-api/models"
 
 	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/crypto/bcrypt"
+)
+
+// Errors of token refresh and validation
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+	ErrAccountDeactivated  = errors.New("account is deactivated")
+	ErrEmailNotVerified    = errors.New("email address is not verified")
+	ErrEmailTaken          = errors.New("user with this email already exists")
 )
 
 type AuthService struct {
-	userCollection *mongo.Collection
-	config         *config.Config
+	userCollection         *mongo.Collection
+	refreshTokenCollection *mongo.Collection
+	revokedTokenCollection *mongo.Collection
+	accountTokenCollection *mongo.Collection
+	loginAttemptCollection *mongo.Collection
+	oidcStateCollection    *mongo.Collection
+	orgService             *OrganizationService
+	mailer                 mailer.Mailer
+	config                 *config.Config
+
+	// Keys access tokens are signed and verified with
+	tokenKeys *tokenKeySet
+
+	// Single sign-on provider, nil unless an OIDC issuer is configured
+	oidc *oidcProvider
+
+	// Lowercased passwords new passwords must not be
+	breachedPasswords map[string]struct{}
+
+	// Compared against when the email is unknown, so failed logins take the same time either way
+	dummyPasswordHash string
 }
 
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID       string `json:"user_id"`
+	Email        string `json:"email"`
+	OrgID        string `json:"org_id"`            // Active organization, its membership is checked on every request
+	TokenVersion int    `json:"ver"`               // Must match the user's token version
+	Purpose      string `json:"purpose,omitempty"` // Set on tokens that are not access tokens, e.g. MFA challenges
+
+	// Administrator acting as the user, set on impersonation tokens
+	ImpersonatorID string `json:"impersonator,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func NewAuthService(db *mongo.Database, cfg *config.Config) *AuthService {
-	return &AuthService{
-		userCollection: db.Collection("users"),
-		config:         cfg,
+func NewAuthService(db *mongo.Database, cfg *config.Config, orgService *OrganizationService, mail mailer.Mailer) *AuthService {
+	breachedPasswords, err := loadBreachedPasswords(cfg.PasswordBreachedListFile)
+	if err != nil {
+		log.Fatal("Failed to load the breached password list:", err)
+	}
+
+	tokenKeys, err := loadTokenKeySet(cfg)
+	if err != nil {
+		log.Fatal("Failed to load token signing keys:", err)
+	}
+
+	var oidc *oidcProvider
+	if cfg.OIDCIssuerURL != "" {
+		oidc = newOIDCProvider(cfg)
 	}
+
+	s := &AuthService{
+		userCollection:         db.Collection("users"),
+		refreshTokenCollection: db.Collection("refresh_tokens"),
+		revokedTokenCollection: db.Collection("revoked_tokens"),
+		accountTokenCollection: db.Collection("account_tokens"),
+		loginAttemptCollection: db.Collection("login_attempts"),
+		oidcStateCollection:    db.Collection("oidc_states"),
+		orgService:             orgService,
+		mailer:                 mail,
+		config:                 cfg,
+		tokenKeys:              tokenKeys,
+		oidc:                   oidc,
+		breachedPasswords:      breachedPasswords,
+	}
+
+	if s.dummyPasswordHash, err = s.hashPassword(primitive.NewObjectID().Hex()); err != nil {
+		log.Fatal("Failed to prepare password hashing:", err)
+	}
+
+	return s
 }
 
 func (s *AuthService) Register(req models.RegisterRequest) (*models.User, error) {
@@ -41,11 +112,15 @@ func (s *AuthService) Register(req models.RegisterRequest) (*models.User, error)
 	var existingUser models.User
 	err := s.userCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&existingUser)
 	if err == nil {
-		return nil, errors.New("user with this email already exists")
+		return nil, ErrEmailTaken
+	}
+
+	if err := s.validatePassword(req.Password, req.Email, req.Name); err != nil {
+		return nil, err
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hashPassword(req.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -55,7 +130,7 @@ func (s *AuthService) Register(req models.RegisterRequest) (*models.User, error)
 		ID:        primitive.NewObjectID(),
 		Name:      req.Name,
 		Email:     req.Email,
-		Password:  string(hashedPassword),
+		Password:  hashedPassword,
 		IsActive:  true,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -66,64 +141,296 @@ func (s *AuthService) Register(req models.RegisterRequest) (*models.User, error)
 		return nil, err
 	}
 
+	// Every user starts with a personal organization
+	if _, err := s.orgService.ResolveMembership(ctx, &user, primitive.NilObjectID); err != nil {
+		return nil, err
+	}
+
+	// The account works without the email, a new one can be requested
+	logMailError("verification", &user, s.sendVerificationEmail(ctx, &user))
+
 	return &user, nil
 }
 
-func (s *AuthService) Login(req models.LoginRequest) (*models.LoginResponse, error) {
+// Login checks the credentials of a user. Failed attempts are throttled per email address and
+// per client IP, and take the same time whether or not the email belongs to an account.
+func (s *AuthService) Login(req models.LoginRequest, clientIP string) (*models.LoginResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if err := s.checkLoginAttempts(ctx, emailAttemptsKey(req.Email), ipAttemptsKey(clientIP)); err != nil {
+		return nil, err
+	}
+
 	// Find user
 	var user models.User
+	found := true
 	err := s.userCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("invalid email or password")
-		}
+	if err == mongo.ErrNoDocuments {
+		found = false
+	} else if err != nil {
 		return nil, err
 	}
 
-	// Check password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
-	if err != nil {
+	// Check password, against a dummy hash for unknown emails
+	passwordHash := s.dummyPasswordHash
+	if found {
+		passwordHash = user.Password
+	}
+	rehash, err := s.comparePassword(passwordHash, req.Password)
+	if err != nil || !found {
+		var notified *models.User
+		if found {
+			notified = &user
+		}
+		if err := s.recordLoginFailure(ctx, req.Email, clientIP, notified); err != nil {
+			if errors.Is(err, ErrTooManyLoginAttempts) {
+				return nil, err
+			}
+			log.Printf("Failed to record failed login: %v", err)
+		}
 		return nil, errors.New("invalid email or password")
 	}
 
+	s.clearLoginFailures(ctx, req.Email)
+
+	// Hashes from bcrypt or older Argon2id parameters are upgraded while the password is at hand
+	if rehash {
+		s.upgradePasswordHash(ctx, &user, req.Password)
+	}
+
 	// Check if user is active
 	if !user.IsActive {
-		return nil, errors.New("account is deactivated")
+		return nil, ErrAccountDeactivated
 	}
 
-	// Generate JWT token
-	token, err := s.GenerateToken(user.ID.Hex(), user.Email)
+	if s.config.RequireEmailVerification && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	// Tokens are only issued once the second factor was checked too
+	if user.MFAEnabled {
+		mfaToken, err := s.issueMFAChallenge(&user)
+		if err != nil {
+			return nil, err
+		}
+		return &models.LoginResponse{
+			User:         user,
+			MFARequired:  true,
+			MFAToken:     mfaToken,
+			MFAExpiresIn: int64(s.config.MFAChallengeExpiration.Seconds()),
+		}, nil
+	}
+
+	return s.completeLogin(ctx, &user)
+}
+
+// completeLogin issues the tokens of a login in the user's default organization
+func (s *AuthService) completeLogin(ctx context.Context, user *models.User) (*models.LoginResponse, error) {
+	membership, err := s.orgService.ResolveMembership(ctx, user, primitive.NilObjectID)
 	if err != nil {
 		return nil, err
 	}
 
+	// Every login starts a new refresh token family
+	tokens, err := s.issueTokens(ctx, user, membership.OrgID, primitive.NewObjectID(), primitive.NewObjectID())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if _, err := s.userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"lastLoginAt": now}}); err != nil {
+		log.Printf("Failed to record login of user %s: %v", user.ID.Hex(), err)
+	}
+	user.LastLoginAt = &now
+
 	return &models.LoginResponse{
-		Token: token,
-		User:  user,
+		TokenPair: *tokens,
+		User:      *user,
 	}, nil
 }
 
-func (s *AuthService) GenerateToken(userID, email string) (string, error) {
+// Refresh exchanges a refresh token for a new token pair. The refresh token is single use:
+// presenting one that was already exchanged revokes every token of its login.
+func (s *AuthService) Refresh(refreshToken string) (*models.TokenPair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	replacementID := primitive.NewObjectID()
+
+	// Claim the token atomically so concurrent refreshes cannot both succeed
+	var stored models.RefreshToken
+	err := s.refreshTokenCollection.FindOneAndUpdate(ctx,
+		bson.M{"tokenHash": hashToken(refreshToken), "revokedAt": nil},
+		bson.M{"$set": bson.M{"revokedAt": now, "replacedBy": replacementID}},
+	).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		s.handleRefreshTokenReuse(ctx, refreshToken)
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if now.After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var user models.User
+	if err := s.userCollection.FindOne(ctx, bson.M{"_id": stored.UserID}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrAccountDeactivated
+	}
+
+	// Keep the organization of the login, unless the user was removed from it since
+	membership, err := s.orgService.ResolveMembership(ctx, &user, stored.OrgID)
+	if errors.Is(err, ErrNotOrgMember) {
+		membership, err = s.orgService.ResolveMembership(ctx, &user, primitive.NilObjectID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, &user, membership.OrgID, stored.FamilyID, replacementID)
+}
+
+// SwitchOrganization issues tokens for another organization of the user, which also becomes
+// the organization that is active after the next login
+func (s *AuthService) SwitchOrganization(userID, orgID string) (*models.TokenPair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, ErrOrganizationNotFound
+	}
+
+	membership, err := s.orgService.ResolveMembership(ctx, user, orgObjectID)
+	if err != nil {
+		if errors.Is(err, ErrNotOrgMember) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+
+	if err := s.orgService.SetDefaultOrganization(ctx, user, membership.OrgID); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, membership.OrgID, primitive.NewObjectID(), primitive.NewObjectID())
+}
+
+// Logout revokes the access token with the given ID and, when given, the login of a refresh token
+func (s *AuthService) Logout(userID, tokenID string, tokenExpiresAt time.Time, refreshToken string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	if err := s.revokeAccessToken(ctx, userObjectID, tokenID, tokenExpiresAt); err != nil {
+		return err
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	var stored models.RefreshToken
+	err = s.refreshTokenCollection.FindOne(ctx, bson.M{"tokenHash": hashToken(refreshToken), "userId": userObjectID}).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.revokeFamily(ctx, stored.FamilyID)
+}
+
+// RevokeAllSessions logs a user out of every device: all refresh tokens are revoked and
+// access tokens issued so far stop being accepted
+func (s *AuthService) RevokeAllSessions(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	_, err = s.userCollection.UpdateOne(ctx,
+		bson.M{"_id": userObjectID},
+		bson.M{"$inc": bson.M{"tokenVersion": 1}, "$set": bson.M{"updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.refreshTokenCollection.UpdateMany(ctx,
+		bson.M{"userId": userObjectID, "revokedAt": nil},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	return err
+}
+
+func (s *AuthService) GenerateToken(userID, email, orgID string, tokenVersion int) (string, error) {
 	claims := Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:       userID,
+		Email:        email,
+		OrgID:        orgID,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.JWTExpiration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.config.JWTSecret))
+	return s.signToken(claims)
+}
+
+// signToken signs the claims of any token issued by this service with the current key
+func (s *AuthService) signToken(claims Claims) (string, error) {
+	claims.Issuer = s.config.JWTIssuer
+	claims.Audience = jwt.ClaimStrings{s.config.JWTAudience}
+	return s.tokenKeys.sign(claims)
 }
 
+// ValidateToken parses an access token
 func (s *AuthService) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.config.JWTSecret), nil
-	})
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// parseToken verifies the signature, issuer, audience and expiry of a token issued by this service.
+// Tokens issued before tokens had a kid have no issuer and audience either, the key set decides
+// whether they are still accepted.
+func (s *AuthService) parseToken(tokenString string) (*Claims, error) {
+	options := []jwt.ParserOption{jwt.WithValidMethods(tokenSigningMethods), jwt.WithExpirationRequired()}
+	if !isLegacyToken(tokenString) {
+		options = append(options, jwt.WithIssuer(s.config.JWTIssuer), jwt.WithAudience(s.config.JWTAudience))
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.tokenKeys.verificationKey, options...)
 
 	if err != nil {
 		return nil, err
@@ -137,6 +444,81 @@ func (s *AuthService) ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
+// Authenticate validates an access token and checks that it was not revoked, that its user
+// is still active and still a member of the token's organization
+func (s *AuthService) Authenticate(tokenString string) (*Claims, *models.Membership, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if claims.ID != "" {
+		count, err := s.revokedTokenCollection.CountDocuments(ctx, bson.M{"_id": claims.ID})
+		if err != nil {
+			return nil, nil, err
+		}
+		if count > 0 {
+			return nil, nil, ErrTokenRevoked
+		}
+	}
+
+	user, err := s.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.IsActive {
+		return nil, nil, ErrAccountDeactivated
+	}
+	if claims.TokenVersion != user.TokenVersion {
+		return nil, nil, ErrTokenRevoked
+	}
+
+	// Impersonation ends when the impersonator is no longer an administrator
+	if claims.ImpersonatorID != "" {
+		impersonator, err := s.GetUserByID(claims.ImpersonatorID)
+		if err != nil || !s.IsAdmin(impersonator) {
+			return nil, nil, ErrTokenRevoked
+		}
+	}
+
+	// Tokens issued before organizations existed use the default organization
+	var orgID primitive.ObjectID
+	if claims.OrgID != "" {
+		if orgID, err = primitive.ObjectIDFromHex(claims.OrgID); err != nil {
+			return nil, nil, errors.New("invalid token")
+		}
+	}
+
+	membership, err := s.orgService.ResolveMembership(ctx, user, orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return claims, membership, nil
+}
+
+// JWKS returns the public keys access tokens are signed with. It is empty with HS256.
+func (s *AuthService) JWKS() models.JSONWebKeySet {
+	return s.tokenKeys.jwks()
+}
+
+// IsAdmin reports whether the user may use the administration API: an active user whose verified
+// email is one of ADMIN_EMAILS
+func (s *AuthService) IsAdmin(user *models.User) bool {
+	if !user.IsActive || !user.EmailVerified {
+		return false
+	}
+	for _, email := range s.config.AdminEmails {
+		if strings.EqualFold(email, user.Email) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *AuthService) GetUserByID(userID string) (*models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -157,3 +539,96 @@ func (s *AuthService) GetUserByID(userID string) (*models.User, error) {
 
 	return &user, nil
 }
+
+// activeMembership returns the membership of the organization a request acts in, or the default one
+func (s *AuthService) activeMembership(ctx context.Context, user *models.User, orgID string) (*models.Membership, error) {
+	var orgObjectID primitive.ObjectID
+	if orgID != "" {
+		var err error
+		if orgObjectID, err = primitive.ObjectIDFromHex(orgID); err != nil {
+			return nil, ErrOrganizationNotFound
+		}
+	}
+
+	membership, err := s.orgService.ResolveMembership(ctx, user, orgObjectID)
+	if errors.Is(err, ErrNotOrgMember) {
+		return s.orgService.ResolveMembership(ctx, user, primitive.NilObjectID)
+	}
+	return membership, err
+}
+
+// issueTokens creates an access token for an organization and stores a new refresh token of the given login
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, orgID, familyID, refreshTokenID primitive.ObjectID) (*models.TokenPair, error) {
+	accessToken, err := s.GenerateToken(user.ID.Hex(), user.Email, orgID.Hex(), user.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	stored := models.RefreshToken{
+		ID:        refreshTokenID,
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		OrgID:     orgID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(s.config.RefreshTokenExpiration),
+		CreatedAt: now,
+	}
+	if _, err := s.refreshTokenCollection.InsertOne(ctx, stored); err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		Token:            accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int64(s.config.JWTExpiration.Seconds()),
+		RefreshExpiresAt: stored.ExpiresAt,
+		OrganizationID:   orgID,
+	}, nil
+}
+
+// handleRefreshTokenReuse revokes the login of a refresh token that was already exchanged,
+// since only a stolen copy would be presented again
+func (s *AuthService) handleRefreshTokenReuse(ctx context.Context, refreshToken string) {
+	var stored models.RefreshToken
+	err := s.refreshTokenCollection.FindOne(ctx, bson.M{"tokenHash": hashToken(refreshToken)}).Decode(&stored)
+	if err != nil || stored.ReplacedBy == nil {
+		return
+	}
+
+	if err := s.revokeFamily(ctx, stored.FamilyID); err != nil {
+		log.Printf("Failed to revoke reused refresh token family %s: %v", stored.FamilyID.Hex(), err)
+	}
+}
+
+func (s *AuthService) revokeFamily(ctx context.Context, familyID primitive.ObjectID) error {
+	_, err := s.refreshTokenCollection.UpdateMany(ctx,
+		bson.M{"familyId": familyID, "revokedAt": nil},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	return err
+}
+
+func (s *AuthService) revokeAccessToken(ctx context.Context, userID primitive.ObjectID, tokenID string, expiresAt time.Time) error {
+	if tokenID == "" {
+		return nil
+	}
+
+	revoked := models.RevokedToken{ID: tokenID, UserID: userID, ExpiresAt: expiresAt}
+	_, err := s.revokedTokenCollection.InsertOne(ctx, revoked)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
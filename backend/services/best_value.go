@@ -0,0 +1,47 @@
+package services
+
+import (
+	"contact-enrichment-api/models"
+)
+
+// GetBestValueContacts returns a page of the contact list in the best value view
+func (s *ContactService) GetBestValueContacts(orgID string, page, pageSize int, status, search string, threshold *int) (*models.BestValueListResponse, error) {
+	contactList, err := s.GetContacts(orgID, page, pageSize, status, search)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := s.bestValueThreshold(threshold)
+	contacts := make([]models.BestValueContact, len(contactList.Contacts))
+	for i := range contactList.Contacts {
+		contacts[i] = contactList.Contacts[i].BestValues(resolved)
+	}
+
+	return &models.BestValueListResponse{
+		Contacts:   contacts,
+		Threshold:  resolved,
+		Total:      contactList.Total,
+		Page:       contactList.Page,
+		PageSize:   contactList.PageSize,
+		TotalPages: contactList.TotalPages,
+	}, nil
+}
+
+// GetBestValueContactByID returns a single contact in the best value view
+func (s *ContactService) GetBestValueContactByID(orgID, contactID string, threshold *int) (*models.BestValueContact, error) {
+	contact, err := s.GetContactByID(orgID, contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	view := contact.BestValues(s.bestValueThreshold(threshold))
+	return &view, nil
+}
+
+// bestValueThreshold returns the requested threshold, or the configured one when none was given
+func (s *ContactService) bestValueThreshold(threshold *int) int {
+	if threshold != nil {
+		return *threshold
+	}
+	return s.config.BestValueThreshold
+}
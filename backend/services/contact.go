@@ -6,8 +6,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"math"
 	"net/http"
+	"net/mail"
+	"sort"
 	"time"
 
 	"contact-enrichment-api/config"
@@ -21,28 +24,44 @@ import (
 
 type ContactService struct {
 	contactCollection *mongo.Collection
+	importCollection  *mongo.Collection
+	templateService   *MappingTemplateService
+	orgService        *OrganizationService
 	config            *config.Config
 }
 
-func NewContactService(db *mongo.Database, cfg *config.Config) *ContactService {
+func NewContactService(db *mongo.Database, cfg *config.Config, orgService *OrganizationService) *ContactService {
 	return &ContactService{
 		contactCollection: db.Collection("contacts"),
+		importCollection:  db.Collection("imports"),
+		templateService:   NewMappingTemplateService(db, cfg),
+		orgService:        orgService,
 		config:            cfg,
 	}
 }
 
-func (s *ContactService) CreateContact(userID string, req models.CreateContactRequest) (*models.Contact, error) {
+// CreateContact adds a contact to the organization, the user is recorded as its creator
+func (s *ContactService) CreateContact(orgID, userID string, req models.CreateContactRequest) (*models.Contact, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
 	defer cancel()
 
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, errors.New("invalid organization ID")
+	}
+
 	userObjectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return nil, errors.New("invalid user ID")
 	}
 
-	// Check if contact already exists for this user
+	if err := s.orgService.Authorize(ctx, orgObjectID, userObjectID, models.PermissionContactsWrite); err != nil {
+		return nil, err
+	}
+
+	// Check if contact already exists in this organization
 	filter := bson.M{
-		"userId":                userObjectID,
+		"orgId":                 orgObjectID,
 		"originalContact.email": req.OriginalContact.Email,
 	}
 	var existingContact models.Contact
@@ -53,6 +72,7 @@ func (s *ContactService) CreateContact(userID string, req models.CreateContactRe
 
 	contact := models.Contact{
 		ID:              primitive.NewObjectID(),
+		OrgID:           orgObjectID,
 		UserID:          userObjectID,
 		Status:          models.StatusImported,
 		OriginalContact: req.OriginalContact,
@@ -68,131 +88,426 @@ func (s *ContactService) CreateContact(userID string, req models.CreateContactRe
 	return &contact, nil
 }
 
-func (s *ContactService) BulkCreateContacts(userID string, req models.BulkCreateContactRequest) ([]models.Contact, []string, error) {
+func (s *ContactService) BulkCreateContacts(orgID, userID string, req models.BulkCreateContactRequest) (*models.BulkImportResponse, error) {
 	// Use configurable timeout for bulk operations
 	ctx, cancel := context.WithTimeout(context.Background(), s.config.BulkOperationTimeout)
 	defer cancel()
 
-	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
 	if err != nil {
-		return nil, nil, errors.New("invalid user ID")
+		return nil, errors.New("invalid organization ID")
 	}
 
-	var contacts []models.Contact
-	var errors []string
-	var documentsToInsert []interface{}
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
 
-	// Extract all emails for batch duplicate checking
-	emails := make([]string, len(req.Contacts))
-	emailToIndex := make(map[string]int)
+	if err := s.orgService.Authorize(ctx, orgObjectID, userObjectID, models.PermissionContactsWrite); err != nil {
+		return nil, err
+	}
 
+	candidates := make([]importCandidate, len(req.Contacts))
 	for i, originalContact := range req.Contacts {
-		emails[i] = originalContact.Email
-		emailToIndex[originalContact.Email] = i
+		candidates[i] = importCandidate{
+			row:         i + 1,
+			contact:     originalContact,
+			rowData:     originalContactRow(originalContact),
+			emailColumn: "email",
+		}
 	}
 
-	// Batch check for existing contacts
-	filter := bson.M{
-		"userId":                userObjectID,
-		"originalContact.email": bson.M{"$in": emails},
+	batch := newImportBatch(orgObjectID, userObjectID, models.ImportSourceBulk, req.Mode, len(req.Contacts))
+	if err := s.startImportBatch(ctx, batch); err != nil {
+		return nil, err
+	}
+	outcome, err := s.importContacts(ctx, orgObjectID, userObjectID, batch.ID, candidates, req.Mode)
+	setImportOutcome(batch, outcome, outcome.errors, outcome.skipped)
+	if finishErr := s.finishImportBatch(batch, err); err == nil {
+		err = finishErr
 	}
 
-	cursor, err := s.contactCollection.Find(ctx, filter)
+	response := &models.BulkImportResponse{
+		ImportID:        batch.ID,
+		CreatedContacts: outcome.created,
+		UpdatedContacts: outcome.updated,
+		Results:         outcome.results,
+		Errors:          outcome.errors,
+	}
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to check for duplicates: %v", err)
+		return response, err
 	}
-	defer cursor.Close(ctx)
 
-	// Create a set of existing emails
-	existingEmails := make(map[string]bool)
-	for cursor.Next(ctx) {
-		var existingContact models.Contact
-		if err := cursor.Decode(&existingContact); err != nil {
-			continue
-		}
-		existingEmails[existingContact.OriginalContact.Email] = true
+	return response, nil
+}
+
+// importCandidate is a validated import row waiting to be matched against existing contacts
+type importCandidate struct {
+	row         int
+	contact     models.OriginalContact
+	rowData     map[string]interface{} // Raw row for error reports
+	emailColumn string                 // Source column the email came from
+}
+
+// importError builds an error for the candidate's email
+func (c importCandidate) importError(code models.ImportErrorCode, message string) models.ImportError {
+	return models.ImportError{
+		Row:     c.row,
+		Column:  c.emailColumn,
+		Field:   "email",
+		Code:    code,
+		Message: message,
+		Value:   c.contact.Email,
+		RowData: c.rowData,
+	}
+}
+
+// importOutcome collects what importContacts did with its candidates
+type importOutcome struct {
+	created   []models.Contact
+	updated   []models.Contact
+	results   []models.ImportContactResult
+	errors    []models.ImportError
+	skipped   int
+	unchanged int
+}
+
+// importContacts matches candidates against the organization's existing contacts by email,
+// creates new contacts tagged with the import ID and updates existing ones according to the import mode.
+// The returned outcome is never nil, even when an error is returned.
+func (s *ContactService) importContacts(ctx context.Context, orgObjectID, userObjectID, importID primitive.ObjectID, candidates []importCandidate, mode models.ImportMode) (*importOutcome, error) {
+	outcome := &importOutcome{
+		created: []models.Contact{},
+		updated: []models.Contact{},
+		results: []models.ImportContactResult{},
+		errors:  []models.ImportError{},
+	}
+
+	if mode == "" {
+		mode = models.ImportModeSkip
+	}
+
+	if len(candidates) == 0 {
+		return outcome, nil
+	}
+
+	// Extract all emails for batch duplicate checking
+	emails := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		emails[i] = candidate.contact.Email
 	}
 
+	existingContacts, err := s.findExistingContacts(ctx, orgObjectID, emails)
+	if err != nil {
+		return outcome, err
+	}
+
+	var inserts, updates []pendingWrite
+
 	// Check for duplicates within the current batch as well
-	seenEmails := make(map[string]int) // email -> first occurrence index
+	seenEmails := make(map[string]int) // email -> first occurrence row
 
-	// Process each contact
-	for i, originalContact := range req.Contacts {
-		// Check if email already exists in database
-		if existingEmails[originalContact.Email] {
-			errors = append(errors, fmt.Sprintf("Row %d: Contact with email %s already exists in database", i+1, originalContact.Email))
+	for _, candidate := range candidates {
+		email := candidate.contact.Email
+
+		if firstRow, exists := seenEmails[email]; exists {
+			importError := candidate.importError(models.ImportErrorDuplicateInBatch, fmt.Sprintf("Duplicate email %s (first occurrence at row %d)", email, firstRow))
+			importError.FirstRow = firstRow
+			outcome.errors = append(outcome.errors, importError)
+			outcome.skipped++
 			continue
 		}
+		seenEmails[email] = candidate.row
+
+		existing, exists := existingContacts[email]
+		if exists {
+			if mode == models.ImportModeSkip {
+				importError := candidate.importError(models.ImportErrorDuplicateInDB, fmt.Sprintf("Contact with email %s already exists in database", email))
+				importError.ExistingContactID = &existing.ID
+				outcome.errors = append(outcome.errors, importError)
+				outcome.skipped++
+				continue
+			}
 
-		// Check for duplicates within current batch
-		if firstIndex, exists := seenEmails[originalContact.Email]; exists {
-			errors = append(errors, fmt.Sprintf("Row %d: Duplicate email %s (first occurrence at row %d)", i+1, originalContact.Email, firstIndex+1))
+			existing.OriginalContact.CustomFields = cloneCustomFields(existing.OriginalContact.CustomFields)
+			changedFields := existing.OriginalContact.MergeFrom(candidate.contact, mode)
+
+			if len(changedFields) == 0 {
+				outcome.results = append(outcome.results, models.ImportContactResult{
+					Row:       candidate.row,
+					ContactID: existing.ID,
+					Email:     email,
+					Action:    models.ImportActionUnchanged,
+				})
+				outcome.unchanged++
+				continue
+			}
+
+			existing.UpdatedAt = time.Now()
+			updates = append(updates, pendingWrite{candidate: candidate, contact: existing, changedFields: changedFields})
 			continue
 		}
 
-		seenEmails[originalContact.Email] = i
-
+		now := time.Now()
 		contact := models.Contact{
 			ID:              primitive.NewObjectID(),
+			OrgID:           orgObjectID,
 			UserID:          userObjectID,
+			ImportID:        &importID,
 			Status:          models.StatusImported,
-			OriginalContact: originalContact,
-			CreatedAt:       time.Now(),
-			UpdatedAt:       time.Now(),
+			OriginalContact: candidate.contact,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+		inserts = append(inserts, pendingWrite{candidate: candidate, contact: contact})
+	}
+
+	// Process in batches of 1000, with ordered=false so one failing document doesn't stop the others
+	const batchSize = 1000
+
+	for i := 0; i < len(updates); i += batchSize {
+		batch := updates[i:min(i+batchSize, len(updates))]
+
+		writeModels := make([]mongo.WriteModel, len(batch))
+		for j, write := range batch {
+			writeModels[j] = mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": write.contact.ID, "orgId": orgObjectID}).
+				SetUpdate(bson.M{"$set": bson.M{
+					"originalContact": write.contact.OriginalContact,
+					"updated_at":      write.contact.UpdatedAt,
+				}})
 		}
 
-		contacts = append(contacts, contact)
-		documentsToInsert = append(documentsToInsert, contact)
+		result, err := s.contactCollection.BulkWrite(ctx, writeModels, options.BulkWrite().SetOrdered(false))
+		failures := s.writeFailures(err, batch, false)
+		if result != nil && int(result.MatchedCount)+len(failures) < len(batch) {
+			s.addUnmatchedUpdates(orgObjectID, batch, failures)
+		}
+		s.recordWrites(outcome, batch, failures, models.ImportActionUpdated)
+	}
+
+	for i := 0; i < len(inserts); i += batchSize {
+		batch := inserts[i:min(i+batchSize, len(inserts))]
+
+		documents := make([]interface{}, len(batch))
+		for j, write := range batch {
+			documents[j] = write.contact
+		}
+
+		_, err := s.contactCollection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+		failures := s.writeFailures(err, batch, true)
+		s.recordWrites(outcome, batch, failures, models.ImportActionCreated)
 	}
 
-	// Insert in batches if we have a large number of contacts
-	if len(documentsToInsert) > 0 {
-		const batchSize = 1000 // Process in batches of 1000
+	// Report results in row order regardless of which write they came from
+	sort.SliceStable(outcome.results, func(i, j int) bool {
+		return outcome.results[i].Row < outcome.results[j].Row
+	})
+	sort.SliceStable(outcome.errors, func(i, j int) bool {
+		return outcome.errors[i].Row < outcome.errors[j].Row
+	})
+
+	return outcome, nil
+}
+
+// pendingWrite is a contact waiting to be inserted or updated for an import row
+type pendingWrite struct {
+	candidate     importCandidate
+	contact       models.Contact
+	changedFields []string
+}
+
+// writeFailures maps the error of an unordered bulk write to the documents that were not written.
+// A BulkWriteException names every failed document by index. For any other error the outcome of
+// each document is unknown, so inserted documents are looked up by ID and the rest reported as failed.
+func (s *ContactService) writeFailures(err error, batch []pendingWrite, insert bool) map[int]models.ImportError {
+	failures := make(map[int]models.ImportError)
+	if err == nil {
+		return failures
+	}
 
-		for i := 0; i < len(documentsToInsert); i += batchSize {
-			end := i + batchSize
-			if end > len(documentsToInsert) {
-				end = len(documentsToInsert)
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if writeErr.Index < 0 || writeErr.Index >= len(batch) {
+				continue
 			}
+			failures[writeErr.Index] = writeFailure(batch[writeErr.Index], writeErr.Code, writeErr.Message, insert)
+		}
+		return failures
+	}
+
+	written := make(map[primitive.ObjectID]bool)
+	if insert {
+		ids := make([]primitive.ObjectID, len(batch))
+		for i, write := range batch {
+			ids[i] = write.contact.ID
+		}
 
-			batch := documentsToInsert[i:end]
+		// The import context may be what failed, so check with a fresh one
+		checkCtx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+		defer cancel()
 
-			// Use ordered=false for better performance (continues on error)
-			opts := options.InsertMany().SetOrdered(false)
-			_, err = s.contactCollection.InsertMany(ctx, batch, opts)
-			if err != nil {
-				// Even with unordered inserts, we might get some errors
-				// but the operation should continue for other documents
-				return contacts[:end-i], errors, fmt.Errorf("batch insert failed: %v", err)
+		cursor, findErr := s.contactCollection.Find(checkCtx, bson.M{"_id": bson.M{"$in": ids}},
+			options.Find().SetProjection(bson.M{"_id": 1}))
+		if findErr == nil {
+			var found []struct {
+				ID primitive.ObjectID `bson:"_id"`
+			}
+			if cursor.All(checkCtx, &found) == nil {
+				for _, doc := range found {
+					written[doc.ID] = true
+				}
 			}
 		}
 	}
 
-	return contacts, errors, nil
+	for i, write := range batch {
+		if !written[write.contact.ID] {
+			failures[i] = writeFailure(write, 0, err.Error(), insert)
+		}
+	}
+
+	return failures
 }
 
-func (s *ContactService) GetContacts(userID string, page, pageSize int, status, search string) (*models.ContactListResponse, error) {
+// addUnmatchedUpdates adds the updates whose filter matched no contact to the failures. The contact
+// was deleted or moved to another organization after it was looked up, so nothing was written.
+// When the contacts cannot be looked up, every update not known to have failed is reported failed.
+func (s *ContactService) addUnmatchedUpdates(orgObjectID primitive.ObjectID, batch []pendingWrite, failures map[int]models.ImportError) {
+	ids := make([]primitive.ObjectID, len(batch))
+	for i, write := range batch {
+		ids[i] = write.contact.ID
+	}
+
+	// The import context may have run out, so check with a fresh one
 	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
 	defer cancel()
 
-	userObjectID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		return nil, errors.New("invalid user ID")
+	found := make(map[primitive.ObjectID]bool)
+	cursor, err := s.contactCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "orgId": orgObjectID},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err == nil {
+		var docs []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err = cursor.All(ctx, &docs); err == nil {
+			for _, doc := range docs {
+				found[doc.ID] = true
+			}
+		}
 	}
 
-	// Build filter
-	filter := bson.M{"userId": userObjectID}
+	for i, write := range batch {
+		if _, failed := failures[i]; failed || found[write.contact.ID] {
+			continue
+		}
+		if err != nil {
+			failures[i] = writeFailure(write, 0, fmt.Sprintf("the update could not be confirmed: %v", err), false)
+		} else {
+			failures[i] = writeFailure(write, 0, "the contact was deleted or moved during the import", false)
+		}
+	}
+}
 
-	if status != "" {
-		filter["status"] = status
+// writeFailure builds the row error for a document the database rejected
+func writeFailure(write pendingWrite, code int, message string, insert bool) models.ImportError {
+	var errorCode models.ImportErrorCode
+	var reason string
+
+	switch {
+	case code == 11000 || code == 11001:
+		errorCode = models.ImportErrorDuplicateKey
+		reason = fmt.Sprintf("Contact with email %s was created by another request during the import", write.candidate.contact.Email)
+	case code == 121:
+		errorCode = models.ImportErrorValidationFailed
+		reason = "Contact failed database validation"
+	case insert:
+		errorCode = models.ImportErrorInsertFailed
+		reason = "Contact could not be inserted"
+	default:
+		errorCode = models.ImportErrorUpdateFailed
+		reason = "Contact could not be updated"
 	}
 
-	if search != "" {
-		filter["$or"] = []bson.M{
-			{"originalContact.name": bson.M{"$regex": search, "$options": "i"}},
-			{"originalContact.email": bson.M{"$regex": search, "$options": "i"}},
+	importError := write.candidate.importError(errorCode, fmt.Sprintf("%s: %s", reason, message))
+	if !insert {
+		importError.ExistingContactID = &write.contact.ID
+	}
+	return importError
+}
+
+// recordWrites adds the written documents of a batch to the outcome and the failed ones to its errors
+func (s *ContactService) recordWrites(outcome *importOutcome, batch []pendingWrite, failures map[int]models.ImportError, action models.ImportAction) {
+	for i, write := range batch {
+		if failure, failed := failures[i]; failed {
+			outcome.errors = append(outcome.errors, failure)
+			outcome.skipped++
+			continue
+		}
+
+		outcome.results = append(outcome.results, models.ImportContactResult{
+			Row:           write.candidate.row,
+			ContactID:     write.contact.ID,
+			Email:         write.contact.OriginalContact.Email,
+			Action:        action,
+			ChangedFields: write.changedFields,
+		})
+
+		if action == models.ImportActionCreated {
+			outcome.created = append(outcome.created, write.contact)
+		} else {
+			outcome.updated = append(outcome.updated, write.contact)
 		}
 	}
+}
+
+// findExistingContacts returns the organization's contacts with any of the given emails, keyed by email
+func (s *ContactService) findExistingContacts(ctx context.Context, orgObjectID primitive.ObjectID, emails []string) (map[string]models.Contact, error) {
+	filter := bson.M{
+		"orgId":                 orgObjectID,
+		"originalContact.email": bson.M{"$in": emails},
+	}
+
+	cursor, err := s.contactCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for duplicates: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	existingContacts := make(map[string]models.Contact)
+	for cursor.Next(ctx) {
+		var existingContact models.Contact
+		if err := cursor.Decode(&existingContact); err != nil {
+			continue
+		}
+		existingContacts[existingContact.OriginalContact.Email] = existingContact
+	}
+
+	return existingContacts, nil
+}
+
+func cloneCustomFields(fields map[string]interface{}) map[string]interface{} {
+	if fields == nil {
+		return nil
+	}
+	clone := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		clone[key] = value
+	}
+	return clone
+}
+
+func (s *ContactService) GetContacts(orgID string, page, pageSize int, status, search string) (*models.ContactListResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, errors.New("invalid organization ID")
+	}
+
+	filter := contactFilter(orgObjectID, status, search)
 
 	// Count total documents
 	total, err := s.contactCollection.CountDocuments(ctx, filter)
@@ -231,13 +546,31 @@ func (s *ContactService) GetContacts(userID string, page, pageSize int, status,
 	}, nil
 }
 
-func (s *ContactService) GetContactByID(userID, contactID string) (*models.Contact, error) {
+// contactFilter builds the filter of the contact list, shared by exports
+func contactFilter(orgObjectID primitive.ObjectID, status, search string) bson.M {
+	filter := bson.M{"orgId": orgObjectID}
+
+	if status != "" {
+		filter["status"] = status
+	}
+
+	if search != "" {
+		filter["$or"] = []bson.M{
+			{"originalContact.name": bson.M{"$regex": search, "$options": "i"}},
+			{"originalContact.email": bson.M{"$regex": search, "$options": "i"}},
+		}
+	}
+
+	return filter
+}
+
+func (s *ContactService) GetContactByID(orgID, contactID string) (*models.Contact, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
 	defer cancel()
 
-	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
 	if err != nil {
-		return nil, errors.New("invalid user ID")
+		return nil, errors.New("invalid organization ID")
 	}
 
 	contactObjectID, err := primitive.ObjectIDFromHex(contactID)
@@ -246,8 +579,8 @@ func (s *ContactService) GetContactByID(userID, contactID string) (*models.Conta
 	}
 
 	filter := bson.M{
-		"_id":    contactObjectID,
-		"userId": userObjectID,
+		"_id":   contactObjectID,
+		"orgId": orgObjectID,
 	}
 
 	var contact models.Contact
@@ -262,12 +595,21 @@ func (s *ContactService) GetContactByID(userID, contactID string) (*models.Conta
 	return &contact, nil
 }
 
-func (s *ContactService) EnrichContact(userID, contactID string) (*models.Contact, error) {
+// EnrichContact enriches a contact of the organization, for members allowed to enrich
+func (s *ContactService) EnrichContact(orgID, userID, contactID string) (*models.Contact, error) {
+	if err := s.authorize(orgID, userID, models.PermissionContactsEnrich); err != nil {
+		return nil, err
+	}
+
+	return s.enrichContact(orgID, contactID)
+}
+
+func (s *ContactService) enrichContact(orgID, contactID string) (*models.Contact, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.config.EnrichmentTimeout)
 	defer cancel()
 
 	// Get the contact
-	contact, err := s.GetContactByID(userID, contactID)
+	contact, err := s.GetContactByID(orgID, contactID)
 	if err != nil {
 		return nil, err
 	}
@@ -307,15 +649,19 @@ func (s *ContactService) EnrichContact(userID, contactID string) (*models.Contac
 	}
 
 	// Return updated contact
-	return s.GetContactByID(userID, contactID)
+	return s.GetContactByID(orgID, contactID)
 }
 
-func (s *ContactService) BulkEnrichContacts(userID string, contactIDs []string) error {
+func (s *ContactService) BulkEnrichContacts(orgID, userID string, contactIDs []string) error {
+	if err := s.authorize(orgID, userID, models.PermissionContactsEnrich); err != nil {
+		return err
+	}
+
 	// This would typically be handled by a background job queue
 	// For now, we'll process them sequentially
 	for _, contactID := range contactIDs {
 		go func(id string) {
-			_, err := s.EnrichContact(userID, id)
+			_, err := s.enrichContact(orgID, id)
 			if err != nil {
 				// Log error - in production, you'd want proper error handling/retry logic
 				fmt.Printf("Failed to enrich contact %s: %v\n", id, err)
@@ -326,17 +672,17 @@ func (s *ContactService) BulkEnrichContacts(userID string, contactIDs []string)
 	return nil
 }
 
-func (s *ContactService) GetContactStats(userID string) (*models.ContactStatsResponse, error) {
+func (s *ContactService) GetContactStats(orgID string) (*models.ContactStatsResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
 	defer cancel()
 
-	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
 	if err != nil {
-		return nil, errors.New("invalid user ID")
+		return nil, errors.New("invalid organization ID")
 	}
 
 	pipeline := []bson.M{
-		{"$match": bson.M{"userId": userObjectID}},
+		{"$match": bson.M{"orgId": orgObjectID}},
 		{"$group": bson.M{
 			"_id":           "$status",
 			"count":         bson.M{"$sum": 1},
@@ -385,6 +731,24 @@ func (s *ContactService) GetContactStats(userID string) (*models.ContactStatsRes
 	return stats, nil
 }
 
+// authorize checks a permission of the user in the organization, for methods without a context of their own
+func (s *ContactService) authorize(orgID, userID string, permission models.Permission) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return errors.New("invalid organization ID")
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	return s.orgService.Authorize(ctx, orgObjectID, userObjectID, permission)
+}
+
 func (s *ContactService) updateContactStatus(contactID string, status models.ContactStatus) error {
 	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
 	defer cancel()
@@ -447,23 +811,37 @@ func (s *ContactService) callEnrichmentAPI(originalContact models.OriginalContac
 }
 
 // Enhanced bulk import with dynamic field support
-func (s *ContactService) EnhancedBulkCreateContacts(userID string, req models.EnhancedBulkCreateContactRequest) (*models.EnhancedBulkImportResponse, error) {
+func (s *ContactService) EnhancedBulkCreateContacts(orgID, userID string, req models.EnhancedBulkCreateContactRequest) (*models.EnhancedBulkImportResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.config.BulkOperationTimeout)
 	defer cancel()
 
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, errors.New("invalid organization ID")
+	}
+
 	userObjectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return nil, errors.New("invalid user ID")
 	}
 
+	if err := s.orgService.Authorize(ctx, orgObjectID, userObjectID, models.PermissionContactsWrite); err != nil {
+		return nil, err
+	}
+
 	response := &models.EnhancedBulkImportResponse{
-		ProcessedContacts: []models.Contact{},
-		Errors:            []string{},
+		ProcessedContacts:  []models.Contact{},
+		UpdatedContacts:    []models.Contact{},
+		Results:            []models.ImportContactResult{},
+		Errors:             []models.ImportError{},
+		SuggestedTemplates: []models.MappingTemplateMatch{},
 		FieldSummary: models.FieldSummary{
 			DetectedFields:    []string{},
 			StandardFields:    []string{},
 			CustomFields:      []string{},
+			IgnoredFields:     []string{},
 			FieldMappings:     make(map[string]string),
+			Suggestions:       []models.FieldMappingSuggestion{},
 			TotalContacts:     len(req.Contacts),
 			ProcessedContacts: 0,
 		},
@@ -474,9 +852,52 @@ func (s *ContactService) EnhancedBulkCreateContacts(userID string, req models.En
 		return response, nil
 	}
 
+	// Detect a built-in preset from the raw columns, its rules run before the request's own
+	rawFields := make(map[string]bool)
+	for _, contactData := range req.Contacts {
+		for fieldName := range contactData {
+			rawFields[fieldName] = true
+		}
+	}
+	rawHeaders := make([]string, 0, len(rawFields))
+	for fieldName := range rawFields {
+		rawHeaders = append(rawHeaders, fieldName)
+	}
+	preset := models.SelectImportPreset(req.Preset, rawHeaders)
+
+	transforms := req.Transforms
+	if preset != nil {
+		response.AppliedPreset = preset.ID
+		transforms = append(append([]models.TransformRule{}, preset.Transforms...), req.Transforms...)
+	}
+
+	pipeline, err := newTransformPipeline(transforms)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply transformation rules, rows that fail a rule are skipped
+	rows := make([]map[string]interface{}, len(req.Contacts))
+	for i, contactData := range req.Contacts {
+		row, err := pipeline.apply(contactData)
+		if err != nil {
+			response.Errors = append(response.Errors, models.ImportError{
+				Row:     i + 1,
+				Column:  err.column,
+				Code:    models.ImportErrorTransformFailed,
+				Message: fmt.Sprintf("Transform failed: %v", err.err),
+				Value:   contactData[err.column],
+				RowData: contactData,
+			})
+			response.SkippedContacts++
+			continue
+		}
+		rows[i] = row
+	}
+
 	// Detect all unique fields from the import
 	allFields := make(map[string]bool)
-	for _, contactData := range req.Contacts {
+	for _, contactData := range rows {
 		for fieldName := range contactData {
 			if fieldName != "" {
 				allFields[fieldName] = true
@@ -488,169 +909,211 @@ func (s *ContactService) EnhancedBulkCreateContacts(userID string, req models.En
 	for fieldName := range allFields {
 		response.FieldSummary.DetectedFields = append(response.FieldSummary.DetectedFields, fieldName)
 	}
+	sort.Strings(response.FieldSummary.DetectedFields)
 
-	// Process field mappings
-	fieldMappings := make(map[string]string)
-	if req.FieldMapping != nil {
-		fieldMappings = req.FieldMapping
-	}
-
-	// Auto-detect standard fields if not manually mapped
-	for _, fieldName := range response.FieldSummary.DetectedFields {
-		if _, exists := fieldMappings[fieldName]; !exists {
-			normalizedField := models.NormalizeFieldName(fieldName)
-			fieldMappings[fieldName] = normalizedField
+	if req.TemplateID == "" {
+		matches, err := s.templateService.MatchTemplates(userID, response.FieldSummary.DetectedFields)
+		if err != nil {
+			return nil, fmt.Errorf("failed to match mapping templates: %v", err)
 		}
+		response.SuggestedTemplates = matches
 	}
 
+	resolution, err := s.resolveFieldMappings(ctx, userID, response.FieldSummary.DetectedFields, preset, req.TemplateID, req.FieldMapping)
+	if err != nil {
+		return nil, err
+	}
+	fieldMappings := resolution.mappings
+	response.AppliedTemplateID = resolution.templateID
+	response.FieldSummary.Suggestions = append(response.FieldSummary.Suggestions, resolution.suggestions...)
 	response.FieldSummary.FieldMappings = fieldMappings
 
 	// Categorize fields
-	standardFieldNames := []string{"name", "email", "phone", "company", "title", "industry", "location", "department"}
-	standardFieldSet := make(map[string]bool)
-	for _, field := range standardFieldNames {
-		standardFieldSet[field] = true
-	}
-
-	for originalField, mappedField := range fieldMappings {
-		if standardFieldSet[mappedField] {
+	for _, originalField := range response.FieldSummary.DetectedFields {
+		if mappedField, exists := fieldMappings[originalField]; exists && mappedField == "" {
+			response.FieldSummary.IgnoredFields = append(response.FieldSummary.IgnoredFields, originalField)
+		} else if models.IsStandardField(mappedField) {
 			response.FieldSummary.StandardFields = append(response.FieldSummary.StandardFields, originalField)
 		} else {
 			response.FieldSummary.CustomFields = append(response.FieldSummary.CustomFields, originalField)
 		}
 	}
 
-	// Convert map data to OriginalContact structs
-	var contacts []models.Contact
-	var documentsToInsert []interface{}
-	emails := make([]string, 0, len(req.Contacts))
-	emailToIndex := make(map[string]int)
-	processedIndex := 0
-
-	for i, contactData := range req.Contacts {
-		originalContact := &models.OriginalContact{}
+	sourceColumns := mappedSourceColumns(response.FieldSummary.DetectedFields, fieldMappings)
 
-		// Apply field mappings
-		for originalFieldName, value := range contactData {
-			if mappedFieldName, exists := fieldMappings[originalFieldName]; exists {
-				originalContact.SetFieldValue(mappedFieldName, value)
-			}
-		}
+	// Convert map data to OriginalContact structs
+	candidates := make([]importCandidate, 0, len(req.Contacts))
 
-		// Validate required fields
-		if originalContact.Name == "" || originalContact.Email == "" {
-			response.Errors = append(response.Errors, fmt.Sprintf("Row %d: Missing required fields (name and email)", i+1))
-			response.SkippedContacts++
+	for i, contactData := range rows {
+		if contactData == nil {
 			continue
 		}
 
-		// Validate email format
-		if !isValidEmail(originalContact.Email) {
-			response.Errors = append(response.Errors, fmt.Sprintf("Row %d: Invalid email format: %s", i+1, originalContact.Email))
+		candidate, rowErrors := mappedCandidate(i+1, contactData, req.Contacts[i], fieldMappings, sourceColumns)
+		if len(rowErrors) > 0 {
+			response.Errors = append(response.Errors, rowErrors...)
 			response.SkippedContacts++
 			continue
 		}
 
-		emails = append(emails, originalContact.Email)
-		emailToIndex[originalContact.Email] = processedIndex
-		processedIndex++
+		candidates = append(candidates, candidate)
+	}
 
-		contact := models.Contact{
-			ID:              primitive.NewObjectID(),
-			UserID:          userObjectID,
-			Status:          models.StatusImported,
-			OriginalContact: *originalContact,
-			CreatedAt:       time.Now(),
-			UpdatedAt:       time.Now(),
-		}
+	batch := newImportBatch(orgObjectID, userObjectID, models.ImportSourceBulkEnhanced, req.Mode, len(req.Contacts))
+	batch.FieldMapping = fieldMappings
+	batch.TemplateID = response.AppliedTemplateID
+	batch.Preset = response.AppliedPreset
+	batch.Transforms = req.Transforms
+	if err := s.startImportBatch(ctx, batch); err != nil {
+		return nil, err
+	}
 
-		contacts = append(contacts, contact)
-		documentsToInsert = append(documentsToInsert, contact)
+	outcome, err := s.importContacts(ctx, orgObjectID, userObjectID, batch.ID, candidates, req.Mode)
+	response.ImportID = batch.ID
+	response.ProcessedContacts = outcome.created
+	response.UpdatedContacts = outcome.updated
+	response.Results = outcome.results
+	response.Errors = append(response.Errors, outcome.errors...)
+	sort.SliceStable(response.Errors, func(i, j int) bool {
+		return response.Errors[i].Row < response.Errors[j].Row
+	})
+	response.SkippedContacts += outcome.skipped
+	response.UnchangedContacts = outcome.unchanged
+	response.FieldSummary.ProcessedContacts = len(outcome.created) + len(outcome.updated)
+	setImportOutcome(batch, outcome, response.Errors, response.SkippedContacts)
+	if finishErr := s.finishImportBatch(batch, err); err == nil {
+		err = finishErr
+	}
+	if err != nil {
+		return response, err
 	}
 
-	// Batch check for existing contacts
-	if len(emails) > 0 {
-		filter := bson.M{
-			"userId":                userObjectID,
-			"originalContact.email": bson.M{"$in": emails},
-		}
+	return response, nil
+}
+
+// fieldMappingResolution is the mapping chosen for the detected fields of an import
+type fieldMappingResolution struct {
+	mappings    map[string]string
+	suggestions []models.FieldMappingSuggestion
+	templateID  *primitive.ObjectID // Saved template that was applied, if any
+}
+
+// resolveFieldMappings maps detected fields using a built-in preset, then a saved template, then the
+// explicit mappings of the request, each taking precedence over the previous one, and finally
+// auto-detection for the fields left over
+func (s *ContactService) resolveFieldMappings(ctx context.Context, userID string, detectedFields []string, preset *models.ImportPreset, templateID string, fieldMapping map[string]string) (*fieldMappingResolution, error) {
+	resolution := &fieldMappingResolution{
+		mappings:    make(map[string]string),
+		suggestions: []models.FieldMappingSuggestion{},
+	}
 
-		cursor, err := s.contactCollection.Find(ctx, filter)
+	manualMappings := make(map[string]string)
+	matchTypes := make(map[string]string)
+	if preset != nil {
+		for sourceField, mappedField := range preset.MapHeaders(detectedFields) {
+			manualMappings[sourceField] = mappedField
+			matchTypes[sourceField] = models.MatchTypePreset
+		}
+	}
+	if templateID != "" {
+		template, err := s.templateService.GetTemplateByID(userID, templateID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to check for duplicates: %v", err)
+			return nil, err
 		}
-		defer cursor.Close(ctx)
-
-		existingEmails := make(map[string]bool)
-		for cursor.Next(ctx) {
-			var existingContact models.Contact
-			if err := cursor.Decode(&existingContact); err != nil {
-				continue
-			}
-			existingEmails[existingContact.OriginalContact.Email] = true
+		for sourceField, mappedField := range template.FieldMapping {
+			manualMappings[sourceField] = mappedField
+			matchTypes[sourceField] = models.MatchTypeManual
 		}
+		resolution.templateID = &template.ID
+		if err := s.templateService.markTemplateUsed(ctx, template.ID); err != nil {
+			log.Printf("Failed to record use of mapping template %s: %v", template.ID.Hex(), err)
+		}
+	}
+	for sourceField, mappedField := range fieldMapping {
+		manualMappings[sourceField] = mappedField
+		matchTypes[sourceField] = models.MatchTypeManual
+	}
 
-		// Remove duplicates
-		filteredContacts := []models.Contact{}
-		filteredDocuments := []interface{}{}
-		seenEmails := make(map[string]int)
-
-		for _, contact := range contacts {
-			email := contact.OriginalContact.Email
+	var unmappedFields []string
+	for _, fieldName := range detectedFields {
+		if mappedField, exists := manualMappings[fieldName]; exists {
+			resolution.mappings[fieldName] = mappedField
+			resolution.suggestions = append(resolution.suggestions, models.FieldMappingSuggestion{
+				SourceField: fieldName,
+				MappedField: mappedField,
+				Confidence:  100,
+				MatchType:   matchTypes[fieldName],
+			})
+			continue
+		}
+		unmappedFields = append(unmappedFields, fieldName)
+	}
 
-			// Check database duplicates
-			if existingEmails[email] {
-				if index, exists := emailToIndex[email]; exists {
-					response.Errors = append(response.Errors, fmt.Sprintf("Row %d: Contact with email %s already exists in database", index+1, email))
-				}
-				response.SkippedContacts++
-				continue
-			}
+	// Auto-detect standard fields if not manually mapped, without reusing manually mapped targets
+	reservedFields := make([]string, 0, len(resolution.mappings))
+	for _, mappedField := range resolution.mappings {
+		if mappedField != "" {
+			reservedFields = append(reservedFields, mappedField)
+		}
+	}
+	for _, suggestion := range models.SuggestFieldMappings(unmappedFields, reservedFields...) {
+		resolution.mappings[suggestion.SourceField] = suggestion.MappedField
+		resolution.suggestions = append(resolution.suggestions, suggestion)
+	}
 
-			// Check batch duplicates
-			if firstIndex, exists := seenEmails[email]; exists {
-				if index, exists := emailToIndex[email]; exists {
-					response.Errors = append(response.Errors, fmt.Sprintf("Row %d: Duplicate email %s (first occurrence at row %d)", index+1, email, firstIndex+1))
-				}
-				response.SkippedContacts++
-				continue
-			}
+	return resolution, nil
+}
 
-			if index, exists := emailToIndex[email]; exists {
-				seenEmails[email] = index + 1
+// mappedSourceColumns returns the first source column of every mapped field, for error reporting
+func mappedSourceColumns(detectedFields []string, fieldMappings map[string]string) map[string]string {
+	sourceColumns := make(map[string]string)
+	for _, sourceField := range detectedFields {
+		if mappedField := fieldMappings[sourceField]; mappedField != "" {
+			if _, exists := sourceColumns[mappedField]; !exists {
+				sourceColumns[mappedField] = sourceField
 			}
-
-			filteredContacts = append(filteredContacts, contact)
-			filteredDocuments = append(filteredDocuments, contact)
 		}
-
-		contacts = filteredContacts
-		documentsToInsert = filteredDocuments
 	}
+	return sourceColumns
+}
 
-	// Insert in batches
-	if len(documentsToInsert) > 0 {
-		const batchSize = 1000
+// mappedCandidate applies field mappings to a transformed row and validates the result.
+// rawRow is the row as submitted, kept for error reports.
+func mappedCandidate(row int, contactData, rawRow map[string]interface{}, fieldMappings, sourceColumns map[string]string) (importCandidate, []models.ImportError) {
+	originalContact := models.BuildOriginalContact(contactData, fieldMappings)
 
-		for i := 0; i < len(documentsToInsert); i += batchSize {
-			end := i + batchSize
-			if end > len(documentsToInsert) {
-				end = len(documentsToInsert)
-			}
+	candidate := importCandidate{
+		row:         row,
+		contact:     originalContact,
+		rowData:     rawRow,
+		emailColumn: sourceColumns["email"],
+	}
 
-			batch := documentsToInsert[i:end]
-			opts := options.InsertMany().SetOrdered(false)
-			_, err = s.contactCollection.InsertMany(ctx, batch, opts)
-			if err != nil {
-				return response, fmt.Errorf("batch insert failed: %v", err)
-			}
+	// Validate required fields
+	var rowErrors []models.ImportError
+	required := [][2]string{{"name", originalContact.Name}, {"email", originalContact.Email}}
+	for _, requiredField := range required {
+		if field, value := requiredField[0], requiredField[1]; value == "" {
+			rowErrors = append(rowErrors, models.ImportError{
+				Row:     row,
+				Column:  sourceColumns[field],
+				Field:   field,
+				Code:    models.ImportErrorMissingRequired,
+				Message: fmt.Sprintf("Missing required field %s", field),
+				RowData: rawRow,
+			})
 		}
 	}
+	if len(rowErrors) > 0 {
+		return candidate, rowErrors
+	}
 
-	response.ProcessedContacts = contacts
-	response.FieldSummary.ProcessedContacts = len(contacts)
+	// Validate email format
+	if !isValidEmail(originalContact.Email) {
+		return candidate, []models.ImportError{candidate.importError(models.ImportErrorInvalidEmail, fmt.Sprintf("Invalid email format: %s", originalContact.Email))}
+	}
 
-	return response, nil
+	return candidate, nil
 }
 
 // Helper function to validate email
@@ -658,5 +1121,26 @@ func isValidEmail(email string) bool {
 	if email == "" {
 		return false
 	}
-	return true // Simplified for now - add proper email validation if needed
+
+	// Accept bare addresses only, not display-name forms like "Jane <jane@example.com>"
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
+// originalContactRow flattens a typed import row for error reports
+func originalContactRow(contact models.OriginalContact) map[string]interface{} {
+	row := map[string]interface{}{
+		"name":       contact.Name,
+		"email":      contact.Email,
+		"phone":      contact.Phone,
+		"company":    contact.Company,
+		"title":      contact.Title,
+		"industry":   contact.Industry,
+		"location":   contact.Location,
+		"department": contact.Department,
+	}
+	for key, value := range contact.CustomFields {
+		row[key] = value
+	}
+	return row
 }
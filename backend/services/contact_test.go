@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"contact-enrichment-api/config"
+	"contact-enrichment-api/mailer"
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestWriteFailures(t *testing.T) {
+	batch := make([]pendingWrite, 3)
+	for i := range batch {
+		batch[i] = pendingWrite{
+			candidate: importCandidate{
+				row:         i + 2,
+				contact:     models.OriginalContact{Email: fmt.Sprintf("contact%d@example.com", i)},
+				emailColumn: "Email",
+			},
+			contact: models.Contact{ID: primitive.NewObjectID()},
+		}
+	}
+
+	bulkErr := func(writeErrors ...mongo.BulkWriteError) error {
+		return fmt.Errorf("bulk write: %w", mongo.BulkWriteException{WriteErrors: writeErrors})
+	}
+	writeErr := func(index, code int) mongo.BulkWriteError {
+		return mongo.BulkWriteError{WriteError: mongo.WriteError{Index: index, Code: code, Message: "rejected"}}
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		insert bool
+		want   map[int]models.ImportErrorCode // By batch index
+	}{
+		{
+			name: "no error",
+			want: map[int]models.ImportErrorCode{},
+		},
+		{
+			name:   "duplicate key names its document",
+			err:    bulkErr(writeErr(1, 11000)),
+			insert: true,
+			want:   map[int]models.ImportErrorCode{1: models.ImportErrorDuplicateKey},
+		},
+		{
+			name:   "several failures keep their indexes",
+			err:    bulkErr(writeErr(0, 121), writeErr(2, 11001)),
+			insert: true,
+			want:   map[int]models.ImportErrorCode{0: models.ImportErrorValidationFailed, 2: models.ImportErrorDuplicateKey},
+		},
+		{
+			name:   "other codes of inserts",
+			err:    bulkErr(writeErr(2, 2)),
+			insert: true,
+			want:   map[int]models.ImportErrorCode{2: models.ImportErrorInsertFailed},
+		},
+		{
+			name: "other codes of updates",
+			err:  bulkErr(writeErr(0, 2)),
+			want: map[int]models.ImportErrorCode{0: models.ImportErrorUpdateFailed},
+		},
+		{
+			name:   "indexes outside the batch are ignored",
+			err:    bulkErr(writeErr(-1, 11000), writeErr(3, 11000), writeErr(1, 121)),
+			insert: true,
+			want:   map[int]models.ImportErrorCode{1: models.ImportErrorValidationFailed},
+		},
+		{
+			name: "updates fail as a whole without write errors",
+			err:  errors.New("connection reset"),
+			want: map[int]models.ImportErrorCode{
+				0: models.ImportErrorUpdateFailed,
+				1: models.ImportErrorUpdateFailed,
+				2: models.ImportErrorUpdateFailed,
+			},
+		},
+		{
+			name: "write concern errors fail the whole batch",
+			err:  mongo.BulkWriteException{WriteConcernError: &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"}},
+			want: map[int]models.ImportErrorCode{
+				0: models.ImportErrorUpdateFailed,
+				1: models.ImportErrorUpdateFailed,
+				2: models.ImportErrorUpdateFailed,
+			},
+		},
+	}
+
+	s := &ContactService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := s.writeFailures(tt.err, batch, tt.insert)
+
+			if len(failures) != len(tt.want) {
+				t.Fatalf("got %d failures, want %d: %v", len(failures), len(tt.want), failures)
+			}
+			for index, code := range tt.want {
+				failure, ok := failures[index]
+				if !ok {
+					t.Fatalf("no failure for index %d", index)
+				}
+				if failure.Code != code {
+					t.Errorf("index %d: code %s, want %s", index, failure.Code, code)
+				}
+				if failure.Row != batch[index].candidate.row || failure.Value != batch[index].candidate.contact.Email {
+					t.Errorf("index %d: failure of row %d (%v), want row %d", index, failure.Row, failure.Value, batch[index].candidate.row)
+				}
+				if updated := failure.ExistingContactID != nil; updated == tt.insert {
+					t.Errorf("index %d: existing contact %v for insert %v", index, failure.ExistingContactID, tt.insert)
+				}
+			}
+		})
+	}
+}
+
+func TestAddUnmatchedUpdates(t *testing.T) {
+	db := newTestDatabase(t)
+	cfg := testConfig(&config.Config{})
+	outbox, err := mailer.NewOutboxMailer(t.TempDir(), "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewContactService(db, cfg, NewOrganizationService(db, cfg, outbox))
+
+	orgID, otherOrgID := primitive.NewObjectID(), primitive.NewObjectID()
+	kept := models.Contact{ID: primitive.NewObjectID(), OrgID: orgID}
+	moved := models.Contact{ID: primitive.NewObjectID(), OrgID: otherOrgID}
+	deleted := models.Contact{ID: primitive.NewObjectID(), OrgID: orgID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := s.contactCollection.InsertMany(ctx, []interface{}{kept, moved}); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := []pendingWrite{{contact: kept}, {contact: moved}, {contact: deleted}}
+	for i := range batch {
+		batch[i].candidate = importCandidate{row: i + 2, contact: models.OriginalContact{Email: fmt.Sprintf("contact%d@example.com", i)}}
+	}
+	failures := map[int]models.ImportError{}
+	s.addUnmatchedUpdates(orgID, batch, failures)
+
+	if _, failed := failures[0]; failed || len(failures) != 2 {
+		t.Fatalf("got failures %v, want the moved and the deleted contact", failures)
+	}
+	for _, index := range []int{1, 2} {
+		if failures[index].Code != models.ImportErrorUpdateFailed || failures[index].Row != batch[index].candidate.row {
+			t.Errorf("index %d: got %+v", index, failures[index])
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"contact-enrichment-api/config"
+	"contact-enrichment-api/database"
+	"contact-enrichment-api/mailer"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// newTestDatabase connects to the MongoDB of TEST_MONGODB_URI with a database of its own, dropped
+// after the test. Tests that need a database are skipped without it.
+func newTestDatabase(t *testing.T) *mongo.Database {
+	t.Helper()
+
+	uri := os.Getenv("TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URI is not set")
+	}
+
+	db, err := database.NewConnection(uri, "test_"+primitive.NewObjectID().Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = db.DB.Drop(ctx)
+		_ = db.Close()
+	})
+
+	return db.DB
+}
+
+// testConfig completes a configuration with the settings the services need, fast password hashing included
+func testConfig(cfg *config.Config) *config.Config {
+	cfg.DefaultTimeout = 10 * time.Second
+	cfg.BulkOperationTimeout = time.Minute
+	cfg.AppURL = "http://localhost:3000"
+	cfg.JWTAlgorithm = "HS256"
+	cfg.JWTSecret = "test-secret"
+	cfg.JWTIssuer = "contact-enrichment-api"
+	cfg.JWTAudience = "contact-enrichment-api"
+	cfg.JWTExpiration = 15 * time.Minute
+	cfg.RefreshTokenExpiration = time.Hour
+	cfg.AccountTokenSigningKey = "test-account-secret"
+	cfg.EmailVerificationExpiration = time.Hour
+	cfg.PasswordResetExpiration = time.Hour
+	cfg.MFAIssuer = "Test"
+	cfg.MFAChallengeExpiration = 5 * time.Minute
+	cfg.LoginMaxAttempts = 5
+	cfg.LoginIPMaxAttempts = 20
+	cfg.LoginAttemptWindow = 15 * time.Minute
+	cfg.LoginLockoutDuration = 15 * time.Minute
+	cfg.PasswordArgon2Memory = 1024
+	cfg.PasswordArgon2Iterations = 1
+	cfg.PasswordArgon2Parallelism = 1
+	cfg.PasswordMinLength = 10
+	return cfg
+}
+
+// newTestAuthService creates the auth service of a test database, with emails written to a temporary outbox
+func newTestAuthService(t *testing.T, db *mongo.Database, cfg *config.Config) *AuthService {
+	t.Helper()
+
+	outbox, err := mailer.NewOutboxMailer(t.TempDir(), "test@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthService(db, cfg, NewOrganizationService(db, cfg, outbox), outbox)
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exportBatchSize is the number of contacts fetched per cursor batch during an export
+const exportBatchSize = 500
+
+// ContactExport writes the contacts matching a filter with a selected set of columns
+type ContactExport struct {
+	service   *ContactService
+	filter    bson.M
+	format    string
+	columns   []string
+	threshold int
+	rows      int
+}
+
+// NewContactExport validates an export request and resolves its columns, so errors are reported
+// before anything is written
+func (s *ContactService) NewContactExport(orgID, userID string, req models.ExportContactsRequest) (*ContactExport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, errors.New("invalid organization ID")
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	if err := s.orgService.Authorize(ctx, orgObjectID, userObjectID, models.PermissionContactsExport); err != nil {
+		return nil, err
+	}
+
+	format := req.Format
+	if format == "" {
+		format = models.ExportFormatCSV
+	}
+
+	filter := contactFilter(orgObjectID, req.Status, req.Search)
+
+	// Keys of the map fields, each becomes a column when the matching wildcard is selected
+	dynamicKeys := make(map[string][]string)
+	paths := map[string]string{
+		models.ExportCustomFieldsPrefix:             "originalContact.customFields",
+		models.ExportSocialProfilesPrefix:           "enrichedContact.socialProfiles",
+		models.ExportSocialProfileConfidencesPrefix: "confidenceScores.socialProfiles",
+		models.ExportBestSocialProfilesPrefix:       "enrichedContact.socialProfiles",
+	}
+	for prefix, path := range paths {
+		keys, err := s.distinctKeys(ctx, filter, path)
+		if err != nil {
+			return nil, err
+		}
+		dynamicKeys[prefix] = keys
+	}
+
+	columns, err := models.ExpandExportColumns(req.Columns, dynamicKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContactExport{
+		service:   s,
+		filter:    filter,
+		format:    format,
+		columns:   columns,
+		threshold: s.bestValueThreshold(req.Threshold),
+	}, nil
+}
+
+func (e *ContactExport) Format() string {
+	return e.format
+}
+
+func (e *ContactExport) Columns() []string {
+	return e.columns
+}
+
+// Rows returns the number of contacts written by Write
+func (e *ContactExport) Rows() int {
+	return e.rows
+}
+
+// Write streams the export to w, reading the contacts through a cursor
+func (e *ContactExport) Write(w io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.service.config.BulkOperationTimeout)
+	defer cancel()
+
+	writer, err := newExportWriter(e.format, w)
+	if err != nil {
+		return err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetBatchSize(exportBatchSize)
+
+	cursor, err := e.service.contactCollection.Find(ctx, e.filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	if err := writer.writeHeader(e.columns); err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(e.columns))
+	for cursor.Next(ctx) {
+		var contact models.Contact
+		if err := cursor.Decode(&contact); err != nil {
+			return err
+		}
+
+		for i, column := range e.columns {
+			values[i] = contact.ExportValue(column, e.threshold)
+		}
+		if err := writer.writeRow(values); err != nil {
+			return err
+		}
+		e.rows++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	return writer.close()
+}
+
+// distinctKeys returns the sorted keys found in a map field of the matching contacts
+func (s *ContactService) distinctKeys(ctx context.Context, filter bson.M, path string) ([]string, error) {
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$project": bson.M{"keys": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$" + path, bson.M{}}}}}},
+		{"$unwind": "$keys"},
+		{"$group": bson.M{"_id": "$keys.k"}},
+		{"$sort": bson.M{"_id": 1}},
+	}
+
+	cursor, err := s.contactCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Key string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(results))
+	for i, result := range results {
+		keys[i] = result.Key
+	}
+	return keys, nil
+}
@@ -0,0 +1,507 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"contact-enrichment-api/config"
+	"contact-enrichment-api/models"
+	"contact-enrichment-api/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors of export jobs and their download links, mapped to specific status codes by the controller
+var (
+	ErrExportNotFound     = errors.New("export not found")
+	ErrExportNotReady     = errors.New("export has not completed")
+	ErrExportLinkInvalid  = errors.New("download link is invalid")
+	ErrExportLinkExpired  = errors.New("download link has expired")
+	ErrScheduleNotFound   = errors.New("export schedule not found")
+	errExportJobCancelled = errors.New("export job was deleted while running")
+)
+
+// Running jobs record a heartbeat, jobs without one for exportStaleAfter were interrupted, e.g. by a
+// restart, and are marked as failed
+const (
+	exportHeartbeatInterval = time.Minute
+	exportStaleAfter        = 5 * exportHeartbeatInterval
+)
+
+type ExportService struct {
+	exportCollection   *mongo.Collection
+	scheduleCollection *mongo.Collection
+	store              storage.BlobStore
+	contactService     *ContactService
+	config             *config.Config
+}
+
+func NewExportService(db *mongo.Database, cfg *config.Config, store storage.BlobStore, contactService *ContactService) *ExportService {
+	return &ExportService{
+		exportCollection:   db.Collection("exports"),
+		scheduleCollection: db.Collection("export_schedules"),
+		store:              store,
+		contactService:     contactService,
+		config:             cfg,
+	}
+}
+
+// CreateExportJob validates an export of the organization's contacts and runs it in the background
+func (s *ExportService) CreateExportJob(orgID, userID string, req models.CreateExportJobRequest) (*models.ExportJob, error) {
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, errors.New("invalid organization ID")
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	export, err := s.contactService.NewContactExport(orgID, userID, req.ExportContactsRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	job, err := s.insertJob(ctx, orgObjectID, userObjectID, nil, req.ExportContactsRequest, req.RetentionDays)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.runJob(job, export)
+
+	return job, nil
+}
+
+// GetExportJobs lists the exports the user ran in the organization
+func (s *ExportService) GetExportJobs(orgID, userID string, page, pageSize int, scheduleID string) (*models.ExportJobListResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	orgObjectID, userObjectID, err := s.authorizeExport(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"orgId": orgObjectID, "userId": userObjectID}
+	if scheduleID != "" {
+		scheduleObjectID, err := primitive.ObjectIDFromHex(scheduleID)
+		if err != nil {
+			return nil, errors.New("invalid schedule ID")
+		}
+		filter["scheduleId"] = scheduleObjectID
+	}
+
+	total, err := s.exportCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := (page - 1) * pageSize
+	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
+
+	opts := options.Find().
+		SetSkip(int64(skip)).
+		SetLimit(int64(pageSize)).
+		SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := s.exportCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []models.ExportJob{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		s.signDownload(&jobs[i])
+	}
+
+	return &models.ExportJobListResponse{
+		Exports:    jobs,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// GetExportJob returns a job, with a fresh download link once it has completed
+func (s *ExportService) GetExportJob(orgID, userID, exportID string) (*models.ExportJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	job, err := s.findJob(ctx, orgID, userID, exportID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.signDownload(job)
+	return job, nil
+}
+
+// DeleteExportJob deletes a job and its file. A running job is stopped once it notices.
+func (s *ExportService) DeleteExportJob(orgID, userID, exportID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	job, err := s.findJob(ctx, orgID, userID, exportID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.exportCollection.DeleteOne(ctx, bson.M{"_id": job.ID}); err != nil {
+		return err
+	}
+	s.deleteBlob(job)
+
+	return nil
+}
+
+// OpenDownload verifies a signed download link and opens the file of the job
+func (s *ExportService) OpenDownload(exportID, expires, signature string) (*models.ExportJob, io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	exportObjectID, err := primitive.ObjectIDFromHex(exportID)
+	if err != nil {
+		return nil, nil, ErrExportLinkInvalid
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, nil, ErrExportLinkInvalid
+	}
+
+	provided, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(provided, s.signature(exportObjectID, expiresAt)) {
+		return nil, nil, ErrExportLinkInvalid
+	}
+
+	if time.Now().Unix() > expiresAt {
+		return nil, nil, ErrExportLinkExpired
+	}
+
+	var job models.ExportJob
+	if err := s.exportCollection.FindOne(ctx, bson.M{"_id": exportObjectID}).Decode(&job); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, ErrExportNotFound
+		}
+		return nil, nil, err
+	}
+	if job.Status != models.ExportJobStatusCompleted {
+		return nil, nil, ErrExportNotReady
+	}
+
+	file, err := s.store.Open(exportKey(&job))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil, ErrExportNotFound
+		}
+		return nil, nil, err
+	}
+
+	return &job, file, nil
+}
+
+// StartCleanup deletes expired jobs and their files every interval
+func (s *ExportService) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := s.cleanupExpiredJobs(); err != nil {
+				log.Printf("Failed to clean up expired exports: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *ExportService) cleanupExpiredJobs() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	return s.deleteJobs(ctx, bson.M{"expiresAt": bson.M{"$lt": time.Now()}})
+}
+
+// deleteJobs deletes the jobs matching a filter and their files
+func (s *ExportService) deleteJobs(ctx context.Context, filter bson.M) error {
+	cursor, err := s.exportCollection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var jobs []models.ExportJob
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return err
+	}
+
+	for i := range jobs {
+		job := &jobs[i]
+		result, err := s.exportCollection.DeleteOne(ctx, bson.M{"_id": job.ID})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount > 0 {
+			s.deleteBlob(job)
+		}
+	}
+
+	return nil
+}
+
+func (s *ExportService) insertJob(ctx context.Context, orgObjectID, userObjectID primitive.ObjectID, scheduleID *primitive.ObjectID, req models.ExportContactsRequest, retentionDays int) (*models.ExportJob, error) {
+	if req.Format == "" {
+		req.Format = models.ExportFormatCSV
+	}
+	if retentionDays == 0 {
+		retentionDays = s.config.ExportRetentionDays
+	}
+
+	now := time.Now()
+	job := &models.ExportJob{
+		ID:         primitive.NewObjectID(),
+		OrgID:      orgObjectID,
+		UserID:     userObjectID,
+		ScheduleID: scheduleID,
+		Status:     models.ExportJobStatusPending,
+		Request:    req,
+		Filename:   fmt.Sprintf("contacts-%s.%s", now.UTC().Format("20060102-150405"), req.Format),
+		ExpiresAt:  now.AddDate(0, 0, retentionDays),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if _, err := s.exportCollection.InsertOne(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// runJob streams the export into the blob store and records the outcome on the job
+func (s *ExportService) runJob(job *models.ExportJob, export *ContactExport) {
+	if err := s.updateJob(job.ID, bson.M{"status": models.ExportJobStatusRunning, "heartbeatAt": time.Now()}); err != nil {
+		log.Printf("Failed to start export %s: %v", job.ID.Hex(), err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.heartbeat(job.ID, done)
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(export.Write(writer))
+	}()
+
+	size, err := s.store.WriteAt(exportKey(job), 0, reader)
+	reader.CloseWithError(err)
+
+	update := bson.M{"status": models.ExportJobStatusCompleted, "rows": export.Rows(), "size": size, "completed_at": time.Now()}
+	if err != nil {
+		log.Printf("Export %s failed: %v", job.ID.Hex(), err)
+		s.deleteBlob(job)
+		update = bson.M{"status": models.ExportJobStatusFailed, "error": err.Error(), "completed_at": time.Now()}
+	}
+
+	if err := s.finishJob(job.ID, update); err != nil {
+		if errors.Is(err, errExportJobCancelled) {
+			s.deleteBlob(job)
+			return
+		}
+		log.Printf("Failed to record the outcome of export %s: %v", job.ID.Hex(), err)
+	}
+}
+
+// heartbeat shows that a job is still running until done is closed
+func (s *ExportService) heartbeat(jobID primitive.ObjectID, done <-chan struct{}) {
+	ticker := time.NewTicker(exportHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+			_, err := s.exportCollection.UpdateOne(ctx,
+				bson.M{"_id": jobID, "status": models.ExportJobStatusRunning},
+				bson.M{"$set": bson.M{"heartbeatAt": time.Now()}},
+			)
+			cancel()
+			if err != nil {
+				log.Printf("Failed to record the heartbeat of export %s: %v", jobID.Hex(), err)
+			}
+		}
+	}
+}
+
+// failStaleJobs marks jobs that stopped running without an outcome as failed, so they do not stay
+// pending or running forever after a restart
+func (s *ExportService) failStaleJobs() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	cutoff := time.Now().Add(-exportStaleAfter)
+	unfinished := bson.M{"$in": bson.A{models.ExportJobStatusPending, models.ExportJobStatusRunning}}
+	cursor, err := s.exportCollection.Find(ctx, bson.M{
+		"status": unfinished,
+		"$or": bson.A{
+			bson.M{"heartbeatAt": bson.M{"$lt": cutoff}},
+			bson.M{"heartbeatAt": bson.M{"$exists": false}, "created_at": bson.M{"$lt": cutoff}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	var jobs []models.ExportJob
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range jobs {
+		job := &jobs[i]
+		result, err := s.exportCollection.UpdateOne(ctx,
+			bson.M{"_id": job.ID, "status": job.Status, "heartbeatAt": job.HeartbeatAt},
+			bson.M{"$set": bson.M{
+				"status":       models.ExportJobStatusFailed,
+				"error":        "the export was interrupted, e.g. by a server restart",
+				"completed_at": now,
+				"updated_at":   now,
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount > 0 {
+			log.Printf("Marked interrupted export %s as failed", job.ID.Hex())
+			s.deleteBlob(job)
+		}
+	}
+	return nil
+}
+
+func (s *ExportService) updateJob(jobID primitive.ObjectID, fields bson.M) error {
+	return s.setJobFields(bson.M{"_id": jobID}, fields)
+}
+
+// finishJob records the outcome of a job, unless it was deleted or marked as interrupted meanwhile
+func (s *ExportService) finishJob(jobID primitive.ObjectID, fields bson.M) error {
+	return s.setJobFields(bson.M{
+		"_id":    jobID,
+		"status": bson.M{"$in": bson.A{models.ExportJobStatusPending, models.ExportJobStatusRunning}},
+	}, fields)
+}
+
+func (s *ExportService) setJobFields(filter, fields bson.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	fields["updated_at"] = time.Now()
+	result, err := s.exportCollection.UpdateOne(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errExportJobCancelled
+	}
+	return nil
+}
+
+// authorizeExport checks that the user may still export the organization's contacts, jobs and
+// schedules are only reachable while the role allows it
+func (s *ExportService) authorizeExport(ctx context.Context, orgID, userID string) (primitive.ObjectID, primitive.ObjectID, error) {
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, errors.New("invalid organization ID")
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, errors.New("invalid user ID")
+	}
+
+	if err := s.contactService.orgService.Authorize(ctx, orgObjectID, userObjectID, models.PermissionContactsExport); err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, err
+	}
+	return orgObjectID, userObjectID, nil
+}
+
+// findJob returns a job the user ran in the organization
+func (s *ExportService) findJob(ctx context.Context, orgID, userID, exportID string) (*models.ExportJob, error) {
+	orgObjectID, userObjectID, err := s.authorizeExport(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	exportObjectID, err := primitive.ObjectIDFromHex(exportID)
+	if err != nil {
+		return nil, ErrExportNotFound
+	}
+
+	var job models.ExportJob
+	err = s.exportCollection.FindOne(ctx, bson.M{"_id": exportObjectID, "orgId": orgObjectID, "userId": userObjectID}).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// signDownload sets a download link valid for ExportURLExpiration on a completed job
+func (s *ExportService) signDownload(job *models.ExportJob) {
+	if job.Status != models.ExportJobStatusCompleted {
+		return
+	}
+
+	expiresAt := time.Now().Add(s.config.ExportURLExpiration)
+	if expiresAt.After(job.ExpiresAt) {
+		expiresAt = job.ExpiresAt
+	}
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", base64.RawURLEncoding.EncodeToString(s.signature(job.ID, expiresAt.Unix())))
+
+	job.DownloadURL = fmt.Sprintf("%s/api/v1/exports/%s/download?%s", s.config.PublicURL, job.ID.Hex(), query.Encode())
+	job.DownloadExpiresAt = &expiresAt
+}
+
+func (s *ExportService) signature(exportID primitive.ObjectID, expiresAt int64) []byte {
+	mac := hmac.New(sha256.New, []byte(s.config.ExportSigningKey))
+	fmt.Fprintf(mac, "export:%s:%d", exportID.Hex(), expiresAt)
+	return mac.Sum(nil)
+}
+
+func (s *ExportService) deleteBlob(job *models.ExportJob) {
+	if err := s.store.Delete(exportKey(job)); err != nil {
+		log.Printf("Failed to delete export file %s: %v", exportKey(job), err)
+	}
+}
+
+func exportKey(job *models.ExportJob) string {
+	return fmt.Sprintf("exports/%s.%s", job.ID.Hex(), job.Request.Format)
+}
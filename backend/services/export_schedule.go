@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateSchedule schedules recurring exports of the organization's contacts for the user
+func (s *ExportService) CreateSchedule(orgID, userID string, req models.ExportScheduleRequest) (*models.ExportSchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	orgObjectID, userObjectID, err := s.authorizeExport(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Columns are resolved when each job runs, unknown ones are rejected now
+	if _, err := models.ExpandExportColumns(req.Request.Columns, nil); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	schedule := &models.ExportSchedule{
+		ID:        primitive.NewObjectID(),
+		OrgID:     orgObjectID,
+		UserID:    userObjectID,
+		CreatedAt: now,
+	}
+	applyScheduleRequest(schedule, req, now)
+
+	if _, err := s.scheduleCollection.InsertOne(ctx, schedule); err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// GetSchedules lists the schedules of the user in the organization
+func (s *ExportService) GetSchedules(orgID, userID string) ([]models.ExportSchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	orgObjectID, userObjectID, err := s.authorizeExport(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := s.scheduleCollection.Find(ctx, bson.M{"orgId": orgObjectID, "userId": userObjectID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	schedules := []models.ExportSchedule{}
+	if err := cursor.All(ctx, &schedules); err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+func (s *ExportService) GetSchedule(orgID, userID, scheduleID string) (*models.ExportSchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	return s.findSchedule(ctx, orgID, userID, scheduleID)
+}
+
+// UpdateSchedule replaces the settings of a schedule and recomputes its next run
+func (s *ExportService) UpdateSchedule(orgID, userID, scheduleID string, req models.ExportScheduleRequest) (*models.ExportSchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	schedule, err := s.findSchedule(ctx, orgID, userID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := models.ExpandExportColumns(req.Request.Columns, nil); err != nil {
+		return nil, err
+	}
+
+	applyScheduleRequest(schedule, req, time.Now())
+
+	if _, err := s.scheduleCollection.ReplaceOne(ctx, bson.M{"_id": schedule.ID}, schedule); err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// DeleteSchedule stops a schedule, the exports it already produced are kept until they expire
+func (s *ExportService) DeleteSchedule(orgID, userID, scheduleID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	schedule, err := s.findSchedule(ctx, orgID, userID, scheduleID)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.scheduleCollection.DeleteOne(ctx, bson.M{"_id": schedule.ID})
+	return err
+}
+
+// StartScheduler checks for due schedules and interrupted jobs every interval. Interrupted jobs are
+// also checked right away, jobs that were running when the server stopped are failed once stale.
+func (s *ExportService) StartScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.failStaleJobs(); err != nil {
+				log.Printf("Failed to check for interrupted exports: %v", err)
+			}
+			<-ticker.C
+			if err := s.runDueSchedules(); err != nil {
+				log.Printf("Failed to run export schedules: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *ExportService) runDueSchedules() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	now := time.Now()
+	cursor, err := s.scheduleCollection.Find(ctx, bson.M{"enabled": true, "nextRunAt": bson.M{"$lte": now}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var schedules []models.ExportSchedule
+	if err := cursor.All(ctx, &schedules); err != nil {
+		return err
+	}
+
+	for i := range schedules {
+		schedule := &schedules[i]
+
+		// Claim the run by moving nextRunAt, so a run is started once even with several instances.
+		// Runs missed while the server was down are collapsed into this one.
+		claim := bson.M{"_id": schedule.ID, "nextRunAt": schedule.NextRunAt}
+		update := bson.M{"$set": bson.M{"nextRunAt": schedule.NextRun(now), "lastRunAt": now}}
+		result, err := s.scheduleCollection.UpdateOne(ctx, claim, update)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+
+		if err := s.runSchedule(schedule); err != nil {
+			log.Printf("Failed to start scheduled export %s: %v", schedule.ID.Hex(), err)
+		}
+	}
+
+	return nil
+}
+
+// runSchedule starts the export job of a due schedule. A request that no longer resolves,
+// e.g. because of a removed column, is recorded as a failed job so it shows up in the list.
+func (s *ExportService) runSchedule(schedule *models.ExportSchedule) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	job, err := s.insertJob(ctx, schedule.OrgID, schedule.UserID, &schedule.ID, schedule.Request, schedule.RetentionDays)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.scheduleCollection.UpdateOne(ctx, bson.M{"_id": schedule.ID}, bson.M{"$set": bson.M{"lastJobId": job.ID}}); err != nil {
+		log.Printf("Failed to record the last export of schedule %s: %v", schedule.ID.Hex(), err)
+	}
+
+	// Fails once the user lost access to the organization's contacts
+	export, err := s.contactService.NewContactExport(schedule.OrgID.Hex(), schedule.UserID.Hex(), schedule.Request)
+	if err != nil {
+		return s.updateJob(job.ID, bson.M{"status": models.ExportJobStatusFailed, "error": err.Error(), "completed_at": time.Now()})
+	}
+
+	go s.runJob(job, export)
+	return nil
+}
+
+// findSchedule returns a schedule of the user in the organization
+func (s *ExportService) findSchedule(ctx context.Context, orgID, userID, scheduleID string) (*models.ExportSchedule, error) {
+	orgObjectID, userObjectID, err := s.authorizeExport(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduleObjectID, err := primitive.ObjectIDFromHex(scheduleID)
+	if err != nil {
+		return nil, ErrScheduleNotFound
+	}
+
+	var schedule models.ExportSchedule
+	err = s.scheduleCollection.FindOne(ctx, bson.M{"_id": scheduleObjectID, "orgId": orgObjectID, "userId": userObjectID}).Decode(&schedule)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrScheduleNotFound
+		}
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+func applyScheduleRequest(schedule *models.ExportSchedule, req models.ExportScheduleRequest, now time.Time) {
+	request := req.Request
+	if request.Format == "" {
+		request.Format = models.ExportFormatCSV
+	}
+
+	schedule.Name = req.Name
+	schedule.Request = request
+	schedule.Frequency = req.Frequency
+	schedule.Hour = req.Hour
+	schedule.Minute = req.Minute
+	schedule.Weekday = req.Weekday
+	schedule.RetentionDays = req.RetentionDays
+	schedule.Enabled = req.Enabled == nil || *req.Enabled
+	schedule.NextRunAt = schedule.NextRun(now)
+	schedule.UpdatedAt = now
+}
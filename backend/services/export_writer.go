@@ -0,0 +1,262 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"contact-enrichment-api/models"
+)
+
+// exportWriter writes the rows of an export in one file format
+type exportWriter interface {
+	writeHeader(columns []string) error
+	writeRow(values []interface{}) error
+	close() error
+}
+
+func newExportWriter(format string, w io.Writer) (exportWriter, error) {
+	switch format {
+	case models.ExportFormatCSV:
+		return &csvExportWriter{writer: csv.NewWriter(w)}, nil
+	case models.ExportFormatJSON:
+		return &jsonExportWriter{writer: bufio.NewWriter(w)}, nil
+	case models.ExportFormatXLSX:
+		return &xlsxExportWriter{archive: zip.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// ExportContentType returns the MIME type of an export format
+func ExportContentType(format string) string {
+	switch format {
+	case models.ExportFormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case models.ExportFormatJSON:
+		return "application/json"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// exportString formats a value for the text based formats
+func exportString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(models.ExportTimeFormat)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(encoded)
+	default:
+		return reportValue(v)
+	}
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+	record []string
+}
+
+func (cw *csvExportWriter) writeHeader(columns []string) error {
+	cw.record = make([]string, len(columns))
+	return cw.writer.Write(columns)
+}
+
+func (cw *csvExportWriter) writeRow(values []interface{}) error {
+	for i, value := range values {
+		cw.record[i] = exportString(value)
+	}
+	return cw.writer.Write(cw.record)
+}
+
+func (cw *csvExportWriter) close() error {
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+// jsonExportWriter writes an array of objects whose keys keep the column order
+type jsonExportWriter struct {
+	writer  *bufio.Writer
+	columns [][]byte
+	rows    int
+}
+
+func (jw *jsonExportWriter) writeHeader(columns []string) error {
+	jw.columns = make([][]byte, len(columns))
+	for i, column := range columns {
+		encoded, err := json.Marshal(column)
+		if err != nil {
+			return err
+		}
+		jw.columns[i] = encoded
+	}
+	_, err := jw.writer.WriteString("[")
+	return err
+}
+
+func (jw *jsonExportWriter) writeRow(values []interface{}) error {
+	var row bytes.Buffer
+	if jw.rows > 0 {
+		row.WriteString(",")
+	}
+	row.WriteString("\n{")
+	for i, value := range values {
+		if i > 0 {
+			row.WriteString(",")
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		row.Write(jw.columns[i])
+		row.WriteString(":")
+		row.Write(encoded)
+	}
+	row.WriteString("}")
+	jw.rows++
+
+	_, err := jw.writer.Write(row.Bytes())
+	return err
+}
+
+func (jw *jsonExportWriter) close() error {
+	if _, err := jw.writer.WriteString("\n]\n"); err != nil {
+		return err
+	}
+	return jw.writer.Flush()
+}
+
+// Excel rejects cells longer than this
+const xlsxMaxCellLength = 32767
+
+// Static parts of the XLSX package, the worksheet is streamed
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Contacts" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`},
+	{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs></styleSheet>`},
+}
+
+// xlsxExportWriter writes a single sheet workbook. Rows are streamed into the zip archive,
+// so the file never has to be held in memory.
+type xlsxExportWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	row     int
+}
+
+func (xw *xlsxExportWriter) writeHeader(columns []string) error {
+	for _, part := range xlsxParts {
+		file, err := xw.archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := xw.archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	xw.sheet = bufio.NewWriter(sheet)
+	xw.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	xw.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	// Keep the header row visible while scrolling
+	xw.sheet.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	xw.sheet.WriteString(`<sheetData>`)
+
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		values[i] = column
+	}
+	return xw.writeCells(values, ` s="1"`)
+}
+
+func (xw *xlsxExportWriter) writeRow(values []interface{}) error {
+	return xw.writeCells(values, "")
+}
+
+func (xw *xlsxExportWriter) writeCells(values []interface{}, style string) error {
+	xw.row++
+	fmt.Fprintf(xw.sheet, `<row r="%d">`, xw.row)
+
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		ref := xlsxColumnName(i) + strconv.Itoa(xw.row)
+
+		switch v := value.(type) {
+		case int, int64, float64:
+			fmt.Fprintf(xw.sheet, `<c r="%s"%s><v>%s</v></c>`, ref, style, exportString(v))
+		case bool:
+			boolean := "0"
+			if v {
+				boolean = "1"
+			}
+			fmt.Fprintf(xw.sheet, `<c r="%s"%s t="b"><v>%s</v></c>`, ref, style, boolean)
+		default:
+			text := []rune(exportString(v))
+			if len(text) > xlsxMaxCellLength {
+				text = text[:xlsxMaxCellLength]
+			}
+			fmt.Fprintf(xw.sheet, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">`, ref, style)
+			if err := xml.EscapeText(xw.sheet, []byte(string(text))); err != nil {
+				return err
+			}
+			xw.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+
+	_, err := xw.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (xw *xlsxExportWriter) close() error {
+	if xw.sheet != nil {
+		xw.sheet.WriteString(`</sheetData></worksheet>`)
+		if err := xw.sheet.Flush(); err != nil {
+			return err
+		}
+	}
+	return xw.archive.Close()
+}
+
+// xlsxColumnName converts a zero-based column index to its spreadsheet name: A, B, ..., Z, AA, ...
+func xlsxColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
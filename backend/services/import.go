@@ -0,0 +1,433 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"contact-enrichment-api/config"
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrImportRunning is returned when rolling back an import that is still writing contacts
+var ErrImportRunning = errors.New("import is still running")
+
+type ImportService struct {
+	importCollection  *mongo.Collection
+	contactCollection *mongo.Collection
+	orgService        *OrganizationService
+	config            *config.Config
+}
+
+func NewImportService(db *mongo.Database, cfg *config.Config, orgService *OrganizationService) *ImportService {
+	return &ImportService{
+		importCollection:  db.Collection("imports"),
+		contactCollection: db.Collection("contacts"),
+		orgService:        orgService,
+		config:            cfg,
+	}
+}
+
+func (s *ImportService) GetImports(orgID string, page, pageSize int) (*models.ImportListResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, errors.New("invalid organization ID")
+	}
+
+	filter := bson.M{"orgId": orgObjectID}
+
+	total, err := s.importCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := (page - 1) * pageSize
+	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
+
+	opts := options.Find().
+		SetSkip(int64(skip)).
+		SetLimit(int64(pageSize)).
+		SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := s.importCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	imports := []models.ImportBatch{}
+	if err := cursor.All(ctx, &imports); err != nil {
+		return nil, err
+	}
+
+	return &models.ImportListResponse{
+		Imports:    imports,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: totalPages,
+	}, nil
+}
+
+func (s *ImportService) GetImportByID(orgID, importID string) (*models.ImportBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	return s.findImport(ctx, orgID, importID)
+}
+
+// RollbackImport deletes the contacts an import created, except those modified after the import.
+// Deleting contacts is reserved to members with the delete permission.
+func (s *ImportService) RollbackImport(orgID, userID, importID string) (*models.RollbackImportResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.BulkOperationTimeout)
+	defer cancel()
+
+	batch, err := s.findImport(ctx, orgID, importID)
+	if err != nil {
+		return nil, err
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	if err := s.orgService.Authorize(ctx, batch.OrgID, userObjectID, models.PermissionContactsDelete); err != nil {
+		return nil, err
+	}
+
+	if batch.Status == models.ImportStatusRolledBack {
+		return nil, errors.New("import has already been rolled back")
+	}
+	// Imports that stopped making progress, e.g. because the server restarted, can be rolled back
+	if batch.Status == models.ImportStatusRunning && time.Since(batch.UpdatedAt) < s.config.BulkOperationTimeout {
+		return nil, ErrImportRunning
+	}
+
+	// Contacts are written with identical created_at and updated_at, any later change moves updated_at
+	filter := bson.M{
+		"orgId":    batch.OrgID,
+		"importId": batch.ID,
+		"$expr":    bson.M{"$eq": bson.A{"$created_at", "$updated_at"}},
+	}
+
+	result, err := s.contactCollection.DeleteMany(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	modified, err := s.contactCollection.CountDocuments(ctx, bson.M{"orgId": batch.OrgID, "importId": batch.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	batch.Status = models.ImportStatusRolledBack
+	batch.RolledBackCount = result.DeletedCount
+	batch.RolledBackAt = &now
+
+	_, err = s.importCollection.UpdateOne(ctx, bson.M{"_id": batch.ID}, bson.M{
+		"$set": bson.M{
+			"status":          batch.Status,
+			"rolledBackCount": batch.RolledBackCount,
+			"rolledBackAt":    now,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.RollbackImportResponse{
+		Import:         *batch,
+		DeletedCount:   result.DeletedCount,
+		ModifiedCount:  modified,
+		UpdatedSkipped: batch.UpdatedCount,
+	}, nil
+}
+
+// WriteErrorReport writes one CSV line per failed row of an import: the error details followed by
+// the row as it was submitted, so the file can be fixed and re-uploaded. It covers the errors kept
+// on the record, see OmittedErrors.
+func (s *ImportService) WriteErrorReport(orgID, importID string, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	batch, err := s.findImport(ctx, orgID, importID)
+	if err != nil {
+		return err
+	}
+
+	// Group errors by row, keeping rows in import order
+	var rows []int
+	errorsByRow := make(map[int][]models.ImportError)
+	dataColumns := make(map[string]bool)
+	for _, importError := range batch.Errors {
+		if _, seen := errorsByRow[importError.Row]; !seen {
+			rows = append(rows, importError.Row)
+		}
+		errorsByRow[importError.Row] = append(errorsByRow[importError.Row], importError)
+		for column := range importError.RowData {
+			dataColumns[column] = true
+		}
+	}
+	sort.Ints(rows)
+
+	columns := make([]string, 0, len(dataColumns))
+	for column := range dataColumns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	writer := csv.NewWriter(w)
+	header := append([]string{"Error Row", "Error Code", "Error Message", "Error Column"}, columns...)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		rowErrors := errorsByRow[row]
+
+		var codes, messages, errorColumns []string
+		var rowData map[string]interface{}
+		for _, importError := range rowErrors {
+			codes = append(codes, string(importError.Code))
+			messages = append(messages, importError.Message)
+			if importError.Column != "" {
+				errorColumns = append(errorColumns, importError.Column)
+			}
+			if rowData == nil {
+				rowData = importError.RowData
+			}
+		}
+
+		record := []string{
+			strconv.Itoa(row),
+			strings.Join(codes, "; "),
+			strings.Join(messages, "; "),
+			strings.Join(errorColumns, "; "),
+		}
+		for _, column := range columns {
+			record = append(record, reportValue(rowData[column]))
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func reportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case primitive.DateTime:
+		return v.Time().Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func (s *ImportService) findImport(ctx context.Context, orgID, importID string) (*models.ImportBatch, error) {
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, errors.New("invalid organization ID")
+	}
+
+	importObjectID, err := primitive.ObjectIDFromHex(importID)
+	if err != nil {
+		return nil, errors.New("invalid import ID")
+	}
+
+	var batch models.ImportBatch
+	err = s.importCollection.FindOne(ctx, bson.M{"_id": importObjectID, "orgId": orgObjectID}).Decode(&batch)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("import not found")
+		}
+		return nil, err
+	}
+
+	return &batch, nil
+}
+
+// newImportBatch makes the record of a bulk import. It is inserted by startImportBatch before any
+// contact is written, and completed by finishImportBatch.
+func newImportBatch(orgObjectID, userObjectID primitive.ObjectID, source string, mode models.ImportMode, totalRows int) *models.ImportBatch {
+	if mode == "" {
+		mode = models.ImportModeSkip
+	}
+
+	now := time.Now()
+	return &models.ImportBatch{
+		ID:        primitive.NewObjectID(),
+		OrgID:     orgObjectID,
+		UserID:    userObjectID,
+		Source:    source,
+		Status:    models.ImportStatusRunning,
+		Mode:      mode,
+		TotalRows: totalRows,
+		Errors:    []models.ImportError{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// setImportOutcome copies the counts and errors of a finished import onto its record, keeping
+// errors up to the caps like streamed imports do
+func setImportOutcome(batch *models.ImportBatch, outcome *importOutcome, importErrors []models.ImportError, skipped int) {
+	batch.CreatedCount = len(outcome.created)
+	batch.UpdatedCount = len(outcome.updated)
+	batch.UnchangedCount = outcome.unchanged
+	batch.SkippedCount = skipped
+	batch.Errors = []models.ImportError{}
+	batch.OmittedErrors = 0
+
+	storedBytes := 0
+	for _, importError := range importErrors {
+		keepImportError(batch, importError, &storedBytes)
+	}
+}
+
+// Limits of a single error kept on an import record
+const (
+	maxStoredErrorText    = 256      // Bytes of the value and message, longer ones are shortened
+	maxStoredRowDataBytes = 64 << 10 // Row data of larger rows is not kept, they are left out of the error report
+)
+
+// keepImportError adds an error to the import record while it holds fewer than MaxImportErrors
+// errors and MaxImportErrorBytes of them, and counts it as omitted otherwise. storedBytes is the
+// encoded size of the errors kept so far.
+func keepImportError(batch *models.ImportBatch, importError models.ImportError, storedBytes *int) {
+	if len(batch.Errors) >= models.MaxImportErrors {
+		batch.OmittedErrors++
+		return
+	}
+
+	if value, ok := importError.Value.(string); ok {
+		importError.Value = truncateImportText(value)
+	}
+	importError.Message = truncateImportText(importError.Message)
+	if importError.RowData != nil {
+		if data, err := bson.Marshal(importError.RowData); err != nil || len(data) > maxStoredRowDataBytes {
+			importError.RowData = nil
+		}
+	}
+
+	data, err := bson.Marshal(importError)
+	if err != nil || *storedBytes+len(data) > models.MaxImportErrorBytes {
+		batch.OmittedErrors++
+		return
+	}
+	*storedBytes += len(data)
+	batch.Errors = append(batch.Errors, importError)
+}
+
+// truncateImportText shortens text to maxStoredErrorText bytes, without splitting a character
+func truncateImportText(text string) string {
+	if len(text) <= maxStoredErrorText {
+		return text
+	}
+	cut := maxStoredErrorText
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "…"
+}
+
+// startImportBatch inserts the record of a running import, so the contacts written with its ID can
+// always be listed and rolled back
+func (s *ContactService) startImportBatch(ctx context.Context, batch *models.ImportBatch) error {
+	_, err := s.importCollection.InsertOne(ctx, batch)
+	return err
+}
+
+// saveImportProgress stores the counts and errors of a running import so far
+func (s *ContactService) saveImportProgress(ctx context.Context, batch *models.ImportBatch) error {
+	batch.UpdatedAt = time.Now()
+	_, err := s.importCollection.UpdateOne(ctx,
+		bson.M{"_id": batch.ID, "status": models.ImportStatusRunning},
+		bson.M{"$set": importProgressFields(batch)},
+	)
+	return err
+}
+
+// finishImportBatch stores the outcome of a finished import on its record.
+// It uses its own timeout so a bulk import that ran out of time is still recorded.
+func (s *ContactService) finishImportBatch(batch *models.ImportBatch, importErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	batch.Status = models.ImportStatusCompleted
+	if importErr != nil {
+		batch.Status = models.ImportStatusFailed
+		batch.FailureReason = importErr.Error()
+	}
+	batch.CompletedAt = time.Now()
+	batch.UpdatedAt = batch.CompletedAt
+
+	fields := importProgressFields(batch)
+	fields["status"] = batch.Status
+	fields["completed_at"] = batch.CompletedAt
+	if batch.FailureReason != "" {
+		fields["failureReason"] = batch.FailureReason
+	}
+	// Streamed imports learn their mapping from the header, after the record was inserted
+	if batch.FieldMapping != nil {
+		fields["fieldMapping"] = batch.FieldMapping
+		fields["transforms"] = batch.Transforms
+	}
+	if batch.TemplateID != nil {
+		fields["templateId"] = batch.TemplateID
+	}
+	if batch.Preset != "" {
+		fields["preset"] = batch.Preset
+	}
+
+	result, err := s.importCollection.UpdateOne(ctx,
+		bson.M{"_id": batch.ID, "status": models.ImportStatusRunning},
+		bson.M{"$set": fields},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record import %s: %w", batch.ID.Hex(), err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("import %s was rolled back before it finished", batch.ID.Hex())
+	}
+	return nil
+}
+
+func importProgressFields(batch *models.ImportBatch) bson.M {
+	return bson.M{
+		"totalRows":      batch.TotalRows,
+		"createdCount":   batch.CreatedCount,
+		"updatedCount":   batch.UpdatedCount,
+		"unchangedCount": batch.UnchangedCount,
+		"skippedCount":   batch.SkippedCount,
+		"errors":         batch.Errors,
+		"omittedErrors":  batch.OmittedErrors,
+		"updated_at":     batch.UpdatedAt,
+	}
+}
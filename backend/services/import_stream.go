@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultStreamBatchSize is the number of lines a streamed import buffers before writing them
+const DefaultStreamBatchSize = 500
+
+// ImportStream imports contacts delivered one line at a time. Lines are buffered until a batch is full,
+// then written and resolved in line order, so memory use depends on the batch size only.
+type ImportStream struct {
+	service      *ContactService
+	orgObjectID  primitive.ObjectID
+	userObjectID primitive.ObjectID
+	mode         models.ImportMode
+	batchSize    int
+	batch        *models.ImportBatch
+
+	// Mapping applied by AddRow to rows that are not in the originalContact format
+	pipeline      *transformPipeline
+	fieldMappings map[string]string
+	sourceColumns map[string]string
+
+	pending    []streamLine
+	errorBytes int // Encoded size of the errors kept on the record
+}
+
+// streamLine is a buffered input line, either a candidate or a line that already failed validation
+type streamLine struct {
+	line      int
+	candidate *importCandidate
+	errs      []models.ImportError
+}
+
+// NewImportStream starts a streamed import, the caller must call Close once the input ends
+func (s *ContactService) NewImportStream(orgID, userID string, mode models.ImportMode, batchSize int) (*ImportStream, error) {
+	if err := s.authorize(orgID, userID, models.PermissionContactsWrite); err != nil {
+		return nil, err
+	}
+
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, errors.New("invalid organization ID")
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	return s.newImportStream(orgObjectID, userObjectID, models.ImportSourceStream, mode, batchSize)
+}
+
+// newImportStream inserts the record of the import and returns the stream writing to it
+func (s *ContactService) newImportStream(orgObjectID, userObjectID primitive.ObjectID, source string, mode models.ImportMode, batchSize int) (*ImportStream, error) {
+	if batchSize < 1 || batchSize > 1000 {
+		batchSize = DefaultStreamBatchSize
+	}
+
+	batch := newImportBatch(orgObjectID, userObjectID, source, mode, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+	if err := s.startImportBatch(ctx, batch); err != nil {
+		return nil, err
+	}
+
+	return &ImportStream{
+		service:      s,
+		orgObjectID:  orgObjectID,
+		userObjectID: userObjectID,
+		mode:         mode,
+		batchSize:    batchSize,
+		batch:        batch,
+	}, nil
+}
+
+// useMapping makes AddRow transform and map rows, the mapping is recorded on the import
+func (st *ImportStream) useMapping(pipeline *transformPipeline, transforms []models.TransformRule, resolution *fieldMappingResolution, detectedFields []string, preset *models.ImportPreset) {
+	st.pipeline = pipeline
+	st.fieldMappings = resolution.mappings
+	st.sourceColumns = mappedSourceColumns(detectedFields, resolution.mappings)
+	st.batch.FieldMapping = resolution.mappings
+	st.batch.TemplateID = resolution.templateID
+	st.batch.Transforms = transforms
+	if preset != nil {
+		st.batch.Preset = preset.ID
+	}
+}
+
+// ImportID identifies the import record the stream writes to
+func (st *ImportStream) ImportID() primitive.ObjectID {
+	return st.batch.ID
+}
+
+// AddLine buffers one NDJSON line and returns the results of the batch it completed, if any
+func (st *ImportStream) AddLine(line int, data []byte) ([]models.StreamImportResult, error) {
+	st.batch.TotalRows++
+
+	var contact models.OriginalContact
+	if err := json.Unmarshal(data, &contact); err != nil {
+		st.pending = append(st.pending, streamLine{line: line, errs: []models.ImportError{{
+			Row:     line,
+			Code:    models.ImportErrorInvalidJSON,
+			Message: fmt.Sprintf("Invalid JSON: %v", err),
+			Value:   truncateImportText(string(data)),
+		}}})
+		return st.flushIfFull()
+	}
+
+	candidate := importCandidate{
+		row:         line,
+		contact:     contact,
+		rowData:     originalContactRow(contact),
+		emailColumn: "email",
+	}
+
+	var lineErr *models.ImportError
+	switch {
+	case contact.Name == "":
+		lineErr = &models.ImportError{Row: line, Column: "name", Field: "name", Code: models.ImportErrorMissingRequired, Message: "Missing required field name", RowData: candidate.rowData}
+	case contact.Email == "":
+		lineErr = &models.ImportError{Row: line, Column: "email", Field: "email", Code: models.ImportErrorMissingRequired, Message: "Missing required field email", RowData: candidate.rowData}
+	case !isValidEmail(contact.Email):
+		importError := candidate.importError(models.ImportErrorInvalidEmail, fmt.Sprintf("Invalid email format: %s", contact.Email))
+		lineErr = &importError
+	}
+
+	if lineErr != nil {
+		st.pending = append(st.pending, streamLine{line: line, errs: []models.ImportError{*lineErr}})
+	} else {
+		st.pending = append(st.pending, streamLine{line: line, candidate: &candidate})
+	}
+
+	return st.flushIfFull()
+}
+
+// AddRow buffers one row of named columns, transformed and mapped with the stream's mapping
+func (st *ImportStream) AddRow(line int, row map[string]interface{}) ([]models.StreamImportResult, error) {
+	st.batch.TotalRows++
+
+	contactData, transformErr := st.pipeline.apply(row)
+	if transformErr != nil {
+		st.pending = append(st.pending, streamLine{line: line, errs: []models.ImportError{{
+			Row:     line,
+			Column:  transformErr.column,
+			Code:    models.ImportErrorTransformFailed,
+			Message: fmt.Sprintf("Transform failed: %v", transformErr.err),
+			Value:   row[transformErr.column],
+			RowData: row,
+		}}})
+		return st.flushIfFull()
+	}
+
+	candidate, rowErrors := mappedCandidate(line, contactData, row, st.fieldMappings, st.sourceColumns)
+	if len(rowErrors) > 0 {
+		st.pending = append(st.pending, streamLine{line: line, errs: rowErrors})
+	} else {
+		st.pending = append(st.pending, streamLine{line: line, candidate: &candidate})
+	}
+
+	return st.flushIfFull()
+}
+
+// AddError records a line that could not be read at all, e.g. because it exceeds the maximum line size
+func (st *ImportStream) AddError(line int, code models.ImportErrorCode, message string) ([]models.StreamImportResult, error) {
+	st.batch.TotalRows++
+	st.pending = append(st.pending, streamLine{line: line, errs: []models.ImportError{{Row: line, Code: code, Message: message}}})
+	return st.flushIfFull()
+}
+
+func (st *ImportStream) flushIfFull() ([]models.StreamImportResult, error) {
+	if len(st.pending) < st.batchSize {
+		return nil, nil
+	}
+	return st.Flush()
+}
+
+// Flush writes the buffered lines and returns one result per line in line order
+func (st *ImportStream) Flush() ([]models.StreamImportResult, error) {
+	if len(st.pending) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), st.service.config.BulkOperationTimeout)
+	defer cancel()
+
+	var candidates []importCandidate
+	for _, pending := range st.pending {
+		if pending.candidate != nil {
+			candidates = append(candidates, *pending.candidate)
+		}
+	}
+
+	outcome, err := st.service.importContacts(ctx, st.orgObjectID, st.userObjectID, st.batch.ID, candidates, st.mode)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsByLine := make(map[int]models.ImportContactResult, len(outcome.results))
+	for _, result := range outcome.results {
+		resultsByLine[result.Row] = result
+	}
+	errorsByLine := make(map[int]models.ImportError, len(outcome.errors))
+	for _, importError := range outcome.errors {
+		errorsByLine[importError.Row] = importError
+	}
+
+	results := make([]models.StreamImportResult, 0, len(st.pending))
+	for _, pending := range st.pending {
+		if len(pending.errs) > 0 {
+			results = append(results, st.recordError(pending.line, pending.errs...))
+			continue
+		}
+
+		if importError, failed := errorsByLine[pending.line]; failed {
+			results = append(results, st.recordError(pending.line, importError))
+			continue
+		}
+
+		result := resultsByLine[pending.line]
+		contactID := result.ContactID
+		results = append(results, models.StreamImportResult{
+			Line:          pending.line,
+			Status:        string(result.Action),
+			ID:            &contactID,
+			Email:         result.Email,
+			ChangedFields: result.ChangedFields,
+		})
+	}
+
+	st.batch.CreatedCount += len(outcome.created)
+	st.batch.UpdatedCount += len(outcome.updated)
+	st.batch.UnchangedCount += outcome.unchanged
+	st.pending = st.pending[:0]
+
+	// Progress is best effort, Close stores the counts again
+	if err := st.service.saveImportProgress(ctx, st.batch); err != nil {
+		log.Printf("Failed to save the progress of import %s: %v", st.batch.ID.Hex(), err)
+	}
+
+	return results, nil
+}
+
+// recordError counts a failed line and keeps its errors on the import record, up to the caps of
+// MaxImportErrors and MaxImportErrorBytes. The result of the line carries the first error.
+func (st *ImportStream) recordError(line int, importErrors ...models.ImportError) models.StreamImportResult {
+	st.batch.SkippedCount++
+	for _, importError := range importErrors {
+		keepImportError(st.batch, importError, &st.errorBytes)
+	}
+
+	importError := importErrors[0]
+
+	status := models.StreamStatusError
+	if importError.Code == models.ImportErrorDuplicateInDB || importError.Code == models.ImportErrorDuplicateInBatch {
+		status = models.StreamStatusSkipped
+	}
+
+	result := models.StreamImportResult{
+		Line:   line,
+		Status: status,
+		Error:  &importError,
+	}
+	if email, ok := importError.Value.(string); ok && importError.Field == "email" {
+		result.Email = email
+	}
+	if importError.ExistingContactID != nil {
+		result.ID = importError.ExistingContactID
+	}
+	return result
+}
+
+// Close flushes the remaining lines and stores the outcome on the import record. It returns an
+// error when either fails.
+func (st *ImportStream) Close(streamErr error) ([]models.StreamImportResult, error) {
+	results, err := st.Flush()
+	if streamErr == nil {
+		streamErr = err
+	}
+
+	if finishErr := st.service.finishImportBatch(st.batch, streamErr); err == nil {
+		err = finishErr
+	}
+	return results, err
+}
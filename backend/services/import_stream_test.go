@@ -0,0 +1,108 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Size of the largest document MongoDB stores
+const maxDocumentBytes = 16 << 20
+
+func TestImportStreamRecordSizeOfOversizedLines(t *testing.T) {
+	const lines = 1100
+	stream := &ImportStream{
+		batchSize: lines + 1, // Lines stay buffered, flushing needs the database
+		batch:     newImportBatch(primitive.NewObjectID(), primitive.NewObjectID(), models.ImportSourceStream, models.ImportModeSkip, 0),
+	}
+
+	line := append([]byte(`{"name": "`), bytes.Repeat([]byte("x"), MaxStreamLineSize-20)...)
+	for i := 1; i <= lines; i++ {
+		if _, err := stream.AddLine(i, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Invalid lines are recorded by Flush without reaching the database
+	for _, pending := range stream.pending {
+		result := stream.recordError(pending.line, pending.errs...)
+		if value := fmt.Sprint(result.Error.Value); len(value) > maxStoredErrorText+len("…") {
+			t.Fatalf("result of line %d carries a value of %d bytes", pending.line, len(value))
+		}
+	}
+
+	assertImportRecordSize(t, stream.batch, lines)
+}
+
+func TestSetImportOutcomeRecordSizeOfLargeRows(t *testing.T) {
+	row := make(map[string]interface{})
+	for i := 0; i < 100; i++ {
+		row[fmt.Sprintf("Column %d", i)] = strings.Repeat("y", 10<<10)
+	}
+	smallRow := map[string]interface{}{"Email": "jane@example", "Name": "Jane"}
+
+	var importErrors []models.ImportError
+	for i := 0; i < 1500; i++ {
+		importError := models.ImportError{Row: i + 2, Code: models.ImportErrorInvalidEmail, Message: "Invalid email format", RowData: smallRow}
+		if i%2 == 0 {
+			importError.Value = strings.Repeat("z", 100<<10)
+			importError.RowData = row
+		}
+		importErrors = append(importErrors, importError)
+	}
+
+	batch := newImportBatch(primitive.NewObjectID(), primitive.NewObjectID(), models.ImportSourceBulkEnhanced, models.ImportModeSkip, len(importErrors))
+	setImportOutcome(batch, &importOutcome{}, importErrors, len(importErrors))
+
+	assertImportRecordSize(t, batch, len(importErrors))
+	for _, importError := range batch.Errors {
+		if importError.Row%2 == 0 && importError.RowData != nil {
+			t.Fatalf("row data of the large row %d was kept", importError.Row)
+		}
+		if importError.Row%2 == 1 && importError.RowData == nil {
+			t.Fatalf("row data of a small row %d was dropped", importError.Row)
+		}
+	}
+}
+
+func TestSetImportOutcomeStopsAtTheByteCap(t *testing.T) {
+	row := map[string]interface{}{"Notes": strings.Repeat("n", maxStoredRowDataBytes-1024)}
+
+	var importErrors []models.ImportError
+	for i := 0; i < 200; i++ {
+		importErrors = append(importErrors, models.ImportError{Row: i + 2, Code: models.ImportErrorMissingRequired, Message: "Missing required field email", RowData: row})
+	}
+
+	batch := newImportBatch(primitive.NewObjectID(), primitive.NewObjectID(), models.ImportSourceBulk, models.ImportModeSkip, len(importErrors))
+	setImportOutcome(batch, &importOutcome{}, importErrors, len(importErrors))
+
+	if batch.OmittedErrors == 0 || len(batch.Errors) == 0 {
+		t.Errorf("kept %d errors and omitted %d, want the byte cap to apply", len(batch.Errors), batch.OmittedErrors)
+	}
+	assertImportRecordSize(t, batch, len(importErrors))
+}
+
+func assertImportRecordSize(t *testing.T, batch *models.ImportBatch, errorCount int) {
+	t.Helper()
+
+	if got := len(batch.Errors) + batch.OmittedErrors; got != errorCount {
+		t.Errorf("kept %d and omitted %d errors, want %d in total", len(batch.Errors), batch.OmittedErrors, errorCount)
+	}
+	if len(batch.Errors) > models.MaxImportErrors {
+		t.Errorf("kept %d errors, want at most %d", len(batch.Errors), models.MaxImportErrors)
+	}
+
+	data, err := bson.Marshal(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > models.MaxImportErrorBytes+64<<10 || len(data) > maxDocumentBytes {
+		t.Errorf("record of %d bytes, want at most %d", len(data), models.MaxImportErrorBytes)
+	}
+}
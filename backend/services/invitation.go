@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"contact-enrichment-api/mailer"
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvitationNotFound is returned for invitations that do not exist, expired, or are for another address
+var ErrInvitationNotFound = errors.New("invitation not found")
+
+// InviteMember invites an email address to the organization. Admins can invite members, only owners
+// can invite owners. The response is the same whether or not an account uses the address, so
+// invitations cannot be used to find out who has an account. Inviting an address again replaces
+// the role and restarts the expiry.
+func (s *OrganizationService) InviteMember(userID, orgID string, req models.InviteMemberRequest) (*models.Invitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	org, actor, err := s.findMemberOrganization(ctx, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requirePermission(actor, memberPermission(req.Role)); err != nil {
+		return nil, err
+	}
+
+	// Members are visible to whoever may invite, so refusing them reveals nothing
+	email := invitationEmail(req.Email)
+	var user models.User
+	err = s.userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if err == nil {
+		if _, err := s.findMembership(ctx, org.ID, user.ID); err == nil {
+			return nil, ErrAlreadyOrgMember
+		} else if !errors.Is(err, ErrNotOrgMember) {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	var invitation models.Invitation
+	err = s.invitationCollection.FindOneAndUpdate(ctx,
+		bson.M{"orgId": org.ID, "email": email},
+		bson.M{
+			"$set": bson.M{
+				"role":      req.Role,
+				"invitedBy": actor.UserID,
+				"expiresAt": now.Add(s.config.InvitationExpiration),
+			},
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "created_at": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sent in the background so the response takes as long for existing and unknown addresses
+	go s.sendInvitationEmail(*org, invitation)
+
+	return &invitation, nil
+}
+
+// GetInvitations lists the pending invitations of an organization, for those who may invite
+func (s *OrganizationService) GetInvitations(userID, orgID string) ([]models.Invitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	org, actor, err := s.findMemberOrganization(ctx, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requirePermission(actor, models.PermissionMembersManage); err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := s.invitationCollection.Find(ctx, bson.M{"orgId": org.ID, "expiresAt": bson.M{"$gt": time.Now()}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	invitations := []models.Invitation{}
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation withdraws a pending invitation. Only owners can revoke an invitation as owner.
+func (s *OrganizationService) RevokeInvitation(userID, orgID, invitationID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	org, actor, err := s.findMemberOrganization(ctx, userID, orgID)
+	if err != nil {
+		return err
+	}
+
+	invitationObjectID, err := primitive.ObjectIDFromHex(invitationID)
+	if err != nil {
+		return ErrInvitationNotFound
+	}
+
+	var invitation models.Invitation
+	err = s.invitationCollection.FindOne(ctx, bson.M{"_id": invitationObjectID, "orgId": org.ID}).Decode(&invitation)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrInvitationNotFound
+		}
+		return err
+	}
+	if err := requirePermission(actor, memberPermission(invitation.Role)); err != nil {
+		return err
+	}
+
+	_, err = s.invitationCollection.DeleteOne(ctx, bson.M{"_id": invitation.ID})
+	return err
+}
+
+// GetUserInvitations lists the pending invitations of the user's address. Addresses have to be
+// verified first, otherwise anyone could register with an invited address and accept.
+func (s *OrganizationService) GetUserInvitations(userID string) ([]models.InvitationResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	user, err := s.findInvitee(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	filter := bson.M{"email": invitationEmail(user.Email), "expiresAt": bson.M{"$gt": time.Now()}}
+	cursor, err := s.invitationCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var invitations []models.Invitation
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+
+	orgIDs := make([]primitive.ObjectID, len(invitations))
+	for i, invitation := range invitations {
+		orgIDs[i] = invitation.OrgID
+	}
+	orgCursor, err := s.orgCollection.Find(ctx, bson.M{"_id": bson.M{"$in": orgIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer orgCursor.Close(ctx)
+
+	var orgs []models.Organization
+	if err := orgCursor.All(ctx, &orgs); err != nil {
+		return nil, err
+	}
+	names := make(map[primitive.ObjectID]string, len(orgs))
+	for _, org := range orgs {
+		names[org.ID] = org.Name
+	}
+
+	responses := make([]models.InvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		name, exists := names[invitation.OrgID]
+		if !exists {
+			continue
+		}
+		responses = append(responses, models.InvitationResponse{Invitation: invitation, OrganizationName: name})
+	}
+	return responses, nil
+}
+
+// AcceptInvitation makes the user a member of the organization with the invited role. The
+// invitation is used up, accepting it twice fails.
+func (s *OrganizationService) AcceptInvitation(userID, invitationID string) (*models.OrganizationResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	user, err := s.findInvitee(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	invitation, err := s.takeInvitation(ctx, user, invitationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var org models.Organization
+	if err := s.orgCollection.FindOne(ctx, bson.M{"_id": invitation.OrgID}).Decode(&org); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	membership := models.Membership{
+		ID:        primitive.NewObjectID(),
+		OrgID:     org.ID,
+		UserID:    user.ID,
+		Role:      invitation.Role,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := s.membershipCollection.InsertOne(ctx, membership); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrAlreadyOrgMember
+		}
+		return nil, err
+	}
+
+	return &models.OrganizationResponse{Organization: org, Role: membership.Role}, nil
+}
+
+// DeclineInvitation deletes an invitation of the user's address without joining
+func (s *OrganizationService) DeclineInvitation(userID, invitationID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	user, err := s.findInvitee(ctx, userID)
+	if err != nil {
+		return err
+	}
+	_, err = s.takeInvitation(ctx, user, invitationID)
+	return err
+}
+
+// findInvitee returns the user, who can only see invitations once their address is verified
+func (s *OrganizationService) findInvitee(ctx context.Context, userID string) (*models.User, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	var user models.User
+	if err := s.userCollection.FindOne(ctx, bson.M{"_id": userObjectID}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	return &user, nil
+}
+
+// takeInvitation deletes a pending invitation of the user's address and returns it
+func (s *OrganizationService) takeInvitation(ctx context.Context, user *models.User, invitationID string) (*models.Invitation, error) {
+	invitationObjectID, err := primitive.ObjectIDFromHex(invitationID)
+	if err != nil {
+		return nil, ErrInvitationNotFound
+	}
+
+	var invitation models.Invitation
+	err = s.invitationCollection.FindOneAndDelete(ctx, bson.M{
+		"_id":       invitationObjectID,
+		"email":     invitationEmail(user.Email),
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&invitation)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (s *OrganizationService) sendInvitationEmail(org models.Organization, invitation models.Invitation) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	err := s.mailer.Send(ctx, mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You were invited to %s", org.Name),
+		Body: fmt.Sprintf("Hi,\n\nYou were invited to join %s as %s. Sign in, or create an account with this "+
+			"address, to accept the invitation:\n\n%s\n\nThe invitation expires in %s. If you do not want to "+
+			"join, you can ignore this email.\n",
+			org.Name, invitation.Role, s.config.AppURL+"/invitations", s.config.InvitationExpiration),
+	})
+	if err != nil {
+		log.Printf("Failed to send invitation email of invitation %s: %v", invitation.ID.Hex(), err)
+	}
+}
+
+// invitationEmail normalizes addresses, so invitations match however the address was typed
+func invitationEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
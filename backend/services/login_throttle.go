@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"contact-enrichment-api/mailer"
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrTooManyLoginAttempts is matched by LoginThrottledError
+var ErrTooManyLoginAttempts = errors.New("too many failed login attempts, try again later")
+
+// LoginThrottledError is returned while an email address or IP has to wait before the next login attempt
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return ErrTooManyLoginAttempts.Error()
+}
+
+func (e *LoginThrottledError) Is(target error) bool {
+	return target == ErrTooManyLoginAttempts
+}
+
+// Attempts are tracked per address whether or not an account uses it, so throttling does not reveal accounts
+func emailAttemptsKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptsKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkLoginAttempts returns a LoginThrottledError when any of the keys is locked or still has to wait
+func (s *AuthService) checkLoginAttempts(ctx context.Context, keys ...string) error {
+	cursor, err := s.loginAttemptCollection.Find(ctx, bson.M{"_id": bson.M{"$in": keys}})
+	if err != nil {
+		return err
+	}
+	var attempts []models.LoginAttempts
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	for i := range attempts {
+		if w := s.loginWait(&attempts[i], now); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// loginWait is how long the next attempt has to wait: until the end of a lockout, or a delay
+// that doubles with every failure
+func (s *AuthService) loginWait(attempts *models.LoginAttempts, now time.Time) time.Duration {
+	if attempts.LockedUntil != nil {
+		if now.Before(*attempts.LockedUntil) {
+			return attempts.LockedUntil.Sub(now)
+		}
+		return 0
+	}
+	if now.Sub(attempts.LastFailureAt) > s.config.LoginAttemptWindow {
+		return 0
+	}
+
+	next := attempts.LastFailureAt.Add(s.loginDelay(attempts.Failures))
+	if now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// loginDelay allows a second attempt right away, e.g. after a typo, then doubles up to LoginMaxDelay
+func (s *AuthService) loginDelay(failures int) time.Duration {
+	if failures < 2 {
+		return 0
+	}
+	delay := s.config.LoginDelayBase
+	for i := 2; i < failures && delay < s.config.LoginMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, s.config.LoginMaxDelay)
+}
+
+// recordLoginFailure counts a failed attempt of the email address and the IP. It returns a
+// LoginThrottledError when the failure locked either of them.
+func (s *AuthService) recordLoginFailure(ctx context.Context, email, clientIP string, user *models.User) error {
+	emailLocked, err := s.countLoginFailure(ctx, emailAttemptsKey(email), s.config.LoginMaxAttempts)
+	if err != nil {
+		return err
+	}
+	ipLocked, err := s.countLoginFailure(ctx, ipAttemptsKey(clientIP), s.config.LoginIPMaxAttempts)
+	if err != nil {
+		return err
+	}
+
+	// Sent in the background so the response takes as long for existing and unknown addresses
+	if emailLocked && user != nil {
+		go s.sendLockoutEmail(*user)
+	}
+
+	if emailLocked || ipLocked {
+		return &LoginThrottledError{RetryAfter: s.config.LoginLockoutDuration}
+	}
+	return nil
+}
+
+// countLoginFailure increments the failures of a key and locks it at the limit, reporting whether
+// this failure locked it. Counting restarts after the window without failures and after a lockout.
+func (s *AuthService) countLoginFailure(ctx context.Context, key string, limit int) (bool, error) {
+	now := time.Now()
+	restart := bson.M{"$or": bson.A{
+		bson.M{"$lt": bson.A{"$lastFailureAt", now.Add(-s.config.LoginAttemptWindow)}},
+		bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{"$lockedUntil", now}}, now}},
+	}}
+
+	var attempts models.LoginAttempts
+	err := s.loginAttemptCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"failures":      bson.M{"$cond": bson.A{restart, 1, bson.M{"$add": bson.A{"$failures", 1}}}},
+			"lockedUntil":   bson.M{"$cond": bson.A{restart, "$$REMOVE", "$lockedUntil"}},
+			"lastFailureAt": now,
+			"expiresAt":     now.Add(s.config.LoginAttemptWindow + s.config.LoginLockoutDuration),
+		}}}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempts)
+	if err != nil {
+		return false, err
+	}
+
+	if attempts.Failures < limit || attempts.LockedUntil != nil {
+		return false, nil
+	}
+
+	// Only the request that reaches the limit locks, and notifies
+	result, err := s.loginAttemptCollection.UpdateOne(ctx,
+		bson.M{"_id": key, "lockedUntil": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"lockedUntil": now.Add(s.config.LoginLockoutDuration)}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// checkPassword verifies the current password of a signed in user before a sensitive change. Wrong
+// passwords count as failed logins, so a stolen session cannot be used to guess it.
+func (s *AuthService) checkPassword(ctx context.Context, user *models.User, password, clientIP string) error {
+	if err := s.checkLoginAttempts(ctx, emailAttemptsKey(user.Email), ipAttemptsKey(clientIP)); err != nil {
+		return err
+	}
+
+	rehash, err := s.comparePassword(user.Password, password)
+	if err != nil {
+		if err := s.recordLoginFailure(ctx, user.Email, clientIP, user); err != nil {
+			return err
+		}
+		return ErrIncorrectPassword
+	}
+	if rehash {
+		s.upgradePasswordHash(ctx, user, password)
+	}
+	return nil
+}
+
+// clearLoginFailures unlocks an email address, after a successful login or a password reset. The
+// failures of the IP are kept on purpose: otherwise signing in to one account of their own between
+// guesses would let a client try passwords against other addresses without ever reaching the IP limit.
+// They expire after LoginAttemptWindow without failures.
+func (s *AuthService) clearLoginFailures(ctx context.Context, email string) {
+	if _, err := s.loginAttemptCollection.DeleteOne(ctx, bson.M{"_id": emailAttemptsKey(email)}); err != nil {
+		log.Printf("Failed to clear login failures: %v", err)
+	}
+}
+
+func (s *AuthService) sendLockoutEmail(user models.User) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	err := s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your account was locked",
+		Body: fmt.Sprintf("Hi %s,\n\nSigning in to your account was locked after %d failed attempts. "+
+			"You can try again in %s, or unlock it now by resetting your password:\n\n%s\n\n"+
+			"If these attempts were not yours, resetting your password is recommended.\n",
+			user.Name, s.config.LoginMaxAttempts, s.config.LoginLockoutDuration, s.config.AppURL+"/forgot-password"),
+	})
+	logMailError("lockout", &user, err)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"contact-enrichment-api/config"
+	"contact-enrichment-api/models"
+)
+
+func newThrottleTestService() *AuthService {
+	return &AuthService{config: &config.Config{
+		LoginAttemptWindow:   15 * time.Minute,
+		LoginLockoutDuration: 15 * time.Minute,
+		LoginDelayBase:       time.Second,
+		LoginMaxDelay:        30 * time.Second,
+	}}
+}
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{2, time.Second},
+		{3, 2 * time.Second},
+		{4, 4 * time.Second},
+		{6, 16 * time.Second},
+		{7, 30 * time.Second},
+		{50, 30 * time.Second},
+	}
+
+	s := newThrottleTestService()
+	for _, tt := range tests {
+		if got := s.loginDelay(tt.failures); got != tt.want {
+			t.Errorf("loginDelay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginWait(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration) *time.Time {
+		value := now.Add(offset)
+		return &value
+	}
+
+	tests := []struct {
+		name     string
+		attempts models.LoginAttempts
+		want     time.Duration
+	}{
+		{
+			name:     "first failure allows a retry",
+			attempts: models.LoginAttempts{Failures: 1, LastFailureAt: now},
+			want:     0,
+		},
+		{
+			name:     "waits the rest of the delay",
+			attempts: models.LoginAttempts{Failures: 3, LastFailureAt: now.Add(-500 * time.Millisecond)},
+			want:     1500 * time.Millisecond,
+		},
+		{
+			name:     "delay has passed",
+			attempts: models.LoginAttempts{Failures: 3, LastFailureAt: now.Add(-3 * time.Second)},
+			want:     0,
+		},
+		{
+			name:     "failures outside the window are forgotten",
+			attempts: models.LoginAttempts{Failures: 40, LastFailureAt: now.Add(-16 * time.Minute)},
+			want:     0,
+		},
+		{
+			name:     "locked",
+			attempts: models.LoginAttempts{Failures: 5, LastFailureAt: now.Add(-time.Minute), LockedUntil: at(14 * time.Minute)},
+			want:     14 * time.Minute,
+		},
+		{
+			name:     "lockout has ended",
+			attempts: models.LoginAttempts{Failures: 5, LastFailureAt: now.Add(-16 * time.Minute), LockedUntil: at(-time.Minute)},
+			want:     0,
+		},
+		{
+			name:     "an ended lockout does not delay",
+			attempts: models.LoginAttempts{Failures: 5, LastFailureAt: now.Add(-time.Second), LockedUntil: at(-time.Millisecond)},
+			want:     0,
+		},
+	}
+
+	s := newThrottleTestService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.loginWait(&tt.attempts, now); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginThrottledError(t *testing.T) {
+	var err error = &LoginThrottledError{RetryAfter: time.Minute}
+	if !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Error("LoginThrottledError does not match ErrTooManyLoginAttempts")
+	}
+
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) || throttled.RetryAfter != time.Minute {
+		t.Errorf("RetryAfter lost: %v", throttled)
+	}
+}
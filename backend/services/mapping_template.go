@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"contact-enrichment-api/config"
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MappingTemplateService struct {
+	templateCollection *mongo.Collection
+	config             *config.Config
+}
+
+func NewMappingTemplateService(db *mongo.Database, cfg *config.Config) *MappingTemplateService {
+	return &MappingTemplateService{
+		templateCollection: db.Collection("mapping_templates"),
+		config:             cfg,
+	}
+}
+
+func (s *MappingTemplateService) CreateTemplate(userID string, req models.CreateMappingTemplateRequest) (*models.MappingTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	headers := req.Headers
+	if len(headers) == 0 {
+		headers = mappedSourceFields(req.FieldMapping)
+	}
+
+	now := time.Now()
+	template := models.MappingTemplate{
+		ID:           primitive.NewObjectID(),
+		UserID:       userObjectID,
+		Name:         req.Name,
+		FieldMapping: req.FieldMapping,
+		Headers:      headers,
+		Fingerprint:  models.HeaderFingerprint(headers),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	_, err = s.templateCollection.InsertOne(ctx, template)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errors.New("mapping template with this name already exists")
+		}
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+func (s *MappingTemplateService) GetTemplates(userID string) ([]models.MappingTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := s.templateCollection.Find(ctx, bson.M{"userId": userObjectID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	templates := []models.MappingTemplate{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+func (s *MappingTemplateService) GetTemplateByID(userID, templateID string) (*models.MappingTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	filter, err := templateFilter(userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	var template models.MappingTemplate
+	err = s.templateCollection.FindOne(ctx, filter).Decode(&template)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("mapping template not found")
+		}
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+func (s *MappingTemplateService) UpdateTemplate(userID, templateID string, req models.UpdateMappingTemplateRequest) (*models.MappingTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	filter, err := templateFilter(userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	if req.Name != "" {
+		set["name"] = req.Name
+	}
+	if len(req.FieldMapping) > 0 {
+		set["fieldMapping"] = req.FieldMapping
+		if len(req.Headers) == 0 {
+			req.Headers = mappedSourceFields(req.FieldMapping)
+		}
+	}
+	if len(req.Headers) > 0 {
+		set["headers"] = req.Headers
+		set["fingerprint"] = models.HeaderFingerprint(req.Headers)
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var template models.MappingTemplate
+	err = s.templateCollection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&template)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("mapping template not found")
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errors.New("mapping template with this name already exists")
+		}
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+func (s *MappingTemplateService) DeleteTemplate(userID, templateID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	filter, err := templateFilter(userID, templateID)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.templateCollection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New("mapping template not found")
+	}
+
+	return nil
+}
+
+// MatchTemplates returns the user's templates whose headers fit the given headers, best match first
+func (s *MappingTemplateService) MatchTemplates(userID string, headers []string) ([]models.MappingTemplateMatch, error) {
+	templates, err := s.GetTemplates(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := models.HeaderFingerprint(headers)
+	matches := []models.MappingTemplateMatch{}
+	for _, template := range templates {
+		match := models.MappingTemplateMatch{Template: template}
+		if template.Fingerprint == fingerprint {
+			match.Score = 100
+			match.Exact = true
+		} else {
+			match.Score = models.HeaderOverlap(template.Headers, headers)
+		}
+
+		if match.Score >= models.MinTemplateMatchScore {
+			matches = append(matches, match)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	return matches, nil
+}
+
+// markTemplateUsed records that a template was applied to an import
+func (s *MappingTemplateService) markTemplateUsed(ctx context.Context, templateID primitive.ObjectID) error {
+	_, err := s.templateCollection.UpdateOne(ctx, bson.M{"_id": templateID}, bson.M{
+		"$set": bson.M{"lastUsedAt": time.Now()},
+	})
+	return err
+}
+
+func templateFilter(userID, templateID string) (bson.M, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	templateObjectID, err := primitive.ObjectIDFromHex(templateID)
+	if err != nil {
+		return nil, errors.New("invalid mapping template ID")
+	}
+
+	return bson.M{"_id": templateObjectID, "userId": userObjectID}, nil
+}
+
+func mappedSourceFields(fieldMapping map[string]string) []string {
+	headers := make([]string, 0, len(fieldMapping))
+	for sourceField := range fieldMapping {
+		headers = append(headers, sourceField)
+	}
+	sort.Strings(headers)
+	return headers
+}
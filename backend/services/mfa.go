@@ -0,0 +1,428 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"contact-enrichment-api/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Errors of two-factor authentication
+var (
+	ErrMFAAlreadyEnabled         = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled             = errors.New("two-factor authentication is not enabled")
+	ErrMFAEnrollmentNotStarted   = errors.New("two-factor enrollment was not started")
+	ErrInvalidMFACode            = errors.New("invalid two-factor code")
+	ErrInvalidMFAToken           = errors.New("invalid or expired MFA token")
+	ErrMFARequiredByOrganization = errors.New("an organization of the user requires two-factor authentication")
+)
+
+// TOTP parameters of RFC 6238 as understood by common authenticator apps
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	totpSkew   = 1 // Steps accepted before and after the current one, for clock drift
+
+	recoveryCodeCount = 10
+
+	// Purpose claim of MFA challenge tokens, which are not accepted as access tokens
+	mfaChallengePurpose = "mfa"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// BeginMFAEnrollment creates a new secret for the user. It is only used after ConfirmMFAEnrollment.
+func (s *AuthService) BeginMFAEnrollment(userID string) (*models.MFAEnrollmentResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	secret := totpEncoding.EncodeToString(key)
+
+	_, err = s.userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"mfaPendingSecret": secret, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", s.config.MFAIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(s.config.MFAIssuer + ":" + user.Email)
+
+	return &models.MFAEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: "otpauth://totp/" + label + "?" + query.Encode(),
+	}, nil
+}
+
+// ConfirmMFAEnrollment enables two-factor authentication with a code of the pending secret and
+// returns the recovery codes, which are not shown again
+func (s *AuthService) ConfirmMFAEnrollment(userID, code string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFAPendingSecret == "" {
+		return nil, ErrMFAEnrollmentNotStarted
+	}
+
+	step, ok := matchTOTP(user.MFAPendingSecret, normalizeMFACode(code), 0, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "mfaPendingSecret": user.MFAPendingSecret},
+		bson.M{
+			"$set": bson.M{
+				"mfaEnabled":       true,
+				"mfaSecret":        user.MFAPendingSecret,
+				"mfaRecoveryCodes": hashes,
+				"mfaLastStep":      step,
+				"updated_at":       time.Now(),
+			},
+			"$unset": bson.M{"mfaPendingSecret": ""},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.ModifiedCount == 0 {
+		return nil, ErrMFAEnrollmentNotStarted
+	}
+
+	return codes, nil
+}
+
+// DisableMFA turns two-factor authentication off after checking the password and a code. Members of
+// an organization that requires it cannot turn it off. Every other session is signed out, and the
+// returned tokens continue the current one in its organization.
+func (s *AuthService) DisableMFA(userID, orgID string, req models.DisableMFARequest, clientIP string) (*models.TokenPair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	required, err := s.orgService.RequiresMFA(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if required {
+		return nil, ErrMFARequiredByOrganization
+	}
+
+	if err := s.checkPassword(ctx, user, req.Password, clientIP); err != nil {
+		return nil, err
+	}
+	if err := s.checkSecondFactor(ctx, user, req.Code, clientIP); err != nil {
+		return nil, err
+	}
+
+	_, err = s.userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{
+			"$set":   bson.M{"mfaEnabled": false, "updated_at": time.Now()},
+			"$unset": bson.M{"mfaSecret": "", "mfaPendingSecret": "", "mfaRecoveryCodes": "", "mfaLastStep": ""},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// A session that turned the second factor off may be stolen, the others are signed out
+	if err := s.RevokeAllSessions(userID); err != nil {
+		return nil, err
+	}
+
+	// Reload for the token version that RevokeAllSessions incremented
+	user, err = s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	membership, err := s.activeMembership(ctx, user, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, membership.OrgID, primitive.NewObjectID(), primitive.NewObjectID())
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user after checking a code
+func (s *AuthService) RegenerateRecoveryCodes(userID, code, clientIP string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	if err := s.checkSecondFactor(ctx, user, code, clientIP); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"mfaRecoveryCodes": hashes, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// CompleteMFALogin exchanges the challenge token of a login and a code for tokens. Wrong codes
+// count as failed logins. A challenge completes one login only, it cannot be used again with the
+// code of a later time step.
+func (s *AuthService) CompleteMFALogin(mfaToken, code, clientIP string) (*models.LoginResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims, err := s.parseToken(mfaToken)
+	if err != nil || claims.Purpose != mfaChallengePurpose || claims.ID == "" {
+		return nil, ErrInvalidMFAToken
+	}
+
+	// Checked up front so a used challenge does not spend codes, claimMFAChallenge decides
+	used, err := s.revokedTokenCollection.CountDocuments(ctx, bson.M{"_id": claims.ID})
+	if err != nil {
+		return nil, err
+	}
+	if used > 0 {
+		return nil, ErrInvalidMFAToken
+	}
+
+	if err := s.checkLoginAttempts(ctx, emailAttemptsKey(claims.Email), ipAttemptsKey(clientIP)); err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	if !user.IsActive {
+		return nil, ErrAccountDeactivated
+	}
+	if !user.MFAEnabled || claims.TokenVersion != user.TokenVersion {
+		return nil, ErrInvalidMFAToken
+	}
+
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			if err := s.recordLoginFailure(ctx, user.Email, clientIP, user); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	if err := s.claimMFAChallenge(ctx, user.ID, claims); err != nil {
+		return nil, err
+	}
+
+	s.clearLoginFailures(ctx, user.Email)
+
+	return s.completeLogin(ctx, user)
+}
+
+// claimMFAChallenge marks a challenge as used by denying its ID until it expires. The insert is
+// atomic, so of concurrent logins with the same challenge only one succeeds.
+func (s *AuthService) claimMFAChallenge(ctx context.Context, userID primitive.ObjectID, claims *Claims) error {
+	used := models.RevokedToken{ID: claims.ID, UserID: userID, ExpiresAt: claims.ExpiresAt.Time}
+	if _, err := s.revokedTokenCollection.InsertOne(ctx, used); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrInvalidMFAToken
+		}
+		return err
+	}
+	return nil
+}
+
+// issueMFAChallenge creates the token that proves the password was checked, for the second login step
+func (s *AuthService) issueMFAChallenge(user *models.User) (string, error) {
+	claims := Claims{
+		UserID:       user.ID.Hex(),
+		Email:        user.Email,
+		TokenVersion: user.TokenVersion,
+		Purpose:      mfaChallengePurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.MFAChallengeExpiration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return s.signToken(claims)
+}
+
+// checkSecondFactor verifies a code of a signed in user before a sensitive change. Wrong codes count
+// as failed logins like in CompleteMFALogin, so a stolen session cannot be used to guess them.
+func (s *AuthService) checkSecondFactor(ctx context.Context, user *models.User, code, clientIP string) error {
+	if err := s.checkLoginAttempts(ctx, emailAttemptsKey(user.Email), ipAttemptsKey(clientIP)); err != nil {
+		return err
+	}
+
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			if err := s.recordLoginFailure(ctx, user.Email, clientIP, user); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// verifySecondFactor accepts a TOTP code or a recovery code. Each TOTP code works once and
+// recovery codes are removed when used.
+func (s *AuthService) verifySecondFactor(ctx context.Context, user *models.User, code string) error {
+	code = normalizeMFACode(code)
+
+	if len(code) == totpDigits {
+		step, ok := matchTOTP(user.MFASecret, code, user.MFALastStep, time.Now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		// Claim the time step so the same code cannot be replayed, also concurrently
+		result, err := s.userCollection.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "$or": bson.A{
+				bson.M{"mfaLastStep": bson.M{"$exists": false}},
+				bson.M{"mfaLastStep": bson.M{"$lt": step}},
+			}},
+			bson.M{"$set": bson.M{"mfaLastStep": step}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	hash := hashToken(code)
+	result, err := s.userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "mfaRecoveryCodes": hash},
+		bson.M{"$pull": bson.M{"mfaRecoveryCodes": hash}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// matchTOTP checks a code against the steps around now, ignoring steps up to lastStep which were
+// already used. It returns the matching step.
+func matchTOTP(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the HOTP value of RFC 4226 for a time step
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// generateRecoveryCodes returns new codes formatted for the user and their hashes for storage
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeMFACode accepts codes with spaces, dashes and either case, as users tend to type them
+func normalizeMFACode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
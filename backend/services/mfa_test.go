@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"contact-enrichment-api/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RFC 6238 test key, the SHA-1 vectors truncated to six digits
+var totpTestKey = []byte("12345678901234567890")
+
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(totpTestKey, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString(totpTestKey)
+	now := time.Unix(1111111109, 0)
+	current := now.Unix() / totpPeriod
+	code := func(step int64) string {
+		return totpCode(totpTestKey, step)
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", secret: secret, code: code(current), wantStep: current, wantOK: true},
+		{name: "previous step", secret: secret, code: code(current - 1), wantStep: current - 1, wantOK: true},
+		{name: "next step", secret: secret, code: code(current + 1), wantStep: current + 1, wantOK: true},
+		{name: "two steps behind", secret: secret, code: code(current - 2)},
+		{name: "two steps ahead", secret: secret, code: code(current + 2)},
+		{name: "used step", secret: secret, code: code(current), lastStep: current},
+		{name: "step before the used one", secret: secret, code: code(current - 1), lastStep: current},
+		{name: "step after the used one", secret: secret, code: code(current + 1), lastStep: current, wantStep: current + 1, wantOK: true},
+		{name: "wrong code", secret: secret, code: "000000"},
+		{name: "short code", secret: secret, code: code(current)[:5]},
+		{name: "invalid secret", secret: "not base32!", code: code(current)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTP(tt.secret, tt.code, tt.lastStep, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("got step %d, %v, want step %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNormalizeMFACode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"123456", "123456"},
+		{" 123 456 ", "123456"},
+		{"ABCDE-FGHIJ", "abcdefghij"},
+		{"abcde fghij", "abcdefghij"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeMFACode(tt.code); got != tt.want {
+			t.Errorf("normalizeMFACode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' || code != strings.ToLower(code) {
+			t.Errorf("code %q is not formatted as xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q generated twice", code)
+		}
+		seen[code] = true
+
+		// Codes are stored as typed once normalized
+		if hashes[i] != hashToken(normalizeMFACode(strings.ToUpper(code))) {
+			t.Errorf("hash of code %q does not match the normalized code", code)
+		}
+	}
+}
+
+func TestCompleteMFALoginUsesTheChallengeOnce(t *testing.T) {
+	s := newTestAuthService(t, newTestDatabase(t), testConfig(&config.Config{}))
+	user := insertTestUser(t, s, "mfa@example.com", true)
+	user.MFAEnabled = true
+	user.MFASecret = totpEncoding.EncodeToString(totpTestKey)
+	_, err := s.userCollection.UpdateByID(context.Background(), user.ID, bson.M{"$set": bson.M{"mfaEnabled": true, "mfaSecret": user.MFASecret}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge, err := s.issueMFAChallenge(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := time.Now().Unix() / totpPeriod
+	if _, err := s.CompleteMFALogin(challenge, totpCode(totpTestKey, step), "203.0.113.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The code of the next step is valid, the used challenge is not
+	if _, err := s.CompleteMFALogin(challenge, totpCode(totpTestKey, step+1), "203.0.113.1"); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Fatalf("reused challenge: err = %v, want ErrInvalidMFAToken", err)
+	}
+
+	next, err := s.issueMFAChallenge(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CompleteMFALogin(next, totpCode(totpTestKey, step+1), "203.0.113.1"); err != nil {
+		t.Fatalf("a new challenge failed: %v", err)
+	}
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"time"
+
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors of single sign-on
+var (
+	ErrOIDCNotConfigured     = errors.New("single sign-on is not configured")
+	ErrInvalidOIDCState      = errors.New("invalid or expired single sign-on state")
+	ErrOIDCLoginFailed       = errors.New("single sign-on failed")
+	ErrOIDCEmailUnverified   = errors.New("an account with this email exists, sign in with the password and link single sign-on from the profile")
+	ErrOIDCSignupDisabled    = errors.New("no account exists for this single sign-on user")
+	ErrOIDCAlreadyLinked     = errors.New("this single sign-on account is linked to another user")
+	ErrOIDCUserAlreadyLinked = errors.New("the user is already linked to another single sign-on account")
+)
+
+// OIDCAuthorizationURL starts a single sign-on login and returns the identity provider URL the
+// browser is sent to
+func (s *AuthService) OIDCAuthorizationURL() (string, error) {
+	return s.startOIDC(nil)
+}
+
+// OIDCLinkURL starts linking the identity provider account to a signed in user
+func (s *AuthService) OIDCLinkURL(userID string) (string, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return "", errors.New("invalid user ID")
+	}
+	return s.startOIDC(&userObjectID)
+}
+
+// CompleteOIDCLogin finishes a single sign-on login with the code the identity provider redirected
+// back with. The user is found by their provider subject, then by a verified email, which links
+// an existing password account, and is created otherwise when provisioning is enabled.
+func (s *AuthService) CompleteOIDCLogin(code, state string) (*models.LoginResponse, error) {
+	if s.oidc == nil {
+		return nil, ErrOIDCNotConfigured
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	// States of links are only completed by the signed in user who started them
+	claims, err := s.completeOIDC(ctx, code, bson.M{"_id": hashToken(state), "linkUserId": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.findOrProvisionOIDCUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsActive {
+		return nil, ErrAccountDeactivated
+	}
+	if s.config.RequireEmailVerification && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	// Single sign-on replaces the password, not the second factor
+	if user.MFAEnabled {
+		mfaToken, err := s.issueMFAChallenge(user)
+		if err != nil {
+			return nil, err
+		}
+		return &models.LoginResponse{
+			User:         *user,
+			MFARequired:  true,
+			MFAToken:     mfaToken,
+			MFAExpiresIn: int64(s.config.MFAChallengeExpiration.Seconds()),
+		}, nil
+	}
+
+	return s.completeLogin(ctx, user)
+}
+
+// CompleteOIDCLink finishes linking a provider account for the signed in user who started it. No
+// tokens are issued, the user keeps their session.
+func (s *AuthService) CompleteOIDCLink(userID, code, state string) (*models.User, error) {
+	if s.oidc == nil {
+		return nil, ErrOIDCNotConfigured
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	// A state started by another user is unknown here, so a link cannot be completed by someone else
+	claims, err := s.completeOIDC(ctx, code, bson.M{"_id": hashToken(state), "linkUserId": userObjectID})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.linkOIDCUser(ctx, userObjectID, claims, false)
+}
+
+// completeOIDC uses up the pending state matching the filter and redeems the code for the claims
+// of its ID token
+func (s *AuthService) completeOIDC(ctx context.Context, code string, filter bson.M) (*oidcIDTokenClaims, error) {
+	// The state is single use, whatever the outcome
+	var pending models.OIDCState
+	err := s.oidcStateCollection.FindOneAndDelete(ctx, filter).Decode(&pending)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(pending.ExpiresAt) {
+		return nil, ErrInvalidOIDCState
+	}
+
+	claims, err := s.oidc.exchangeCode(ctx, code, pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		return nil, ErrOIDCLoginFailed
+	}
+	return claims, nil
+}
+
+// startOIDC stores the state, nonce and PKCE verifier of a new login and builds its authorization URL
+func (s *AuthService) startOIDC(linkUserID *primitive.ObjectID) (string, error) {
+	if s.oidc == nil {
+		return "", ErrOIDCNotConfigured
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	state, err := randomURLSafe(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomURLSafe(32)
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := randomURLSafe(32)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(codeVerifier))
+
+	authorizationURL, err := s.oidc.authorizationURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	pending := models.OIDCState{
+		ID:           hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    now.Add(s.config.OIDCStateExpiration),
+		CreatedAt:    now,
+	}
+	if _, err := s.oidcStateCollection.InsertOne(ctx, pending); err != nil {
+		return "", err
+	}
+
+	return authorizationURL, nil
+}
+
+func (s *AuthService) findOrProvisionOIDCUser(ctx context.Context, claims *oidcIDTokenClaims) (*models.User, error) {
+	var user models.User
+	err := s.userCollection.FindOne(ctx, bson.M{"oidcIssuer": claims.Issuer, "oidcSubject": claims.Subject}).Decode(&user)
+	if err == nil {
+		return &user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		log.Printf("OIDC login failed: ID token of subject %s has no email", claims.Subject)
+		return nil, ErrOIDCLoginFailed
+	}
+
+	err = s.userCollection.FindOne(ctx, bson.M{"email": claims.Email}).Decode(&user)
+	if err == nil {
+		// An unverified email could belong to someone else at the provider
+		if !bool(claims.EmailVerified) {
+			return nil, ErrOIDCEmailUnverified
+		}
+		return s.linkOIDCUser(ctx, user.ID, claims, true)
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	if !s.config.OIDCAutoProvision {
+		return nil, ErrOIDCSignupDisabled
+	}
+	return s.provisionOIDCUser(ctx, claims)
+}
+
+// linkOIDCUser records the provider subject on a user, so later logins find the user by it.
+// verifiesEmail marks the user's email as verified, when it was matched to the one the provider verified.
+func (s *AuthService) linkOIDCUser(ctx context.Context, userID primitive.ObjectID, claims *oidcIDTokenClaims, verifiesEmail bool) (*models.User, error) {
+	count, err := s.userCollection.CountDocuments(ctx, bson.M{
+		"_id":         bson.M{"$ne": userID},
+		"oidcIssuer":  claims.Issuer,
+		"oidcSubject": claims.Subject,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrOIDCAlreadyLinked
+	}
+
+	now := time.Now()
+	update := bson.M{"oidcIssuer": claims.Issuer, "oidcSubject": claims.Subject, "updated_at": now}
+	if verifiesEmail {
+		update["emailVerified"] = true
+		update["emailVerifiedAt"] = now
+	}
+	var user models.User
+	err = s.userCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID, "$or": bson.A{
+			bson.M{"oidcSubject": bson.M{"$exists": false}},
+			bson.M{"oidcIssuer": claims.Issuer, "oidcSubject": claims.Subject},
+		}},
+		bson.M{"$set": update},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOIDCUserAlreadyLinked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// provisionOIDCUser creates a user on their first single sign-on login. The user has a random
+// password and can set one with the password reset flow.
+func (s *AuthService) provisionOIDCUser(ctx context.Context, claims *oidcIDTokenClaims) (*models.User, error) {
+	password, err := randomURLSafe(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := s.hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+
+	now := time.Now()
+	user := models.User{
+		ID:            primitive.NewObjectID(),
+		Name:          name,
+		Email:         claims.Email,
+		Password:      hashedPassword,
+		IsActive:      true,
+		EmailVerified: bool(claims.EmailVerified),
+		OIDCIssuer:    claims.Issuer,
+		OIDCSubject:   claims.Subject,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if user.EmailVerified {
+		user.EmailVerifiedAt = &now
+	}
+
+	if _, err := s.userCollection.InsertOne(ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrOIDCAlreadyLinked
+		}
+		return nil, err
+	}
+
+	// Every user starts with a personal organization
+	if _, err := s.orgService.ResolveMembership(ctx, &user, primitive.NilObjectID); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func randomURLSafe(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
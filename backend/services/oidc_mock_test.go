@@ -0,0 +1,229 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"contact-enrichment-api/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP is a local OpenID Connect provider: discovery, a JWKS, and a token endpoint that checks
+// the client credentials and the PKCE verifier before issuing RS256 ID tokens
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+
+	clientID     string
+	clientSecret string
+	redirectURL  string
+
+	mu             sync.Mutex
+	key            *rsa.PrivateKey
+	kid            string
+	authorizations map[string]mockAuthorization // By code
+	jwksRequests   int
+
+	// Changes the claims of the next ID tokens, or replaces their signing, for negative cases
+	mutateClaims func(jwt.MapClaims)
+	signIDToken  func(jwt.MapClaims) (string, error)
+}
+
+// mockAuthorization is a sign-in at the provider, waiting for its code to be redeemed
+type mockAuthorization struct {
+	codeChallenge string
+	nonce         string
+	claims        jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	idp := &mockIdP{
+		t:              t,
+		clientID:       "crm",
+		clientSecret:   "crm-secret",
+		redirectURL:    "http://localhost:3000/auth/oidc/callback",
+		authorizations: make(map[string]mockAuthorization),
+	}
+	idp.rotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.handleDiscovery)
+	mux.HandleFunc("/jwks", idp.handleJWKS)
+	mux.HandleFunc("/token", idp.handleToken)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+// config returns the single sign-on settings of a client of the provider
+func (idp *mockIdP) config() *config.Config {
+	return &config.Config{
+		DefaultTimeout:      5 * time.Second,
+		OIDCIssuerURL:       idp.server.URL,
+		OIDCClientID:        idp.clientID,
+		OIDCClientSecret:    idp.clientSecret,
+		OIDCRedirectURL:     idp.redirectURL,
+		OIDCScopes:          "openid email profile",
+		OIDCAutoProvision:   true,
+		OIDCStateExpiration: 10 * time.Minute,
+	}
+}
+
+// rotateKey replaces the signing key, as providers do from time to time
+func (idp *mockIdP) rotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.key = key
+	idp.kid = fmt.Sprintf("key-%d", time.Now().UnixNano())
+}
+
+// signIn follows the authorization URL like a browser whose user signs in with the claims, and
+// returns the code and state of the redirect back to the client
+func (idp *mockIdP) signIn(authorizationURL string, claims jwt.MapClaims) (code, state string) {
+	idp.t.Helper()
+
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != idp.clientID || query.Get("response_type") != "code" ||
+		query.Get("redirect_uri") != idp.redirectURL || query.Get("code_challenge_method") != "S256" {
+		idp.t.Fatalf("unexpected authorization request %s", authorizationURL)
+	}
+
+	code = randomTestString(idp.t)
+	idp.mu.Lock()
+	idp.authorizations[code] = mockAuthorization{
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+		claims:        claims,
+	}
+	idp.mu.Unlock()
+
+	return code, query.Get("state")
+}
+
+func (idp *mockIdP) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeTestJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 idp.server.URL,
+		"authorization_endpoint": idp.server.URL + "/authorize",
+		"token_endpoint":         idp.server.URL + "/token",
+		"jwks_uri":               idp.server.URL + "/jwks",
+	})
+}
+
+func (idp *mockIdP) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.jwksRequests++
+
+	writeTestJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": idp.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (idp *mockIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	clientID, clientSecret, _ := r.BasicAuth()
+	if clientID != idp.clientID || clientSecret != idp.clientSecret {
+		writeTestJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("redirect_uri") != idp.redirectURL {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	// Codes are single use
+	idp.mu.Lock()
+	authorization, ok := idp.authorizations[r.PostForm.Get("code")]
+	delete(idp.authorizations, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.codeChallenge {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   idp.clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": authorization.nonce,
+	}
+	for name, value := range authorization.claims {
+		claims[name] = value
+	}
+	if idp.mutateClaims != nil {
+		idp.mutateClaims(claims)
+	}
+
+	idToken, err := idp.sign(claims)
+	if err != nil {
+		writeTestJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeTestJSON(w, http.StatusOK, map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func (idp *mockIdP) sign(claims jwt.MapClaims) (string, error) {
+	if idp.signIDToken != nil {
+		return idp.signIDToken(claims)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	return token.SignedString(idp.key)
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomTestString(t *testing.T) string {
+	t.Helper()
+	value, err := randomURLSafe(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
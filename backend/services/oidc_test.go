@@ -0,0 +1,378 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"contact-enrichment-api/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// startTestLogin builds an authorization URL like startOIDC, without storing its state
+func startTestLogin(t *testing.T, p *oidcProvider) (authorizationURL, codeVerifier, nonce string) {
+	t.Helper()
+
+	codeVerifier, nonce = randomTestString(t), randomTestString(t)
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	authorizationURL, err := p.authorizationURL(context.Background(), randomTestString(t), nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authorizationURL, codeVerifier, nonce
+}
+
+func TestOIDCAuthorizationURL(t *testing.T) {
+	idp := newMockIdP(t)
+	p := newOIDCProvider(idp.config())
+
+	codeVerifier := "verifier"
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	authorizationURL, err := p.authorizationURL(context.Background(), "the-state", "the-nonce", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Scheme + "://" + parsed.Host + parsed.Path; got != idp.server.URL+"/authorize" {
+		t.Errorf("authorization endpoint = %s, want the discovered one", got)
+	}
+
+	query := parsed.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             idp.clientID,
+		"redirect_uri":          idp.redirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(challenge[:]),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if query.Get(name) != value {
+			t.Errorf("%s = %q, want %q", name, query.Get(name), value)
+		}
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+	cfg := idp.config()
+	cfg.OIDCIssuerURL = idp.server.URL + "/other"
+
+	// The other issuer serves no discovery document, and a document of another issuer is refused
+	if _, err := newOIDCProvider(cfg).getDiscovery(context.Background()); err == nil {
+		t.Fatal("discovery of another issuer was accepted")
+	}
+}
+
+func TestOIDCExchangeCode(t *testing.T) {
+	signIn := jwt.MapClaims{"sub": "user-1", "email": "jane@example.com", "email_verified": true, "name": "Jane Doe"}
+
+	tests := []struct {
+		name         string
+		mutateClaims func(jwt.MapClaims)
+		signIDToken  func(jwt.MapClaims) (string, error)
+		wrongVerify  bool
+		wrongNonce   bool
+		wantErr      bool
+	}{
+		{name: "valid"},
+		{name: "email_verified as string", mutateClaims: func(c jwt.MapClaims) { c["email_verified"] = "true" }},
+		{name: "wrong PKCE verifier", wrongVerify: true, wantErr: true},
+		{name: "wrong nonce", wrongNonce: true, wantErr: true},
+		{name: "other audience", mutateClaims: func(c jwt.MapClaims) { c["aud"] = "other-client" }, wantErr: true},
+		{name: "other issuer", mutateClaims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, wantErr: true},
+		{name: "expired", mutateClaims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: true},
+		{name: "no expiry", mutateClaims: func(c jwt.MapClaims) { delete(c, "exp") }, wantErr: true},
+		{name: "no subject", mutateClaims: func(c jwt.MapClaims) { delete(c, "sub") }, wantErr: true},
+		{
+			name:         "several audiences without this client as authorized party",
+			mutateClaims: func(c jwt.MapClaims) { c["aud"] = []string{"crm", "other-client"}; c["azp"] = "other-client" },
+			wantErr:      true,
+		},
+		{
+			name:         "several audiences with this client as authorized party",
+			mutateClaims: func(c jwt.MapClaims) { c["aud"] = []string{"crm", "other-client"}; c["azp"] = "crm" },
+		},
+		{
+			name: "HMAC signed with the client secret",
+			signIDToken: func(c jwt.MapClaims) (string, error) {
+				return jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString([]byte("crm-secret"))
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsigned",
+			signIDToken: func(c jwt.MapClaims) (string, error) {
+				return jwt.NewWithClaims(jwt.SigningMethodNone, c).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.mutateClaims = tt.mutateClaims
+			idp.signIDToken = tt.signIDToken
+			p := newOIDCProvider(idp.config())
+
+			authorizationURL, codeVerifier, nonce := startTestLogin(t, p)
+			code, _ := idp.signIn(authorizationURL, signIn)
+			if tt.wrongVerify {
+				codeVerifier = randomTestString(t)
+			}
+			if tt.wrongNonce {
+				nonce = randomTestString(t)
+			}
+
+			claims, err := p.exchangeCode(context.Background(), code, codeVerifier, nonce)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("exchangeCode succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "user-1" || claims.Email != "jane@example.com" || !bool(claims.EmailVerified) || claims.Name != "Jane Doe" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestOIDCCodeIsSingleUse(t *testing.T) {
+	idp := newMockIdP(t)
+	p := newOIDCProvider(idp.config())
+
+	authorizationURL, codeVerifier, nonce := startTestLogin(t, p)
+	code, _ := idp.signIn(authorizationURL, jwt.MapClaims{"sub": "user-1"})
+	if _, err := p.exchangeCode(context.Background(), code, codeVerifier, nonce); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.exchangeCode(context.Background(), code, codeVerifier, nonce); err == nil {
+		t.Fatal("a code was redeemed twice")
+	}
+}
+
+func TestOIDCSigningKeyRotation(t *testing.T) {
+	idp := newMockIdP(t)
+	p := newOIDCProvider(idp.config())
+
+	login := func() error {
+		authorizationURL, codeVerifier, nonce := startTestLogin(t, p)
+		code, _ := idp.signIn(authorizationURL, jwt.MapClaims{"sub": "user-1"})
+		_, err := p.exchangeCode(context.Background(), code, codeVerifier, nonce)
+		return err
+	}
+
+	if err := login(); err != nil {
+		t.Fatal(err)
+	}
+	if err := login(); err != nil {
+		t.Fatal(err)
+	}
+	if idp.jwksRequests != 1 {
+		t.Fatalf("keys were fetched %d times, want them cached", idp.jwksRequests)
+	}
+
+	// Unknown keys are refetched at most once per jwksRefreshInterval
+	idp.rotateKey()
+	if err := login(); err == nil {
+		t.Fatal("a token of an unknown key was accepted right after fetching the keys")
+	}
+	p.keysFetchedAt = p.keysFetchedAt.Add(-2 * jwksRefreshInterval)
+	if err := login(); err != nil {
+		t.Fatalf("the rotated key was not refetched: %v", err)
+	}
+	if idp.jwksRequests != 2 {
+		t.Fatalf("keys were fetched %d times, want 2", idp.jwksRequests)
+	}
+}
+
+// newTestOIDCService creates an auth service with a database, signing in at the mock provider
+func newTestOIDCService(t *testing.T) (*AuthService, *mockIdP) {
+	t.Helper()
+
+	idp := newMockIdP(t)
+	db := newTestDatabase(t)
+	return newTestAuthService(t, db, testConfig(idp.config())), idp
+}
+
+// insertTestUser stores a password user
+func insertTestUser(t *testing.T, s *AuthService, email string, emailVerified bool) *models.User {
+	t.Helper()
+
+	user := &models.User{
+		ID:            primitive.NewObjectID(),
+		Name:          "Test User",
+		Email:         email,
+		Password:      s.dummyPasswordHash,
+		IsActive:      true,
+		EmailVerified: emailVerified,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if _, err := s.userCollection.InsertOne(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	s, idp := newTestOIDCService(t)
+
+	authorizationURL, err := s.OIDCAuthorizationURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := idp.signIn(authorizationURL, jwt.MapClaims{"sub": "new-user", "email": "new@example.com", "email_verified": true, "name": "New User"})
+
+	response, err := s.CompleteOIDCLogin(code, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Token == "" || response.RefreshToken == "" {
+		t.Fatal("no tokens were issued")
+	}
+	if response.User.Email != "new@example.com" || !response.User.EmailVerified || response.User.OIDCSubject != "new-user" {
+		t.Errorf("user = %+v", response.User)
+	}
+
+	// The state is used up
+	if _, err := s.CompleteOIDCLogin(code, state); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("reused state: err = %v, want ErrInvalidOIDCState", err)
+	}
+
+	// The next login finds the user by subject, whatever the email
+	authorizationURL, _ = s.OIDCAuthorizationURL()
+	code, state = idp.signIn(authorizationURL, jwt.MapClaims{"sub": "new-user", "email": "renamed@example.com"})
+	again, err := s.CompleteOIDCLogin(code, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.User.ID != response.User.ID {
+		t.Fatal("a second user was created for the same subject")
+	}
+}
+
+func TestOIDCLoginWithoutProvisioning(t *testing.T) {
+	s, idp := newTestOIDCService(t)
+	s.config.OIDCAutoProvision = false
+
+	authorizationURL, _ := s.OIDCAuthorizationURL()
+	code, state := idp.signIn(authorizationURL, jwt.MapClaims{"sub": "stranger", "email": "stranger@example.com", "email_verified": true})
+	if _, err := s.CompleteOIDCLogin(code, state); !errors.Is(err, ErrOIDCSignupDisabled) {
+		t.Fatalf("err = %v, want ErrOIDCSignupDisabled", err)
+	}
+}
+
+func TestOIDCLoginLinksByEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		emailVerified bool
+		wantErr       error
+	}{
+		{name: "verified by the provider", emailVerified: true},
+		{name: "not verified by the provider", emailVerified: false, wantErr: ErrOIDCEmailUnverified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, idp := newTestOIDCService(t)
+			existing := insertTestUser(t, s, "jane@example.com", false)
+
+			authorizationURL, _ := s.OIDCAuthorizationURL()
+			code, state := idp.signIn(authorizationURL, jwt.MapClaims{"sub": "jane", "email": "jane@example.com", "email_verified": tt.emailVerified})
+			response, err := s.CompleteOIDCLogin(code, state)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.User.ID != existing.ID || response.User.OIDCSubject != "jane" || !response.User.EmailVerified {
+				t.Errorf("user = %+v, want the existing user linked and verified", response.User)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginKeepsSecondFactor(t *testing.T) {
+	s, idp := newTestOIDCService(t)
+	user := insertTestUser(t, s, "mfa@example.com", true)
+	if _, err := s.userCollection.UpdateByID(context.Background(), user.ID, map[string]interface{}{"$set": map[string]interface{}{"mfaEnabled": true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	authorizationURL, _ := s.OIDCAuthorizationURL()
+	code, state := idp.signIn(authorizationURL, jwt.MapClaims{"sub": "mfa", "email": "mfa@example.com", "email_verified": true})
+	response, err := s.CompleteOIDCLogin(code, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.MFARequired || response.MFAToken == "" || response.Token != "" {
+		t.Fatalf("response = %+v, want only an MFA challenge", response)
+	}
+}
+
+func TestOIDCLinkIsCompletedByItsUserOnly(t *testing.T) {
+	s, idp := newTestOIDCService(t)
+	attacker := insertTestUser(t, s, "attacker@example.com", true)
+	victim := insertTestUser(t, s, "victim@example.com", true)
+	victimSignIn := jwt.MapClaims{"sub": "victim", "email": "victim@example.com", "email_verified": true}
+
+	// A link started by the attacker and finished at the provider by the victim
+	authorizationURL, err := s.OIDCLinkURL(attacker.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := idp.signIn(authorizationURL, victimSignIn)
+
+	if _, err := s.CompleteOIDCLogin(code, state); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("login callback with a link state: err = %v, want ErrInvalidOIDCState", err)
+	}
+	if _, err := s.CompleteOIDCLink(victim.ID.Hex(), code, state); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("link callback of another user: err = %v, want ErrInvalidOIDCState", err)
+	}
+
+	// The user who started a link completes it, and a login state is not a link state
+	authorizationURL, _ = s.OIDCLinkURL(victim.ID.Hex())
+	code, state = idp.signIn(authorizationURL, victimSignIn)
+	linked, err := s.CompleteOIDCLink(victim.ID.Hex(), code, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked.ID != victim.ID || linked.OIDCSubject != "victim" {
+		t.Errorf("linked user = %+v", linked)
+	}
+
+	authorizationURL, _ = s.OIDCAuthorizationURL()
+	code, state = idp.signIn(authorizationURL, victimSignIn)
+	if _, err := s.CompleteOIDCLink(victim.ID.Hex(), code, state); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("link callback with a login state: err = %v, want ErrInvalidOIDCState", err)
+	}
+
+	// The subject cannot be linked to a second user
+	authorizationURL, _ = s.OIDCLinkURL(attacker.ID.Hex())
+	code, state = idp.signIn(authorizationURL, victimSignIn)
+	if _, err := s.CompleteOIDCLink(attacker.ID.Hex(), code, state); !errors.Is(err, ErrOIDCAlreadyLinked) {
+		t.Fatalf("err = %v, want ErrOIDCAlreadyLinked", err)
+	}
+}
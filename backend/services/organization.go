@@ -0,0 +1,669 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"contact-enrichment-api/config"
+	"contact-enrichment-api/mailer"
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors of organizations and their memberships, mapped to specific status codes by the controller
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrNotOrgMember         = errors.New("not a member of this organization")
+	ErrMemberNotFound       = errors.New("member not found")
+	ErrAlreadyOrgMember     = errors.New("user is already a member of this organization")
+	ErrLastOwner            = errors.New("an organization must keep at least one owner")
+	ErrInsufficientRole     = errors.New("your role in this organization does not allow this action")
+	ErrOwnsSharedOrg        = errors.New("transfer the ownership of organizations that have other members first")
+)
+
+// PermissionError is returned when the role of a member lacks a permission. It matches ErrInsufficientRole.
+type PermissionError struct {
+	Permission models.Permission
+	Role       models.OrgRole
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("the %s role does not have the %s permission", e.Role, e.Permission)
+}
+
+func (e *PermissionError) Is(target error) bool {
+	return target == ErrInsufficientRole
+}
+
+// orgScopedCollections hold data that belongs to an organization since organizations were introduced.
+// Documents created before have a userId only and are moved to the personal organization of that user.
+var orgScopedCollections = []string{"contacts", "imports", "uploads", "exports", "export_schedules", "api_keys"}
+
+type OrganizationService struct {
+	db                   *mongo.Database
+	orgCollection        *mongo.Collection
+	membershipCollection *mongo.Collection
+	invitationCollection *mongo.Collection
+	userCollection       *mongo.Collection
+	mailer               mailer.Mailer
+	config               *config.Config
+}
+
+func NewOrganizationService(db *mongo.Database, cfg *config.Config, mail mailer.Mailer) *OrganizationService {
+	return &OrganizationService{
+		db:                   db,
+		orgCollection:        db.Collection("organizations"),
+		membershipCollection: db.Collection("memberships"),
+		invitationCollection: db.Collection("invitations"),
+		userCollection:       db.Collection("users"),
+		mailer:               mail,
+		config:               cfg,
+	}
+}
+
+// CreateOrganization creates an organization with the user as its owner
+func (s *OrganizationService) CreateOrganization(userID string, req models.CreateOrganizationRequest) (*models.OrganizationResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	org, membership, err := s.insertOrganization(ctx, userObjectID, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OrganizationResponse{Organization: *org, Role: membership.Role}, nil
+}
+
+// GetOrganizations lists the organizations of the user, marking the active one
+func (s *OrganizationService) GetOrganizations(userID, activeOrgID string) ([]models.OrganizationResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	cursor, err := s.membershipCollection.Find(ctx, bson.M{"userId": userObjectID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var memberships []models.Membership
+	if err := cursor.All(ctx, &memberships); err != nil {
+		return nil, err
+	}
+
+	roles := make(map[primitive.ObjectID]models.OrgRole, len(memberships))
+	orgIDs := make([]primitive.ObjectID, len(memberships))
+	for i, membership := range memberships {
+		roles[membership.OrgID] = membership.Role
+		orgIDs[i] = membership.OrgID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	orgCursor, err := s.orgCollection.Find(ctx, bson.M{"_id": bson.M{"$in": orgIDs}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer orgCursor.Close(ctx)
+
+	var orgs []models.Organization
+	if err := orgCursor.All(ctx, &orgs); err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.OrganizationResponse, len(orgs))
+	for i, org := range orgs {
+		responses[i] = models.OrganizationResponse{
+			Organization: org,
+			Role:         roles[org.ID],
+			Active:       org.ID.Hex() == activeOrgID,
+		}
+	}
+
+	return responses, nil
+}
+
+func (s *OrganizationService) GetOrganization(userID, orgID string) (*models.OrganizationResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	org, membership, err := s.findMemberOrganization(ctx, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OrganizationResponse{Organization: *org, Role: membership.Role}, nil
+}
+
+// UpdateOrganization renames an organization, admins and owners only
+func (s *OrganizationService) UpdateOrganization(userID, orgID string, req models.UpdateOrganizationRequest) (*models.OrganizationResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	org, membership, err := s.findMemberOrganization(ctx, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requirePermission(membership, models.PermissionOrgManage); err != nil {
+		return nil, err
+	}
+
+	if req.Name == "" && req.RequireMFA == nil {
+		return nil, errors.New("name or requireMfa is required")
+	}
+
+	org.UpdatedAt = time.Now()
+	update := bson.M{"updated_at": org.UpdatedAt}
+	if req.Name != "" {
+		org.Name = req.Name
+		update["name"] = org.Name
+	}
+	if req.RequireMFA != nil {
+		org.RequireMFA = *req.RequireMFA
+		update["requireMfa"] = org.RequireMFA
+	}
+
+	_, err = s.orgCollection.UpdateOne(ctx, bson.M{"_id": org.ID}, bson.M{"$set": update})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OrganizationResponse{Organization: *org, Role: membership.Role}, nil
+}
+
+// GetMembers lists the members of an organization with their users, visible to every member
+func (s *OrganizationService) GetMembers(userID, orgID string) ([]models.MemberResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	org, _, err := s.findMemberOrganization(ctx, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := s.membershipCollection.Find(ctx, bson.M{"orgId": org.ID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var memberships []models.Membership
+	if err := cursor.All(ctx, &memberships); err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]primitive.ObjectID, len(memberships))
+	for i, membership := range memberships {
+		userIDs[i] = membership.UserID
+	}
+
+	userCursor, err := s.userCollection.Find(ctx, bson.M{"_id": bson.M{"$in": userIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer userCursor.Close(ctx)
+
+	var users []models.User
+	if err := userCursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	usersByID := make(map[primitive.ObjectID]models.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	members := make([]models.MemberResponse, 0, len(memberships))
+	for _, membership := range memberships {
+		user, exists := usersByID[membership.UserID]
+		if !exists {
+			continue
+		}
+		members = append(members, memberResponse(membership, user))
+	}
+
+	return members, nil
+}
+
+// UpdateMember changes the role of a member. Only owners can change the role of an owner or make
+// someone an owner, and the last owner cannot be demoted.
+func (s *OrganizationService) UpdateMember(userID, orgID, memberUserID string, req models.UpdateMemberRequest) (*models.MemberResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	org, actor, err := s.findMemberOrganization(ctx, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	membership, err := s.findMember(ctx, org.ID, memberUserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requirePermission(actor, memberPermission(membership.Role)); err != nil {
+		return nil, err
+	}
+	if err := requirePermission(actor, memberPermission(req.Role)); err != nil {
+		return nil, err
+	}
+	if membership.Role == models.OrgRoleOwner && req.Role != models.OrgRoleOwner {
+		if err := s.ensureAnotherOwner(ctx, org.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	membership.Role = req.Role
+	membership.UpdatedAt = time.Now()
+	_, err = s.membershipCollection.UpdateOne(ctx,
+		bson.M{"_id": membership.ID},
+		bson.M{"$set": bson.M{"role": membership.Role, "updated_at": membership.UpdatedAt}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.userCollection.FindOne(ctx, bson.M{"_id": membership.UserID}).Decode(&user); err != nil {
+		return nil, err
+	}
+
+	response := memberResponse(*membership, user)
+	return &response, nil
+}
+
+// RemoveMember removes a member, or lets a member leave. The contacts they created stay in the organization,
+// their scheduled exports are disabled.
+func (s *OrganizationService) RemoveMember(userID, orgID, memberUserID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	org, actor, err := s.findMemberOrganization(ctx, userID, orgID)
+	if err != nil {
+		return err
+	}
+
+	membership, err := s.findMember(ctx, org.ID, memberUserID)
+	if err != nil {
+		return err
+	}
+
+	leaving := membership.UserID == actor.UserID
+	if !leaving {
+		if err := requirePermission(actor, memberPermission(membership.Role)); err != nil {
+			return err
+		}
+	}
+	if membership.Role == models.OrgRoleOwner {
+		if err := s.ensureAnotherOwner(ctx, org.ID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.membershipCollection.DeleteOne(ctx, bson.M{"_id": membership.ID}); err != nil {
+		return err
+	}
+
+	// Scheduled exports of the member would otherwise keep reading the organization's contacts
+	_, err = s.db.Collection("export_schedules").UpdateMany(ctx,
+		bson.M{"orgId": org.ID, "userId": membership.UserID},
+		bson.M{"$set": bson.M{"enabled": false, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// The next login of the removed user falls back to another organization
+	_, err = s.userCollection.UpdateOne(ctx,
+		bson.M{"_id": membership.UserID, "defaultOrgId": org.ID},
+		bson.M{"$unset": bson.M{"defaultOrgId": ""}},
+	)
+	return err
+}
+
+// ResolveMembership returns the membership of the user in an organization. Without an organization
+// it falls back to the user's default organization, then to the oldest membership, and finally
+// creates a personal organization for users that have none. The membership tells whether the
+// organization requires two-factor authentication the user has not enabled.
+func (s *OrganizationService) ResolveMembership(ctx context.Context, user *models.User, orgID primitive.ObjectID) (*models.Membership, error) {
+	membership, err := s.resolveMembership(ctx, user, orgID)
+	if err != nil || user.MFAEnabled {
+		return membership, err
+	}
+
+	count, err := s.orgCollection.CountDocuments(ctx, bson.M{"_id": membership.OrgID, "requireMfa": true})
+	if err != nil {
+		return nil, err
+	}
+	membership.MFAEnrollmentRequired = count > 0
+	return membership, nil
+}
+
+// RequiresMFA reports whether any organization of the user requires two-factor authentication.
+// Pending invitations do not count until they are accepted.
+func (s *OrganizationService) RequiresMFA(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	orgIDs, err := s.membershipCollection.Distinct(ctx, "orgId", bson.M{"userId": userID})
+	if err != nil {
+		return false, err
+	}
+	if len(orgIDs) == 0 {
+		return false, nil
+	}
+
+	count, err := s.orgCollection.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": orgIDs}, "requireMfa": true})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *OrganizationService) resolveMembership(ctx context.Context, user *models.User, orgID primitive.ObjectID) (*models.Membership, error) {
+	if !orgID.IsZero() {
+		return s.findMembership(ctx, orgID, user.ID)
+	}
+
+	if user.DefaultOrgID != nil {
+		membership, err := s.findMembership(ctx, *user.DefaultOrgID, user.ID)
+		if !errors.Is(err, ErrNotOrgMember) {
+			return membership, err
+		}
+	}
+
+	var membership models.Membership
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	err := s.membershipCollection.FindOne(ctx, bson.M{"userId": user.ID}, opts).Decode(&membership)
+	if err == mongo.ErrNoDocuments {
+		return s.createPersonalOrganization(ctx, user)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.SetDefaultOrganization(ctx, user, membership.OrgID); err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// MigrateToOrganizations moves data created before organizations existed into the personal
+// organization of its user, creating that organization where needed. It only touches documents
+// without an organization, so running it again is cheap and safe.
+func (s *OrganizationService) MigrateToOrganizations() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.BulkOperationTimeout)
+	defer cancel()
+
+	pending := make(map[primitive.ObjectID]bool)
+	for _, name := range orgScopedCollections {
+		userIDs, err := s.db.Collection(name).Distinct(ctx, "userId", bson.M{"orgId": bson.M{"$exists": false}})
+		if err != nil {
+			return err
+		}
+		for _, userID := range userIDs {
+			if objectID, ok := userID.(primitive.ObjectID); ok {
+				pending[objectID] = true
+			}
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	for userID := range pending {
+		var user models.User
+		if err := s.userCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+			if err == mongo.ErrNoDocuments {
+				log.Printf("Skipping organization migration of deleted user %s", userID.Hex())
+				continue
+			}
+			return err
+		}
+
+		membership, err := s.ResolveMembership(ctx, &user, primitive.NilObjectID)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range orgScopedCollections {
+			_, err := s.db.Collection(name).UpdateMany(ctx,
+				bson.M{"userId": userID, "orgId": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"orgId": membership.OrgID}},
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Printf("Moved the data of %d users into their organizations", len(pending))
+	return nil
+}
+
+// createPersonalOrganization gives a user without any organization one of their own
+func (s *OrganizationService) createPersonalOrganization(ctx context.Context, user *models.User) (*models.Membership, error) {
+	_, membership, err := s.insertOrganization(ctx, user.ID, user.Name+"'s workspace")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.SetDefaultOrganization(ctx, user, membership.OrgID); err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+func (s *OrganizationService) insertOrganization(ctx context.Context, ownerID primitive.ObjectID, name string) (*models.Organization, *models.Membership, error) {
+	now := time.Now()
+	org := &models.Organization{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		CreatedBy: ownerID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := s.orgCollection.InsertOne(ctx, org); err != nil {
+		return nil, nil, err
+	}
+
+	membership := &models.Membership{
+		ID:        primitive.NewObjectID(),
+		OrgID:     org.ID,
+		UserID:    ownerID,
+		Role:      models.OrgRoleOwner,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := s.membershipCollection.InsertOne(ctx, membership); err != nil {
+		return nil, nil, err
+	}
+
+	return org, membership, nil
+}
+
+// SetDefaultOrganization makes an organization the one that is active after the next login
+func (s *OrganizationService) SetDefaultOrganization(ctx context.Context, user *models.User, orgID primitive.ObjectID) error {
+	if user.DefaultOrgID != nil && *user.DefaultOrgID == orgID {
+		return nil
+	}
+
+	_, err := s.userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"defaultOrgId": orgID}})
+	if err != nil {
+		return err
+	}
+	user.DefaultOrgID = &orgID
+	return nil
+}
+
+// findMemberOrganization returns an organization and the membership of the user in it.
+// Organizations the user is not a member of are reported as not found.
+func (s *OrganizationService) findMemberOrganization(ctx context.Context, userID, orgID string) (*models.Organization, *models.Membership, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, nil, errors.New("invalid user ID")
+	}
+
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, nil, ErrOrganizationNotFound
+	}
+
+	membership, err := s.findMembership(ctx, orgObjectID, userObjectID)
+	if err != nil {
+		if errors.Is(err, ErrNotOrgMember) {
+			return nil, nil, ErrOrganizationNotFound
+		}
+		return nil, nil, err
+	}
+
+	var org models.Organization
+	if err := s.orgCollection.FindOne(ctx, bson.M{"_id": orgObjectID}).Decode(&org); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, ErrOrganizationNotFound
+		}
+		return nil, nil, err
+	}
+
+	return &org, membership, nil
+}
+
+func (s *OrganizationService) findMembership(ctx context.Context, orgID, userID primitive.ObjectID) (*models.Membership, error) {
+	var membership models.Membership
+	err := s.membershipCollection.FindOne(ctx, bson.M{"orgId": orgID, "userId": userID}).Decode(&membership)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotOrgMember
+		}
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (s *OrganizationService) findMember(ctx context.Context, orgID primitive.ObjectID, memberUserID string) (*models.Membership, error) {
+	memberObjectID, err := primitive.ObjectIDFromHex(memberUserID)
+	if err != nil {
+		return nil, ErrMemberNotFound
+	}
+
+	membership, err := s.findMembership(ctx, orgID, memberObjectID)
+	if errors.Is(err, ErrNotOrgMember) {
+		return nil, ErrMemberNotFound
+	}
+	return membership, err
+}
+
+// soleOrganizations returns the organizations the user is the only member of, which are deleted
+// with their account. The user must not be the last owner of an organization with other members.
+func (s *OrganizationService) soleOrganizations(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	cursor, err := s.membershipCollection.Find(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return nil, err
+	}
+	var memberships []models.Membership
+	if err := cursor.All(ctx, &memberships); err != nil {
+		return nil, err
+	}
+
+	var orgIDs []primitive.ObjectID
+	for _, membership := range memberships {
+		members, err := s.membershipCollection.CountDocuments(ctx, bson.M{"orgId": membership.OrgID})
+		if err != nil {
+			return nil, err
+		}
+		if members == 1 {
+			orgIDs = append(orgIDs, membership.OrgID)
+			continue
+		}
+
+		if membership.Role == models.OrgRoleOwner {
+			if err := s.ensureAnotherOwner(ctx, membership.OrgID); err != nil {
+				if errors.Is(err, ErrLastOwner) {
+					return nil, ErrOwnsSharedOrg
+				}
+				return nil, err
+			}
+		}
+	}
+	return orgIDs, nil
+}
+
+// deleteOrganizations deletes organizations with their memberships and data
+func (s *OrganizationService) deleteOrganizations(ctx context.Context, orgIDs []primitive.ObjectID) error {
+	if len(orgIDs) == 0 {
+		return nil
+	}
+
+	filter := bson.M{"orgId": bson.M{"$in": orgIDs}}
+	for _, name := range orgScopedCollections {
+		if _, err := s.db.Collection(name).DeleteMany(ctx, filter); err != nil {
+			return err
+		}
+	}
+	if _, err := s.membershipCollection.DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+	if _, err := s.invitationCollection.DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+	_, err := s.orgCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": orgIDs}})
+	return err
+}
+
+func (s *OrganizationService) ensureAnotherOwner(ctx context.Context, orgID primitive.ObjectID) error {
+	owners, err := s.membershipCollection.CountDocuments(ctx, bson.M{"orgId": orgID, "role": models.OrgRoleOwner})
+	if err != nil {
+		return err
+	}
+	if owners < 2 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// Authorize checks that the user is a member of the organization whose role has the permission.
+// Services call it before acting, so the check does not depend on the route alone.
+func (s *OrganizationService) Authorize(ctx context.Context, orgID, userID primitive.ObjectID, permission models.Permission) error {
+	membership, err := s.findMembership(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	return requirePermission(membership, permission)
+}
+
+func requirePermission(membership *models.Membership, permission models.Permission) error {
+	if !membership.Role.Can(permission) {
+		return &PermissionError{Permission: permission, Role: membership.Role}
+	}
+	return nil
+}
+
+// memberPermission returns the permission needed to manage members with a role
+func memberPermission(role models.OrgRole) models.Permission {
+	if role == models.OrgRoleOwner {
+		return models.PermissionOwnersManage
+	}
+	return models.PermissionMembersManage
+}
+
+func memberResponse(membership models.Membership, user models.User) models.MemberResponse {
+	return models.MemberResponse{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Role:      membership.Role,
+		CreatedAt: membership.CreatedAt,
+	}
+}
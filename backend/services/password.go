@@ -0,0 +1,190 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"contact-enrichment-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrWeakPassword is wrapped with the rule a new password breaks
+var ErrWeakPassword = errors.New("password is too weak")
+
+// errPasswordMismatch is returned when a password does not match its hash
+var errPasswordMismatch = errors.New("password does not match")
+
+// Password policy rules besides the configurable minimum length
+const (
+	maxPasswordLength        = 256
+	minDistinctPasswordChars = 5
+	minPersonalWordLength    = 4 // Shorter parts of the email or name may appear in a password by chance
+)
+
+// Salt and key sizes of Argon2id hashes
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+//go:embed breached_passwords.txt
+var builtinBreachedPasswords string
+
+// hashPassword hashes a password with Argon2id and the configured parameters, in the PHC string
+// format: $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>
+func (s *AuthService) hashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	memory, iterations, parallelism := s.config.PasswordArgon2Memory, s.config.PasswordArgon2Iterations, s.config.PasswordArgon2Parallelism
+	key := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, memory, iterations, parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// comparePassword checks a password against a stored hash: Argon2id, or bcrypt for passwords set
+// before Argon2id. rehash reports that the hash should be replaced with one of the current parameters.
+func (s *AuthService) comparePassword(hash, password string) (rehash bool, err error) {
+	if strings.HasPrefix(hash, "$2") {
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			return false, errPasswordMismatch
+		}
+		return true, nil
+	}
+
+	var version int
+	var memory, iterations uint32
+	var parallelism uint8
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, errors.New("unsupported password hash")
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errors.New("unsupported Argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+		return false, fmt.Errorf("invalid Argon2 parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, err
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return false, errPasswordMismatch
+	}
+
+	rehash = memory != s.config.PasswordArgon2Memory ||
+		iterations != s.config.PasswordArgon2Iterations ||
+		parallelism != s.config.PasswordArgon2Parallelism ||
+		len(salt) != argon2SaltLength || len(key) != argon2KeyLength
+	return rehash, nil
+}
+
+// upgradePasswordHash replaces the hash of a verified password with one of the current scheme and
+// parameters. It is best effort, the old hash keeps working when it fails.
+func (s *AuthService) upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	hash, err := s.hashPassword(password)
+	if err != nil {
+		log.Printf("Failed to rehash the password of user %s: %v", user.ID.Hex(), err)
+		return
+	}
+
+	// Only the hash that was verified is replaced, never a password changed in the meantime
+	_, err = s.userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "password": user.Password},
+		bson.M{"$set": bson.M{"password": hash}},
+	)
+	if err != nil {
+		log.Printf("Failed to rehash the password of user %s: %v", user.ID.Hex(), err)
+		return
+	}
+	user.Password = hash
+}
+
+// validatePassword applies the password policy to a new password of the user with the email and name
+func (s *AuthService) validatePassword(password, email, name string) error {
+	length := utf8.RuneCountInString(password)
+	if length < s.config.PasswordMinLength {
+		return fmt.Errorf("%w: use at least %d characters", ErrWeakPassword, s.config.PasswordMinLength)
+	}
+	if length > maxPasswordLength {
+		return fmt.Errorf("%w: use at most %d characters", ErrWeakPassword, maxPasswordLength)
+	}
+
+	distinct := make(map[rune]struct{})
+	for _, r := range password {
+		distinct[r] = struct{}{}
+	}
+	if len(distinct) < minDistinctPasswordChars {
+		return fmt.Errorf("%w: use at least %d different characters", ErrWeakPassword, minDistinctPasswordChars)
+	}
+
+	lowered := strings.ToLower(password)
+	if _, breached := s.breachedPasswords[lowered]; breached {
+		return fmt.Errorf("%w: it appears in lists of breached passwords", ErrWeakPassword)
+	}
+
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	for _, word := range append(strings.Fields(strings.ToLower(name)), localPart) {
+		if utf8.RuneCountInString(word) >= minPersonalWordLength && strings.Contains(lowered, word) {
+			return fmt.Errorf("%w: do not use your name or email address", ErrWeakPassword)
+		}
+	}
+
+	return nil
+}
+
+// loadBreachedPasswords reads the built-in breached password list, and the one of the file when set.
+// Entries are lowercased, so variations in case are found too.
+func loadBreachedPasswords(path string) (map[string]struct{}, error) {
+	passwords := make(map[string]struct{})
+	readBreachedPasswords(strings.NewReader(builtinBreachedPasswords), passwords)
+	if path == "" {
+		return passwords, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := readBreachedPasswords(file, passwords); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return passwords, nil
+}
+
+func readBreachedPasswords(r io.Reader, passwords map[string]struct{}) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			passwords[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"contact-enrichment-api/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newPasswordTestService hashes with small Argon2id parameters, so the tests stay fast
+func newPasswordTestService(t *testing.T) *AuthService {
+	t.Helper()
+
+	breached, err := loadBreachedPasswords("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &AuthService{
+		config: &config.Config{
+			PasswordArgon2Memory:      64,
+			PasswordArgon2Iterations:  1,
+			PasswordArgon2Parallelism: 1,
+			PasswordMinLength:         10,
+		},
+		breachedPasswords: breached,
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	s := newPasswordTestService(t)
+
+	hash, err := s.hashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("hash %s is not in the PHC format of the configured parameters", hash)
+	}
+
+	other, err := s.hashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == other {
+		t.Error("hashes of the same password share a salt")
+	}
+}
+
+func TestComparePassword(t *testing.T) {
+	const password = "correct horse battery"
+
+	current := newPasswordTestService(t)
+	hash, err := current.hashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stronger := newPasswordTestService(t)
+	stronger.config.PasswordArgon2Iterations = 2
+	strongerHash, err := stronger.hashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(hash, "$")
+	withPart := func(index int, value string) string {
+		changed := append([]string(nil), parts...)
+		changed[index] = value
+		return strings.Join(changed, "$")
+	}
+
+	tests := []struct {
+		name       string
+		hash       string
+		password   string
+		wantRehash bool
+		wantErr    error
+		wantAnyErr bool // Any error of an unreadable hash
+	}{
+		{name: "current parameters", hash: hash, password: password},
+		{name: "wrong password", hash: hash, password: "correct horse battery!", wantErr: errPasswordMismatch},
+		{name: "other parameters are rehashed", hash: strongerHash, password: password, wantRehash: true},
+		{name: "bcrypt is rehashed", hash: string(bcryptHash), password: password, wantRehash: true},
+		{name: "wrong bcrypt password", hash: string(bcryptHash), password: "wrong", wantErr: errPasswordMismatch},
+		{name: "argon2i", hash: withPart(1, "argon2i"), password: password, wantAnyErr: true},
+		{name: "old Argon2 version", hash: withPart(2, "v=16"), password: password, wantAnyErr: true},
+		{name: "missing parameters", hash: withPart(3, "m=64,t=1"), password: password, wantAnyErr: true},
+		{name: "invalid salt", hash: withPart(4, "not base64!"), password: password, wantAnyErr: true},
+		{name: "invalid key", hash: withPart(5, "not base64!"), password: password, wantAnyErr: true},
+		{name: "missing key", hash: strings.Join(parts[:5], "$"), password: password, wantAnyErr: true},
+		{name: "empty hash", hash: "", password: password, wantAnyErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rehash, err := current.comparePassword(tt.hash, tt.password)
+			switch {
+			case tt.wantAnyErr:
+				if err == nil || errors.Is(err, errPasswordMismatch) {
+					t.Errorf("got error %v, want a hash error", err)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if rehash != tt.wantRehash {
+				t.Errorf("rehash %v, want %v", rehash, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		userName string
+		wantErr  string // Part of the rule, empty when the password is accepted
+	}{
+		{name: "accepted", password: "violet tractor 42", email: "jane.doe@example.com", userName: "Jane Doe"},
+		{name: "too short", password: "v1olet-42", wantErr: "at least 10 characters"},
+		{name: "length counts characters, not bytes", password: "éüñøåçßðþæ"},
+		{name: "too long", password: strings.Repeat("abcdefghij", 26), wantErr: "at most 256 characters"},
+		{name: "repeated characters", password: "abababababab", wantErr: "different characters"},
+		{name: "breached", password: "password123", wantErr: "breached"},
+		{name: "breached in another case", password: "QwertyUiop", wantErr: "breached"},
+		{name: "contains the name", password: "ilovejanelle99", userName: "Janelle Smith", wantErr: "your name"},
+		{name: "contains the email", password: "xx-jdoe1982-xx", email: "jdoe1982@example.com", wantErr: "email address"},
+		{name: "short name parts are allowed", password: "violet jo tractor", userName: "Jo Li"},
+	}
+
+	s := newPasswordTestService(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.validatePassword(tt.password, tt.email, tt.userName)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("rejected: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrWeakPassword) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBreachedPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte("# comment\n\n  Hunter2Hunter2  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	passwords, err := loadBreachedPasswords(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, password := range []string{"hunter2hunter2", "password123"} {
+		if _, ok := passwords[password]; !ok {
+			t.Errorf("%q is missing", password)
+		}
+	}
+	if _, ok := passwords["# comment"]; ok {
+		t.Error("comments are read as passwords")
+	}
+
+	if _, err := loadBreachedPasswords(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("a missing file was accepted")
+	}
+}
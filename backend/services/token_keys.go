@@ -0,0 +1,259 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"contact-enrichment-api/config"
+	"contact-enrichment-api/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Tokens signed with other algorithms, including "none", are rejected
+var tokenSigningMethods = []string{"HS256", "RS256", "EdDSA"}
+
+// RSA keys shorter than this are refused
+const minRSAKeyBits = 2048
+
+// tokenKey is a key tokens of this service are signed or verified with. The ID is sent in the kid
+// header, so a token is only checked against the key that signed it.
+type tokenKey struct {
+	id              string
+	method          jwt.SigningMethod
+	signingKey      interface{} // nil for keys that only verify
+	verificationKey interface{}
+	publicKey       *models.JSONWebKey // nil for HMAC secrets, which are never published
+}
+
+// tokenKeySet signs tokens with the current key and verifies them with any key of the set
+type tokenKeySet struct {
+	current *tokenKey
+	keys    []*tokenKey
+
+	// Tokens issued before tokens had a kid are accepted until legacyUntil, one access token
+	// lifetime after the set was loaded, so the upgrade signs no one out
+	loadedAt    time.Time
+	legacyUntil time.Time
+}
+
+// loadTokenKeySet reads the signing key and the verification keys of the configuration
+func loadTokenKeySet(cfg *config.Config) (*tokenKeySet, error) {
+	var current *tokenKey
+	if cfg.JWTAlgorithm == "HS256" {
+		current = hmacTokenKey(cfg.JWTSecret)
+	} else {
+		key, err := loadTokenKeyFile(cfg.JWTPrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if key.signingKey == nil {
+			return nil, fmt.Errorf("%s holds a public key, the signing key must be private", cfg.JWTPrivateKeyFile)
+		}
+		if key.method.Alg() != cfg.JWTAlgorithm {
+			return nil, fmt.Errorf("%s holds a %s key, JWT_ALGORITHM is %s", cfg.JWTPrivateKeyFile, key.method.Alg(), cfg.JWTAlgorithm)
+		}
+		current = key
+	}
+
+	now := time.Now()
+	set := &tokenKeySet{current: current, keys: []*tokenKey{current}, loadedAt: now, legacyUntil: now.Add(cfg.JWTExpiration)}
+	for _, secret := range cfg.JWTVerificationSecrets {
+		set.add(hmacTokenKey(secret))
+	}
+	for _, path := range cfg.JWTVerificationKeyFiles {
+		key, err := loadTokenKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		set.add(key)
+	}
+
+	return set, nil
+}
+
+// add adds a verification key, unless it is already in the set
+func (k *tokenKeySet) add(key *tokenKey) {
+	for _, existing := range k.keys {
+		if existing.id == key.id {
+			return
+		}
+	}
+	key.signingKey = nil
+	k.keys = append(k.keys, key)
+}
+
+// sign signs the claims with the current key
+func (k *tokenKeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.current.method, claims)
+	token.Header["kid"] = k.current.id
+	return token.SignedString(k.current.signingKey)
+}
+
+// verificationKey is the jwt.Keyfunc of the set. The key is found by the kid header, and the
+// algorithm has to be the key's, so a public key can never be used as an HMAC secret.
+func (k *tokenKeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return k.legacyVerificationKeys(token)
+	}
+	for _, key := range k.keys {
+		if key.id != kid {
+			continue
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, errors.New("token algorithm does not match its key")
+		}
+		return key.verificationKey, nil
+	}
+	return nil, errors.New("token is signed with an unknown key")
+}
+
+// legacyVerificationKeys returns the HS256 secrets for a token without a kid, as signed before
+// tokens had one. Only tokens issued before the set was loaded are accepted, until legacyUntil.
+func (k *tokenKeySet) legacyVerificationKeys(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != jwt.SigningMethodHS256.Alg() || !time.Now().Before(k.legacyUntil) {
+		return nil, errors.New("token is signed with an unknown key")
+	}
+	issuedAt, err := token.Claims.GetIssuedAt()
+	if err != nil || issuedAt == nil || !issuedAt.Before(k.loadedAt) {
+		return nil, errors.New("token is signed with an unknown key")
+	}
+
+	var secrets jwt.VerificationKeySet
+	for _, key := range k.keys {
+		if key.method.Alg() == jwt.SigningMethodHS256.Alg() {
+			secrets.Keys = append(secrets.Keys, key.verificationKey)
+		}
+	}
+	if len(secrets.Keys) == 0 {
+		return nil, errors.New("token is signed with an unknown key")
+	}
+	return secrets, nil
+}
+
+// isLegacyToken reports whether a token has no kid, as tokens issued before the kid, issuer and
+// audience were added. The token is not verified.
+func isLegacyToken(tokenString string) bool {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return false
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid == ""
+}
+
+// jwks lists the public keys of the set, the current key first
+func (k *tokenKeySet) jwks() models.JSONWebKeySet {
+	keys := []models.JSONWebKey{}
+	for _, key := range k.keys {
+		if key.publicKey != nil {
+			keys = append(keys, *key.publicKey)
+		}
+	}
+	return models.JSONWebKeySet{Keys: keys}
+}
+
+// hmacTokenKey makes an HS256 key of a secret. Its ID is derived from the secret, so the secret
+// keeps the ID when it moves from JWT_SECRET to the verification secrets.
+func hmacTokenKey(secret string) *tokenKey {
+	sum := sha256.Sum256([]byte("jwt-kid:" + secret))
+	return &tokenKey{
+		id:              "hs256-" + hex.EncodeToString(sum[:8]),
+		method:          jwt.SigningMethodHS256,
+		signingKey:      []byte(secret),
+		verificationKey: []byte(secret),
+	}
+}
+
+// loadTokenKeyFile reads an RSA or Ed25519 key from a PEM file: a PKCS #8 or PKCS #1 private key,
+// or a PKIX public key for keys that only verify
+func loadTokenKeyFile(path string) (*tokenKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s holds no PEM key", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s holds an unsupported %s block", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var key *tokenKey
+	switch parsed := parsed.(type) {
+	case *rsa.PrivateKey:
+		key = rsaTokenKey(&parsed.PublicKey)
+		key.signingKey = parsed
+	case *rsa.PublicKey:
+		key = rsaTokenKey(parsed)
+	case ed25519.PrivateKey:
+		key = ed25519TokenKey(parsed.Public().(ed25519.PublicKey))
+		key.signingKey = parsed
+	case ed25519.PublicKey:
+		key = ed25519TokenKey(parsed)
+	default:
+		return nil, fmt.Errorf("%s holds a %T, use an RSA or Ed25519 key", path, parsed)
+	}
+
+	if public, ok := key.verificationKey.(*rsa.PublicKey); ok && public.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("%s holds a %d bit RSA key, at least %d bits are required", path, public.N.BitLen(), minRSAKeyBits)
+	}
+	return key, nil
+}
+
+func rsaTokenKey(public *rsa.PublicKey) *tokenKey {
+	jwk := models.JSONWebKey{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+	}
+	jwk.Kid = jwkThumbprint(map[string]string{"e": jwk.E, "kty": jwk.Kty, "n": jwk.N})
+	return &tokenKey{id: jwk.Kid, method: jwt.SigningMethodRS256, verificationKey: public, publicKey: &jwk}
+}
+
+func ed25519TokenKey(public ed25519.PublicKey) *tokenKey {
+	jwk := models.JSONWebKey{
+		Kty: "OKP",
+		Use: "sig",
+		Alg: "EdDSA",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(public),
+	}
+	jwk.Kid = jwkThumbprint(map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X})
+	return &tokenKey{id: jwk.Kid, method: jwt.SigningMethodEdDSA, verificationKey: public, publicKey: &jwk}
+}
+
+// jwkThumbprint is the RFC 7638 thumbprint of a public key, given its required members. Maps are
+// marshalled with sorted keys and no whitespace, the canonical form the thumbprint is taken of.
+func jwkThumbprint(members map[string]string) string {
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,386 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"contact-enrichment-api/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWKThumbprint(t *testing.T) {
+	tests := []struct {
+		name    string
+		members map[string]string
+		want    string
+	}{
+		{
+			name: "RFC 7638 RSA key",
+			members: map[string]string{
+				"kty": "RSA",
+				"e":   "AQAB",
+				"n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjB" +
+					"ZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZ" +
+					"gnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIq" +
+					"bw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			name:    "RFC 8037 Ed25519 key",
+			members: map[string]string{"kty": "OKP", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+			want:    "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jwkThumbprint(tt.members); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTokenKeySet(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := generateRSATestKey(t, minRSAKeyBits)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPrivate := writeTestKeyFile(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	rsaPublic := writeTestKeyFile(t, dir, "rsa.pub", "PUBLIC KEY", marshalTestPublicKey(t, &rsaKey.PublicKey))
+	edPrivate := writeTestKeyFile(t, dir, "ed25519.pem", "PRIVATE KEY", marshalTestPrivateKey(t, edKey))
+	edPublic := writeTestKeyFile(t, dir, "ed25519.pub", "PUBLIC KEY", marshalTestPublicKey(t, edKey.Public()))
+	weakRSA := writeTestKeyFile(t, dir, "weak.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(generateRSATestKey(t, 1024)))
+	certificate := writeTestKeyFile(t, dir, "cert.pem", "CERTIFICATE", []byte("not a key"))
+
+	tests := []struct {
+		name        string
+		cfg         config.Config
+		wantErr     string
+		wantAlg     string
+		wantKeys    int
+		wantPublic  int
+		wantCurrent string // kid of the current key, when known in advance
+	}{
+		{
+			name:        "HMAC secret",
+			cfg:         config.Config{JWTAlgorithm: "HS256", JWTSecret: "secret"},
+			wantAlg:     "HS256",
+			wantKeys:    1,
+			wantCurrent: hmacTokenKey("secret").id,
+		},
+		{
+			name:     "RSA key",
+			cfg:      config.Config{JWTAlgorithm: "RS256", JWTPrivateKeyFile: rsaPrivate},
+			wantAlg:  "RS256",
+			wantKeys: 1, wantPublic: 1,
+		},
+		{
+			name:     "Ed25519 key",
+			cfg:      config.Config{JWTAlgorithm: "EdDSA", JWTPrivateKeyFile: edPrivate},
+			wantAlg:  "EdDSA",
+			wantKeys: 1, wantPublic: 1,
+		},
+		{
+			name: "rotation from a secret to an RSA key",
+			cfg: config.Config{
+				JWTAlgorithm:            "RS256",
+				JWTPrivateKeyFile:       rsaPrivate,
+				JWTVerificationSecrets:  []string{"old secret"},
+				JWTVerificationKeyFiles: []string{edPublic},
+			},
+			wantAlg:  "RS256",
+			wantKeys: 3, wantPublic: 2,
+		},
+		{
+			name: "the signing key is not added again",
+			cfg: config.Config{
+				JWTAlgorithm:            "RS256",
+				JWTPrivateKeyFile:       rsaPrivate,
+				JWTVerificationKeyFiles: []string{rsaPublic, rsaPrivate},
+			},
+			wantAlg:  "RS256",
+			wantKeys: 1, wantPublic: 1,
+		},
+		{
+			name:    "public signing key",
+			cfg:     config.Config{JWTAlgorithm: "RS256", JWTPrivateKeyFile: rsaPublic},
+			wantErr: "must be private",
+		},
+		{
+			name:    "algorithm of another key type",
+			cfg:     config.Config{JWTAlgorithm: "RS256", JWTPrivateKeyFile: edPrivate},
+			wantErr: "JWT_ALGORITHM is RS256",
+		},
+		{
+			name:    "short RSA key",
+			cfg:     config.Config{JWTAlgorithm: "RS256", JWTPrivateKeyFile: weakRSA},
+			wantErr: "at least 2048 bits",
+		},
+		{
+			name:    "unsupported PEM block",
+			cfg:     config.Config{JWTAlgorithm: "RS256", JWTPrivateKeyFile: certificate},
+			wantErr: "unsupported CERTIFICATE block",
+		},
+		{
+			name:    "missing verification key file",
+			cfg:     config.Config{JWTAlgorithm: "HS256", JWTSecret: "secret", JWTVerificationKeyFiles: []string{filepath.Join(dir, "missing.pem")}},
+			wantErr: "missing.pem",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := loadTokenKeySet(&tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if alg := set.current.method.Alg(); alg != tt.wantAlg {
+				t.Errorf("current key signs with %s, want %s", alg, tt.wantAlg)
+			}
+			if tt.wantCurrent != "" && set.current.id != tt.wantCurrent {
+				t.Errorf("current key %s, want %s", set.current.id, tt.wantCurrent)
+			}
+			if len(set.keys) != tt.wantKeys {
+				t.Errorf("got %d keys, want %d", len(set.keys), tt.wantKeys)
+			}
+			for _, key := range set.keys[1:] {
+				if key.signingKey != nil {
+					t.Errorf("verification key %s can sign", key.id)
+				}
+			}
+
+			jwks := set.jwks()
+			if len(jwks.Keys) != tt.wantPublic {
+				t.Fatalf("published %d keys, want %d", len(jwks.Keys), tt.wantPublic)
+			}
+			if tt.wantPublic > 0 && jwks.Keys[0].Kid != set.current.id {
+				t.Errorf("first published key %s, want the current key %s", jwks.Keys[0].Kid, set.current.id)
+			}
+			for _, jwk := range jwks.Keys {
+				if jwk.Use != "sig" || jwk.Alg == "HS256" {
+					t.Errorf("published key %+v", jwk)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenKeySetVerificationKey(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := generateRSATestKey(t, minRSAKeyBits)
+	rsaPrivate := writeTestKeyFile(t, dir, "rsa.pem", "PRIVATE KEY", marshalTestPrivateKey(t, rsaKey))
+	rsaPublicDER := marshalTestPublicKey(t, &rsaKey.PublicKey)
+
+	oldSet, err := loadTokenKeySet(&config.Config{JWTAlgorithm: "HS256", JWTSecret: "old secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := loadTokenKeySet(&config.Config{
+		JWTAlgorithm:           "RS256",
+		JWTPrivateKeyFile:      rsaPrivate,
+		JWTVerificationSecrets: []string{"old secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKid := set.current.id
+
+	claims := jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+	signWith := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	sign := func(keys *tokenKeySet) string {
+		signed, err := keys.sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		wantOK bool
+	}{
+		{name: "current key", token: sign(set), wantOK: true},
+		{name: "rotated out secret", token: sign(oldSet), wantOK: true},
+		{name: "public key used as an HMAC secret", token: signWith(jwt.SigningMethodHS256, rsaKid, rsaPublicDER)},
+		{name: "secret used under the RSA kid", token: signWith(jwt.SigningMethodHS256, rsaKid, []byte("old secret"))},
+		{name: "unknown kid", token: signWith(jwt.SigningMethodRS256, "unknown", rsaKey)},
+		{name: "no kid", token: signWith(jwt.SigningMethodRS256, "", rsaKey)},
+		{name: "unsigned", token: signWith(jwt.SigningMethodNone, rsaKid, jwt.UnsafeAllowNoneSignatureType)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(tt.token, set.verificationKey, jwt.WithValidMethods(tokenSigningMethods))
+			if ok := err == nil; ok != tt.wantOK {
+				t.Errorf("verified %v (%v), want %v", ok, err, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTokenKeySetLegacyTokens(t *testing.T) {
+	set, err := loadTokenKeySet(&config.Config{JWTAlgorithm: "HS256", JWTSecret: "secret", JWTExpiration: 15 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := loadTokenKeySet(&config.Config{
+		JWTAlgorithm:           "EdDSA",
+		JWTPrivateKeyFile:      writeTestKeyFile(t, t.TempDir(), "ed25519.pem", "PRIVATE KEY", marshalTestPrivateKey(t, newEd25519TestKey(t))),
+		JWTVerificationSecrets: []string{"secret"},
+		JWTExpiration:          15 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := *set
+	expired.legacyUntil = time.Now().Add(-time.Second)
+
+	// Tokens as they were issued before they had a kid, issuer and audience
+	legacyToken := func(secret string, issuedAt *jwt.NumericDate) string {
+		claims := Claims{UserID: "user", RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			IssuedAt:  issuedAt,
+		}}
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	before := jwt.NewNumericDate(set.loadedAt.Add(-time.Minute))
+
+	tests := []struct {
+		name   string
+		keys   *tokenKeySet
+		token  string
+		wantOK bool
+	}{
+		{name: "issued before the upgrade", keys: set, token: legacyToken("secret", before), wantOK: true},
+		{name: "secret moved to the verification secrets", keys: rotated, token: legacyToken("secret", before), wantOK: true},
+		{name: "issued after the upgrade", keys: set, token: legacyToken("secret", jwt.NewNumericDate(time.Now().Add(time.Minute)))},
+		{name: "without issue time", keys: set, token: legacyToken("secret", nil)},
+		{name: "after the deprecation window", keys: &expired, token: legacyToken("secret", before)},
+		{name: "signed with another secret", keys: set, token: legacyToken("other secret", before)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &AuthService{
+				config:    &config.Config{JWTIssuer: "contact-enrichment-api", JWTAudience: "contact-enrichment-api"},
+				tokenKeys: tt.keys,
+			}
+			claims, err := s.ValidateToken(tt.token)
+			if ok := err == nil; ok != tt.wantOK {
+				t.Fatalf("accepted %v (%v), want %v", ok, err, tt.wantOK)
+			}
+			if tt.wantOK && claims.UserID != "user" {
+				t.Errorf("got claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestParseTokenRequiresIssuerWithKid(t *testing.T) {
+	set, err := loadTokenKeySet(&config.Config{JWTAlgorithm: "HS256", JWTSecret: "secret", JWTExpiration: 15 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &AuthService{
+		config:    &config.Config{JWTIssuer: "contact-enrichment-api", JWTAudience: "contact-enrichment-api"},
+		tokenKeys: set,
+	}
+
+	// A kid makes a token current, it cannot skip the issuer and audience checks
+	signed, err := set.sign(Claims{RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		IssuedAt:  jwt.NewNumericDate(set.loadedAt.Add(-time.Minute)),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ValidateToken(signed); err == nil {
+		t.Error("token with a kid but no issuer was accepted")
+	}
+}
+
+func newEd25519TestKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func generateRSATestKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func marshalTestPrivateKey(t *testing.T, key interface{}) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func marshalTestPublicKey(t *testing.T, key interface{}) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func writeTestKeyFile(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
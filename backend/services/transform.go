@@ -0,0 +1,256 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"contact-enrichment-api/models"
+)
+
+// Date layouts tried when a coerce step has no explicit layout
+var coerceDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"02 Jan 2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"1/2/2006",
+	"02.01.2006",
+}
+
+// transformPipeline is a validated set of transformation rules with compiled patterns
+type transformPipeline struct {
+	rules    []models.TransformRule
+	patterns map[string]*regexp.Regexp
+}
+
+func newTransformPipeline(rules []models.TransformRule) (*transformPipeline, error) {
+	if err := models.ValidateTransformRules(rules); err != nil {
+		return nil, err
+	}
+
+	pipeline := &transformPipeline{
+		rules:    rules,
+		patterns: make(map[string]*regexp.Regexp),
+	}
+	for _, rule := range rules {
+		for _, step := range rule.Steps {
+			if step.Type == models.TransformRegex {
+				pipeline.patterns[step.Pattern] = regexp.MustCompile(step.Pattern)
+			}
+		}
+	}
+
+	return pipeline, nil
+}
+
+// transformError reports the column whose rule failed
+type transformError struct {
+	column string
+	err    error
+}
+
+func (e *transformError) Error() string {
+	return fmt.Sprintf("column %s: %v", e.column, e.err)
+}
+
+// apply runs every rule over a raw import row and returns the transformed copy.
+// Rules run in order, so later rules see the columns written by earlier ones.
+func (p *transformPipeline) apply(row map[string]interface{}) (map[string]interface{}, *transformError) {
+	if p == nil || len(p.rules) == 0 {
+		return row, nil
+	}
+
+	result := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		result[column] = value
+	}
+
+	for _, rule := range p.rules {
+		value := result[rule.Column]
+
+		for _, step := range rule.Steps {
+			var err error
+			value, err = p.applyStep(step, value, result)
+			if err != nil {
+				return nil, &transformError{column: rule.Column, err: err}
+			}
+		}
+
+		target := rule.Target
+		if target == "" {
+			target = rule.Column
+		}
+		result[target] = value
+	}
+
+	return result, nil
+}
+
+func (p *transformPipeline) applyStep(step models.TransformStep, value interface{}, row map[string]interface{}) (interface{}, error) {
+	text := transformString(value)
+
+	switch step.Type {
+	case models.TransformTrim:
+		return strings.Join(strings.Fields(text), " "), nil
+
+	case models.TransformLowercase:
+		return strings.ToLower(text), nil
+
+	case models.TransformUppercase:
+		return strings.ToUpper(text), nil
+
+	case models.TransformTitleCase:
+		words := strings.Fields(strings.ToLower(text))
+		for i, word := range words {
+			runes := []rune(word)
+			runes[0] = []rune(strings.ToUpper(string(runes[0])))[0]
+			words[i] = string(runes)
+		}
+		return strings.Join(words, " "), nil
+
+	case models.TransformSplit:
+		parts := strings.Split(text, step.Delimiter)
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		for i, target := range step.Targets {
+			if i < len(parts) {
+				row[target] = parts[i]
+			}
+		}
+		index := step.Index
+		if index < 0 {
+			index += len(parts)
+		}
+		if index < 0 || index >= len(parts) {
+			return "", nil
+		}
+		return parts[index], nil
+
+	case models.TransformRegex:
+		match := p.patterns[step.Pattern].FindStringSubmatch(text)
+		if match == nil {
+			return "", nil
+		}
+		return match[step.Group], nil
+
+	case models.TransformMap:
+		if mapped, exists := step.Values[text]; exists {
+			return mapped, nil
+		}
+		if step.CaseInsensitive {
+			for from, to := range step.Values {
+				if strings.EqualFold(from, strings.TrimSpace(text)) {
+					return to, nil
+				}
+			}
+		}
+		return value, nil
+
+	case models.TransformDefault:
+		if strings.TrimSpace(text) == "" {
+			return step.Value, nil
+		}
+		return value, nil
+
+	case models.TransformConcat:
+		var parts []string
+		if strings.TrimSpace(text) != "" {
+			parts = append(parts, text)
+		}
+		for _, column := range step.Columns {
+			if part := transformString(row[column]); strings.TrimSpace(part) != "" {
+				parts = append(parts, part)
+			}
+		}
+		return strings.Join(parts, step.Delimiter), nil
+
+	case models.TransformCoalesce:
+		if strings.TrimSpace(text) != "" {
+			return value, nil
+		}
+		for _, column := range step.Columns {
+			if strings.TrimSpace(transformString(row[column])) != "" {
+				return row[column], nil
+			}
+		}
+		return value, nil
+
+	case models.TransformCoerce:
+		return coerceValue(text, step)
+	}
+
+	return nil, fmt.Errorf("unknown transform type %q", step.Type)
+}
+
+// coerceValue converts a raw value to the type requested by a coerce step; empty values stay empty
+func coerceValue(text string, step models.TransformStep) (interface{}, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", nil
+	}
+
+	switch step.As {
+	case models.CoerceString:
+		return text, nil
+
+	case models.CoerceNumber:
+		number, err := strconv.ParseFloat(strings.ReplaceAll(text, ",", ""), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", text)
+		}
+		return number, nil
+
+	case models.CoerceInteger:
+		cleaned := strings.ReplaceAll(text, ",", "")
+		if integer, err := strconv.ParseInt(cleaned, 10, 64); err == nil {
+			return integer, nil
+		}
+		number, err := strconv.ParseFloat(cleaned, 64)
+		if err != nil || number != float64(int64(number)) {
+			return nil, fmt.Errorf("%q is not an integer", text)
+		}
+		return int64(number), nil
+
+	case models.CoerceBoolean:
+		switch strings.ToLower(text) {
+		case "true", "yes", "y", "1", "on", "x":
+			return true, nil
+		case "false", "no", "n", "0", "off":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%q is not a boolean", text)
+
+	case models.CoerceDate:
+		layouts := coerceDateLayouts
+		if step.Layout != "" {
+			layouts = []string{step.Layout}
+		}
+		for _, layout := range layouts {
+			if date, err := time.Parse(layout, text); err == nil {
+				return date, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not a recognized date", text)
+	}
+
+	return nil, fmt.Errorf("unsupported coercion %q", step.As)
+}
+
+func transformString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
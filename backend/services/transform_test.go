@@ -0,0 +1,183 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"contact-enrichment-api/models"
+)
+
+func TestTransformSteps(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		step    models.TransformStep
+		row     map[string]interface{} // Other columns of the row
+		want    interface{}
+		wantRow map[string]interface{} // Columns the step writes
+	}{
+		{name: "trim collapses spaces", value: "  Jane   van  Dijk ", step: models.TransformStep{Type: models.TransformTrim}, want: "Jane van Dijk"},
+		{name: "lowercase", value: "JANE@Example.COM", step: models.TransformStep{Type: models.TransformLowercase}, want: "jane@example.com"},
+		{name: "uppercase", value: "nl", step: models.TransformStep{Type: models.TransformUppercase}, want: "NL"},
+		{name: "titlecase", value: "jOSÉ  garcía", step: models.TransformStep{Type: models.TransformTitleCase}, want: "José García"},
+		{name: "titlecase of nothing", value: nil, step: models.TransformStep{Type: models.TransformTitleCase}, want: ""},
+		{
+			name:    "split keeps a part and writes targets",
+			value:   "Doe, Jane",
+			step:    models.TransformStep{Type: models.TransformSplit, Delimiter: ",", Index: 1, Targets: []string{"last", "first"}},
+			want:    "Jane",
+			wantRow: map[string]interface{}{"last": "Doe", "first": "Jane"},
+		},
+		{name: "split from the end", value: "a/b/c", step: models.TransformStep{Type: models.TransformSplit, Delimiter: "/", Index: -1}, want: "c"},
+		{name: "split past the parts", value: "a/b", step: models.TransformStep{Type: models.TransformSplit, Delimiter: "/", Index: 5}, want: ""},
+		{name: "regex group", value: "Jane <jane@example.com>", step: models.TransformStep{Type: models.TransformRegex, Pattern: `<([^>]+)>`, Group: 1}, want: "jane@example.com"},
+		{name: "regex without a match", value: "no address", step: models.TransformStep{Type: models.TransformRegex, Pattern: `<([^>]+)>`, Group: 1}, want: ""},
+		{name: "map", value: "VP", step: models.TransformStep{Type: models.TransformMap, Values: map[string]string{"VP": "Vice President"}}, want: "Vice President"},
+		{name: "map ignoring case", value: " vp ", step: models.TransformStep{Type: models.TransformMap, Values: map[string]string{"VP": "Vice President"}, CaseInsensitive: true}, want: "Vice President"},
+		{name: "map keeps unknown values", value: "CEO", step: models.TransformStep{Type: models.TransformMap, Values: map[string]string{"VP": "Vice President"}}, want: "CEO"},
+		{name: "default of a blank value", value: "  ", step: models.TransformStep{Type: models.TransformDefault, Value: "Unknown"}, want: "Unknown"},
+		{name: "default keeps values", value: "Acme", step: models.TransformStep{Type: models.TransformDefault, Value: "Unknown"}, want: "Acme"},
+		{
+			name:  "concat skips blank columns",
+			value: "Jane",
+			step:  models.TransformStep{Type: models.TransformConcat, Delimiter: " ", Columns: []string{"middle", "last"}},
+			row:   map[string]interface{}{"middle": " ", "last": "Doe"},
+			want:  "Jane Doe",
+		},
+		{
+			name:  "coalesce takes the first value",
+			value: "",
+			step:  models.TransformStep{Type: models.TransformCoalesce, Columns: []string{"work", "home"}},
+			row:   map[string]interface{}{"work": "", "home": "+31 20 555 0100"},
+			want:  "+31 20 555 0100",
+		},
+		{name: "coerce number", value: "1,250.5", step: models.TransformStep{Type: models.TransformCoerce, As: models.CoerceNumber}, want: 1250.5},
+		{name: "coerce integer", value: "1,000", step: models.TransformStep{Type: models.TransformCoerce, As: models.CoerceInteger}, want: int64(1000)},
+		{name: "coerce integer of a whole float", value: "42.0", step: models.TransformStep{Type: models.TransformCoerce, As: models.CoerceInteger}, want: int64(42)},
+		{name: "coerce boolean", value: "Yes", step: models.TransformStep{Type: models.TransformCoerce, As: models.CoerceBoolean}, want: true},
+		{name: "coerce date", value: "Jan 2, 2024", step: models.TransformStep{Type: models.TransformCoerce, As: models.CoerceDate}, want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "coerce date with a layout", value: "02/01/2024", step: models.TransformStep{Type: models.TransformCoerce, As: models.CoerceDate, Layout: "02/01/2006"}, want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "coerce keeps blank values", value: " ", step: models.TransformStep{Type: models.TransformCoerce, As: models.CoerceNumber}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline, err := newTransformPipeline([]models.TransformRule{{Column: "value", Steps: []models.TransformStep{tt.step}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			row := map[string]interface{}{"value": tt.value}
+			for column, value := range tt.row {
+				row[column] = value
+			}
+			got, transformErr := pipeline.apply(row)
+			if transformErr != nil {
+				t.Fatal(transformErr)
+			}
+
+			if !reflect.DeepEqual(got["value"], tt.want) {
+				t.Errorf("got %#v, want %#v", got["value"], tt.want)
+			}
+			for column, want := range tt.wantRow {
+				if got[column] != want {
+					t.Errorf("column %s: got %#v, want %#v", column, got[column], want)
+				}
+			}
+			if row["value"] != tt.value {
+				t.Errorf("the input row was changed to %#v", row["value"])
+			}
+		})
+	}
+}
+
+func TestTransformCoerceErrors(t *testing.T) {
+	tests := []struct {
+		value string
+		as    string
+	}{
+		{"twelve", models.CoerceNumber},
+		{"1.5", models.CoerceInteger},
+		{"maybe", models.CoerceBoolean},
+		{"2024-13-45", models.CoerceDate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.as, func(t *testing.T) {
+			pipeline, err := newTransformPipeline([]models.TransformRule{{
+				Column: "Revenue",
+				Steps:  []models.TransformStep{{Type: models.TransformCoerce, As: tt.as}},
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, transformErr := pipeline.apply(map[string]interface{}{"Revenue": tt.value})
+			if transformErr == nil {
+				t.Fatalf("%q coerced to %s", tt.value, tt.as)
+			}
+			if transformErr.column != "Revenue" || !strings.Contains(transformErr.Error(), tt.value) {
+				t.Errorf("unexpected error %v", transformErr)
+			}
+		})
+	}
+}
+
+func TestTransformPipelineRunsRulesInOrder(t *testing.T) {
+	pipeline, err := newTransformPipeline([]models.TransformRule{
+		{Column: "Full Name", Steps: []models.TransformStep{
+			{Type: models.TransformTrim},
+			{Type: models.TransformSplit, Delimiter: " ", Targets: []string{"First", "Last"}},
+		}},
+		{Column: "Last", Target: "Name", Steps: []models.TransformStep{
+			{Type: models.TransformUppercase},
+			{Type: models.TransformConcat, Delimiter: ", ", Columns: []string{"First"}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, transformErr := pipeline.apply(map[string]interface{}{"Full Name": " jane  doe "})
+	if transformErr != nil {
+		t.Fatal(transformErr)
+	}
+
+	want := map[string]interface{}{
+		"Full Name": "jane",
+		"First":     "jane",
+		"Last":      "doe",
+		"Name":      "DOE, jane",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTransformPipelineValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		rule models.TransformRule
+	}{
+		{"no column", models.TransformRule{Steps: []models.TransformStep{{Type: models.TransformTrim}}}},
+		{"no steps", models.TransformRule{Column: "Name"}},
+		{"unknown type", models.TransformRule{Column: "Name", Steps: []models.TransformStep{{Type: "reverse"}}}},
+		{"split without delimiter", models.TransformRule{Column: "Name", Steps: []models.TransformStep{{Type: models.TransformSplit}}}},
+		{"invalid pattern", models.TransformRule{Column: "Name", Steps: []models.TransformStep{{Type: models.TransformRegex, Pattern: "("}}}},
+		{"missing group", models.TransformRule{Column: "Name", Steps: []models.TransformStep{{Type: models.TransformRegex, Pattern: "a", Group: 1}}}},
+		{"map without values", models.TransformRule{Column: "Name", Steps: []models.TransformStep{{Type: models.TransformMap}}}},
+		{"default without value", models.TransformRule{Column: "Name", Steps: []models.TransformStep{{Type: models.TransformDefault}}}},
+		{"concat without columns", models.TransformRule{Column: "Name", Steps: []models.TransformStep{{Type: models.TransformConcat}}}},
+		{"unknown coercion", models.TransformRule{Column: "Name", Steps: []models.TransformStep{{Type: models.TransformCoerce, As: "currency"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTransformPipeline([]models.TransformRule{tt.rule}); err == nil {
+				t.Error("rule was accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,696 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"contact-enrichment-api/config"
+	"contact-enrichment-api/models"
+	"contact-enrichment-api/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MaxStreamLineSize is the maximum size of a single NDJSON line
+const MaxStreamLineSize = 1 << 20
+
+// Errors of the resumable upload protocol, mapped to specific status codes by the controller
+var (
+	ErrUploadNotFound         = errors.New("upload not found")
+	ErrUploadOffsetMismatch   = errors.New("upload offset does not match the received data")
+	ErrUploadChecksumMismatch = errors.New("checksum does not match")
+	ErrUploadTooLarge         = errors.New("upload is too large")
+	ErrUploadExpired          = errors.New("upload has expired")
+	ErrUploadClosed           = errors.New("upload is no longer accepting data")
+	ErrUploadBusy             = errors.New("another chunk is being written to this upload")
+)
+
+type UploadService struct {
+	uploadCollection *mongo.Collection
+	store            storage.BlobStore
+	contactService   *ContactService
+	config           *config.Config
+
+	mu      sync.Mutex
+	writing map[primitive.ObjectID]bool // Uploads with a chunk in progress
+}
+
+func NewUploadService(db *mongo.Database, cfg *config.Config, store storage.BlobStore, contactService *ContactService) *UploadService {
+	return &UploadService{
+		uploadCollection: db.Collection("uploads"),
+		store:            store,
+		contactService:   contactService,
+		config:           cfg,
+		writing:          make(map[primitive.ObjectID]bool),
+	}
+}
+
+// CreateUpload opens an upload session for an import into the organization, the file is then sent in chunks with WriteChunk
+func (s *UploadService) CreateUpload(orgID, userID string, req models.CreateUploadRequest) (*models.UploadSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, errors.New("invalid organization ID")
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	if err := s.contactService.orgService.Authorize(ctx, orgObjectID, userObjectID, models.PermissionContactsWrite); err != nil {
+		return nil, err
+	}
+
+	if req.Size > s.config.MaxUploadSize {
+		return nil, fmt.Errorf("%w: the maximum is %d bytes", ErrUploadTooLarge, s.config.MaxUploadSize)
+	}
+
+	mode := req.Mode
+	if mode == "" {
+		mode = models.ImportModeSkip
+	}
+
+	now := time.Now()
+	session := &models.UploadSession{
+		ID:           primitive.NewObjectID(),
+		OrgID:        orgObjectID,
+		UserID:       userObjectID,
+		Filename:     req.Filename,
+		Format:       req.Format,
+		Size:         req.Size,
+		Checksum:     strings.ToLower(req.Checksum),
+		Status:       models.UploadStatusUploading,
+		Mode:         mode,
+		FieldMapping: req.FieldMapping,
+		Preset:       req.Preset,
+		Transforms:   req.Transforms,
+		ExpiresAt:    now.Add(s.config.UploadExpiration),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if req.TemplateID != "" {
+		template, err := s.contactService.templateService.GetTemplateByID(userID, req.TemplateID)
+		if err != nil {
+			return nil, err
+		}
+		session.TemplateID = &template.ID
+	}
+
+	if _, err := s.store.WriteAt(uploadKey(session), 0, bytes.NewReader(nil)); err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %v", err)
+	}
+
+	if _, err := s.uploadCollection.InsertOne(ctx, session); err != nil {
+		s.deleteBlob(session)
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *UploadService) GetUpload(orgID, userID, uploadID string) (*models.UploadSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	return s.findUpload(ctx, orgID, userID, uploadID)
+}
+
+// WriteChunk appends a chunk at offset, which must match the bytes received so far.
+// checksum is the expected SHA-256 of the chunk, or nil when the client sent none.
+// Once the last byte arrives the file is verified and imported in the background. The user has
+// to be allowed to write contacts of the organization for every chunk, not only when creating it.
+func (s *UploadService) WriteChunk(orgID, userID, uploadID string, offset int64, chunk io.Reader, checksum []byte) (*models.UploadSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	session, err := s.findUpload(ctx, orgID, userID, uploadID)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.contactService.authorize(orgID, userID, models.PermissionContactsWrite); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case session.Status != models.UploadStatusUploading:
+		return session, ErrUploadClosed
+	case time.Now().After(session.ExpiresAt):
+		return session, ErrUploadExpired
+	case offset != session.Offset:
+		return session, ErrUploadOffsetMismatch
+	}
+
+	if !s.startWriting(session.ID) {
+		return session, ErrUploadBusy
+	}
+	defer s.stopWriting(session.ID)
+
+	// Read one byte past the declared size to detect chunks that overrun it
+	remaining := session.Size - offset
+	hash := sha256.New()
+	written, writeErr := s.store.WriteAt(uploadKey(session), offset, io.TeeReader(io.LimitReader(chunk, remaining+1), hash))
+
+	switch {
+	case written > remaining:
+		writeErr = fmt.Errorf("%w: chunk runs past the declared size of %d bytes", ErrUploadTooLarge, session.Size)
+	case writeErr == nil && checksum != nil && !bytes.Equal(hash.Sum(nil), checksum):
+		writeErr = fmt.Errorf("chunk %w", ErrUploadChecksumMismatch)
+	case writeErr != nil && checksum != nil:
+		// A chunk with a checksum is only kept when it arrived complete
+	case writeErr != nil:
+		// Keep what arrived before the connection dropped, the client resumes from the new offset
+		if err := s.saveOffset(session, offset+written); err != nil {
+			log.Printf("Failed to save offset of upload %s: %v", session.ID.Hex(), err)
+		}
+		return session, writeErr
+	}
+
+	if writeErr != nil {
+		if err := s.store.Truncate(uploadKey(session), offset); err != nil {
+			log.Printf("Failed to discard rejected chunk of upload %s: %v", session.ID.Hex(), err)
+		}
+		return session, writeErr
+	}
+
+	if err := s.saveOffset(session, offset+written); err != nil {
+		if errors.Is(err, ErrUploadOffsetMismatch) {
+			// Report the offset the other request reached, the client resumes from there
+			session = s.reloadUpload(session)
+		}
+		return session, err
+	}
+
+	if session.Offset == session.Size {
+		return session, s.completeUpload(session)
+	}
+
+	return session, nil
+}
+
+// DeleteUpload discards an unfinished upload and its data
+func (s *UploadService) DeleteUpload(orgID, userID, uploadID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	session, err := s.findUpload(ctx, orgID, userID, uploadID)
+	if err != nil {
+		return err
+	}
+	if session.Status != models.UploadStatusUploading {
+		return ErrUploadClosed
+	}
+
+	result, err := s.uploadCollection.DeleteOne(ctx, bson.M{"_id": session.ID, "status": models.UploadStatusUploading})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrUploadClosed
+	}
+
+	s.deleteBlob(session)
+	return nil
+}
+
+// StartCleanup removes expired unfinished uploads every interval
+func (s *UploadService) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := s.cleanupExpiredUploads(); err != nil {
+				log.Printf("Failed to clean up expired uploads: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *UploadService) cleanupExpiredUploads() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	filter := bson.M{
+		"status":    models.UploadStatusUploading,
+		"expiresAt": bson.M{"$lt": time.Now()},
+	}
+
+	cursor, err := s.uploadCollection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []models.UploadSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return err
+	}
+
+	for i := range sessions {
+		session := &sessions[i]
+		result, err := s.uploadCollection.DeleteOne(ctx, bson.M{"_id": session.ID, "status": models.UploadStatusUploading})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount > 0 {
+			s.deleteBlob(session)
+		}
+	}
+
+	return nil
+}
+
+// completeUpload verifies the whole file and starts its import. Only the request that moves the
+// upload out of uploading imports it, so the file is never imported twice.
+func (s *UploadService) completeUpload(session *models.UploadSession) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	now := time.Now()
+	result, err := s.uploadCollection.UpdateOne(ctx,
+		bson.M{"_id": session.ID, "status": models.UploadStatusUploading},
+		bson.M{"$set": bson.M{"status": models.UploadStatusProcessing, "updated_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount != 1 {
+		return nil
+	}
+	session.Status = models.UploadStatusProcessing
+	session.UpdatedAt = now
+
+	if session.Checksum != "" {
+		sum, err := s.fileChecksum(session)
+		if err != nil {
+			s.finishUpload(session, nil, err)
+			s.deleteBlob(session)
+			return err
+		}
+		if sum != session.Checksum {
+			s.finishUpload(session, nil, fmt.Errorf("file %w", ErrUploadChecksumMismatch))
+			s.deleteBlob(session)
+			return fmt.Errorf("file %w", ErrUploadChecksumMismatch)
+		}
+	}
+
+	go s.runImport(*session)
+	return nil
+}
+
+func (s *UploadService) fileChecksum(session *models.UploadSession) (string, error) {
+	file, err := s.store.Open(uploadKey(session))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// runImport imports a completed upload through an import stream, so memory use does not grow with the file
+func (s *UploadService) runImport(session models.UploadSession) {
+	defer s.deleteBlob(&session)
+
+	file, err := s.store.Open(uploadKey(&session))
+	if err != nil {
+		s.finishUpload(&session, nil, err)
+		return
+	}
+	defer file.Close()
+
+	// The role may have changed since the upload was created
+	if err := s.contactService.authorize(session.OrgID.Hex(), session.UserID.Hex(), models.PermissionContactsWrite); err != nil {
+		s.finishUpload(&session, nil, err)
+		return
+	}
+
+	stream, err := s.contactService.newImportStream(session.OrgID, session.UserID, models.ImportSourceUpload, session.Mode, DefaultStreamBatchSize)
+	if err != nil {
+		s.finishUpload(&session, nil, err)
+		return
+	}
+
+	// Results are kept on the import record, the per-row results of the stream are not needed
+	var importErr error
+	switch session.Format {
+	case models.UploadFormatCSV:
+		importErr = s.importCSV(&session, stream, file)
+	case models.UploadFormatNDJSON:
+		importErr = importNDJSON(stream, file)
+	default:
+		importErr = fmt.Errorf("unsupported upload format %q", session.Format)
+	}
+
+	_, err = stream.Close(importErr)
+	if importErr == nil {
+		importErr = err
+	}
+
+	importID := stream.ImportID()
+	s.finishUpload(&session, &importID, importErr)
+}
+
+// maxPreambleRows is how many leading rows are searched for the header row of a preset
+const maxPreambleRows = 10
+
+func (s *UploadService) importCSV(session *models.UploadSession, stream *ImportStream, file io.Reader) error {
+	reader := csv.NewReader(bufio.NewReader(file))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	headers, preset, buffered, err := readCSVHeader(reader, session.Preset)
+	if err != nil {
+		return err
+	}
+
+	transforms := session.Transforms
+	if preset != nil {
+		transforms = append(append([]models.TransformRule{}, preset.Transforms...), session.Transforms...)
+	}
+	pipeline, err := newTransformPipeline(transforms)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	var templateID string
+	if session.TemplateID != nil {
+		templateID = session.TemplateID.Hex()
+	}
+	detectedFields := csvDetectedFields(headers, transforms)
+	resolution, err := s.contactService.resolveFieldMappings(ctx, session.UserID.Hex(), detectedFields, preset, templateID, session.FieldMapping)
+	if err != nil {
+		return err
+	}
+	stream.useMapping(pipeline, transforms, resolution, detectedFields, preset)
+
+	for row := 1; ; row++ {
+		var record []string
+		var err error
+		if len(buffered) > 0 {
+			record, buffered = buffered[0], buffered[1:]
+		} else {
+			record, err = reader.Read()
+		}
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return err
+			}
+			_, err = stream.AddError(row, models.ImportErrorInvalidCSV, fmt.Sprintf("Invalid CSV row: %v", parseErr.Err))
+		} else {
+			_, err = stream.AddRow(row, csvRow(headers, record))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readCSVHeader finds the header row and the preset of a CSV file. Exports such as LinkedIn's start
+// with notes, so the first of the leading rows that identifies a preset is the header, otherwise
+// the first row is. Rows read past the header are returned for import.
+func readCSVHeader(reader *csv.Reader, presetOption string) ([]string, *models.ImportPreset, [][]string, error) {
+	var leading [][]string
+	for len(leading) < maxPreambleRows {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(leading) == 0 {
+				return nil, nil, nil, fmt.Errorf("invalid header row: %v", err)
+			}
+			break
+		}
+
+		leading = append(leading, record)
+	}
+	if len(leading) == 0 {
+		return nil, nil, nil, errors.New("file is empty")
+	}
+	leading[0] = append([]string{}, leading[0]...)
+	if len(leading[0]) > 0 {
+		leading[0][0] = strings.TrimPrefix(leading[0][0], "\ufeff")
+	}
+
+	if presetOption != models.ImportPresetNone {
+		for i, record := range leading {
+			headers := csvHeaders(record)
+			if preset := models.SelectImportPreset(presetOption, headers); preset != nil && preset.Matches(headers) {
+				return headers, preset, leading[i+1:], nil
+			}
+		}
+	}
+
+	// No row identifies a preset, a preset chosen explicitly still applies to the first row
+	preset := models.FindImportPreset(presetOption)
+	return csvHeaders(leading[0]), preset, leading[1:], nil
+}
+
+func csvHeaders(record []string) []string {
+	headers := make([]string, len(record))
+	for i, header := range record {
+		headers[i] = strings.TrimSpace(header)
+	}
+	return headers
+}
+
+func importNDJSON(stream *ImportStream, file io.Reader) error {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), MaxStreamLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		if _, err := stream.AddLine(line, data); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if _, addErr := stream.AddError(line+1, models.ImportErrorInvalidJSON, fmt.Sprintf("Unreadable line: %v", err)); addErr != nil {
+			return addErr
+		}
+		return err
+	}
+	return nil
+}
+
+// csvDetectedFields lists the header columns plus the columns transformation rules write to
+func csvDetectedFields(headers []string, transforms []models.TransformRule) []string {
+	fields := make(map[string]bool)
+	for _, header := range headers {
+		if header != "" {
+			fields[header] = true
+		}
+	}
+	for _, rule := range transforms {
+		if rule.Target != "" {
+			fields[rule.Target] = true
+		}
+		for _, step := range rule.Steps {
+			for _, target := range step.Targets {
+				fields[target] = true
+			}
+		}
+	}
+
+	detected := make([]string, 0, len(fields))
+	for field := range fields {
+		detected = append(detected, field)
+	}
+	sort.Strings(detected)
+	return detected
+}
+
+func csvRow(headers, record []string) map[string]interface{} {
+	row := make(map[string]interface{}, len(headers))
+	for i, header := range headers {
+		if header == "" {
+			continue
+		}
+		if i < len(record) {
+			row[header] = record[i]
+		} else {
+			row[header] = ""
+		}
+	}
+	return row
+}
+
+// finishUpload records the outcome of an upload's import
+func (s *UploadService) finishUpload(session *models.UploadSession, importID *primitive.ObjectID, importErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	set := bson.M{
+		"status":     models.UploadStatusImported,
+		"updated_at": time.Now(),
+	}
+	if importID != nil {
+		set["importId"] = importID
+	}
+	if importErr != nil {
+		set["status"] = models.UploadStatusFailed
+		set["failureReason"] = importErr.Error()
+		log.Printf("Import of upload %s failed: %v", session.ID.Hex(), importErr)
+	}
+
+	if _, err := s.uploadCollection.UpdateOne(ctx, bson.M{"_id": session.ID}, bson.M{"$set": set}); err != nil {
+		log.Printf("Failed to record outcome of upload %s: %v", session.ID.Hex(), err)
+	}
+}
+
+// saveOffset advances the offset of an upload that is still at session.Offset. Another request
+// having advanced it first, possibly on another instance, is an offset conflict.
+func (s *UploadService) saveOffset(session *models.UploadSession, offset int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	now := time.Now()
+	result, err := s.uploadCollection.UpdateOne(ctx,
+		bson.M{"_id": session.ID, "offset": session.Offset, "status": models.UploadStatusUploading},
+		bson.M{"$set": bson.M{"offset": offset, "updated_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUploadOffsetMismatch
+	}
+
+	session.Offset = offset
+	session.UpdatedAt = now
+	return nil
+}
+
+// reloadUpload returns the stored state of an upload, or the given one when it cannot be read
+func (s *UploadService) reloadUpload(session *models.UploadSession) *models.UploadSession {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DefaultTimeout)
+	defer cancel()
+
+	var current models.UploadSession
+	if err := s.uploadCollection.FindOne(ctx, bson.M{"_id": session.ID}).Decode(&current); err != nil {
+		log.Printf("Failed to reload upload %s: %v", session.ID.Hex(), err)
+		return session
+	}
+	return &current
+}
+
+func (s *UploadService) startWriting(uploadID primitive.ObjectID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writing[uploadID] {
+		return false
+	}
+	s.writing[uploadID] = true
+	return true
+}
+
+func (s *UploadService) stopWriting(uploadID primitive.ObjectID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.writing, uploadID)
+}
+
+// deleteUploads deletes the upload sessions matching a filter and their files
+func (s *UploadService) deleteUploads(ctx context.Context, filter bson.M) error {
+	cursor, err := s.uploadCollection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []models.UploadSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return err
+	}
+
+	for i := range sessions {
+		session := &sessions[i]
+		result, err := s.uploadCollection.DeleteOne(ctx, bson.M{"_id": session.ID})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount > 0 {
+			s.deleteBlob(session)
+		}
+	}
+
+	return nil
+}
+
+func (s *UploadService) deleteBlob(session *models.UploadSession) {
+	if err := s.store.Delete(uploadKey(session)); err != nil {
+		log.Printf("Failed to delete file of upload %s: %v", session.ID.Hex(), err)
+	}
+}
+
+// findUpload returns an upload the user created in the organization
+func (s *UploadService) findUpload(ctx context.Context, orgID, userID, uploadID string) (*models.UploadSession, error) {
+	orgObjectID, err := primitive.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, errors.New("invalid organization ID")
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	uploadObjectID, err := primitive.ObjectIDFromHex(uploadID)
+	if err != nil {
+		return nil, ErrUploadNotFound
+	}
+
+	var session models.UploadSession
+	err = s.uploadCollection.FindOne(ctx, bson.M{"_id": uploadObjectID, "orgId": orgObjectID, "userId": userObjectID}).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// uploadKey is the blob holding the data of an upload
+func uploadKey(session *models.UploadSession) string {
+	return "uploads/" + session.ID.Hex() + "." + session.Format
+}
@@ -1,6 +1,9 @@
 import type { NitroFetchRequest } from 'nitropack'
 import { ofetch, type FetchOptions } from 'ofetch'
 
+// Shared by concurrent requests, a refresh token can only be used once
+let refreshing: Promise<void> | null = null
+
 interface ApiResponse<T = any> {
   data?: T
   message?: string
@@ -9,7 +12,27 @@ interface ApiResponse<T = any> {
 
 export const useApi = () => {
   const config = useRuntimeConfig()
-  const { user } = useUserSession()
+  const { user, fetch: fetchSession } = useUserSession()
+
+  // Access tokens are short-lived: on a 401 the session is refreshed once and the request retried
+  const withRefresh = async <T>(request: () => Promise<T>): Promise<T> => {
+    try {
+      return await request()
+    } catch (error: any) {
+      if (error?.response?.status !== 401 || !user.value) {
+        throw error
+      }
+      if (!refreshing) {
+        refreshing = $fetch('/api/auth/refresh', { method: 'POST' })
+          .then(() => fetchSession())
+          .finally(() => {
+            refreshing = null
+          })
+      }
+      await refreshing
+      return await request()
+    }
+  }
 
   // Create authenticated fetch instance
   const api = ofetch.create({
@@ -58,7 +81,7 @@ export const useApi = () => {
     endpoint: string, 
     options?: FetchOptions<NitroFetchRequest>
   ): Promise<T> => {
-    return await api<T>(endpoint, { method: 'GET', ...options })
+    return await withRefresh(() => api<T>(endpoint, { method: 'GET', ...options }))
   }
 
   // Wrapper for POST requests
@@ -67,7 +90,7 @@ export const useApi = () => {
     body?: any, 
     options?: FetchOptions<NitroFetchRequest>
   ): Promise<T> => {
-    return await api<T>(endpoint, { method: 'POST', body, ...options })
+    return await withRefresh(() => api<T>(endpoint, { method: 'POST', body, ...options }))
   }
 
   // Wrapper for bulk POST requests with longer timeout
@@ -76,7 +99,7 @@ export const useApi = () => {
     body?: any, 
     options?: FetchOptions<NitroFetchRequest>
   ): Promise<T> => {
-    return await bulkApi<T>(endpoint, { method: 'POST', body, ...options })
+    return await withRefresh(() => bulkApi<T>(endpoint, { method: 'POST', body, ...options }))
   }
 
   // Wrapper for PUT requests
@@ -85,7 +108,7 @@ export const useApi = () => {
     body?: any, 
     options?: FetchOptions<NitroFetchRequest>
   ): Promise<T> => {
-    return await api<T>(endpoint, { method: 'PUT', body, ...options })
+    return await withRefresh(() => api<T>(endpoint, { method: 'PUT', body, ...options }))
   }
 
   // Wrapper for DELETE requests
@@ -93,7 +116,7 @@ export const useApi = () => {
     endpoint: string, 
     options?: FetchOptions<NitroFetchRequest>
   ): Promise<T> => {
-    return await api<T>(endpoint, { method: 'DELETE', ...options })
+    return await withRefresh(() => api<T>(endpoint, { method: 'DELETE', ...options }))
   }
 
   return {
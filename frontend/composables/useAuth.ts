@@ -87,6 +87,7 @@ export const useAuth = () => {
 
   const logout = async () => {
     try {
+      await $fetch('/api/auth/logout', { method: 'POST' })
       await clear()
       if (import.meta.client) {
         localStorage.removeItem('auth_token')
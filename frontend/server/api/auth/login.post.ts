@@ -17,6 +17,10 @@ export default defineEventHandler(async (event) => {
           ...response.user,
           token: response.token
         },
+        // The refresh token never leaves the server
+        secure: {
+          refreshToken: response.refreshToken
+        },
         loggedInAt: Date.now()
       })
 
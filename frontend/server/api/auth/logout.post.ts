@@ -0,0 +1,16 @@
+export default defineEventHandler(async (event) => {
+  const session = await getUserSession(event)
+
+  if (session.user?.token) {
+    // Revoke the tokens on the backend, the local session is cleared either way
+    const config = useRuntimeConfig()
+    await $fetch(`${config.public.apiBase}/auth/logout`, {
+      method: 'POST',
+      headers: { Authorization: `Bearer ${session.user.token}` },
+      body: { refreshToken: session.secure?.refreshToken }
+    }).catch(() => {})
+  }
+
+  await clearUserSession(event)
+  return { success: true }
+})
@@ -0,0 +1,35 @@
+export default defineEventHandler(async (event) => {
+  const session = await requireUserSession(event)
+  const refreshToken = session.secure?.refreshToken
+
+  if (!refreshToken) {
+    throw createError({ statusCode: 401, statusMessage: 'No refresh token' })
+  }
+
+  try {
+    // Exchange the refresh token, the backend rotates it on every use
+    const config = useRuntimeConfig()
+    const response = await $fetch<{ token: string; refreshToken: string }>(`${config.public.apiBase}/auth/refresh`, {
+      method: 'POST',
+      body: { refreshToken }
+    })
+
+    await setUserSession(event, {
+      user: {
+        ...session.user,
+        token: response.token
+      },
+      secure: {
+        refreshToken: response.refreshToken
+      }
+    })
+
+    return { success: true }
+  } catch (error: any) {
+    await clearUserSession(event)
+    throw createError({
+      statusCode: 401,
+      statusMessage: error.message || 'Session expired'
+    })
+  }
+})
@@ -0,0 +1,8 @@
+// Session data only readable on the server
+declare module '#auth-utils' {
+  interface SecureSessionData {
+    refreshToken?: string
+  }
+}
+
+export {}